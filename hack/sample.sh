@@ -1,13 +1,13 @@
 #!/bin/bash
 
-name=$RANDOM
-url='http://localhost:9093/api/v1/alerts'
+# Fires a sample alert and resolves it on enter. `/alertmanager test fire <config ID>`
+# does the same from Mattermost and reports where the alert lands.
 
-echo "firing up alert $name"
+name=$RANDOM
+url="${ALERTMANAGER_URL:-http://localhost:9093}/api/v2/alerts"
 
-# change url o
-curl -XPOST $url -d "[{
-	\"status\": \"firing\",
+alert() {
+	curl -XPOST "$url" -H 'Content-Type: application/json' -d "[{
 	\"labels\": {
 		\"alertname\": \"$name\",
 		\"service\": \"my-service\",
@@ -17,8 +17,13 @@ curl -XPOST $url -d "[{
 	\"annotations\": {
 		\"summary\": \"Run to the montains!\"
 	},
+	$1
 	\"generatorURL\": \"http://prometheus.int.example.net/<generating_expression>\"
 }]"
+}
+
+echo "firing up alert $name"
+alert ""
 
 echo ""
 
@@ -26,18 +31,6 @@ echo "press enter to resolve alert"
 read
 
 echo "sending resolve"
-curl -XPOST $url -d "[{
-	\"status\": \"resolved\",
-	\"labels\": {
-		\"alertname\": \"$name\",
-		\"service\": \"my-service\",
-		\"severity\":\"warning\",
-		\"instance\": \"$name.example.net\"
-	},
-	\"annotations\": {
-		\"summary\": \"Run to the montains!\"
-	},
-	\"generatorURL\": \"http://prometheus.int.example.net/<generating_expression>\"
-}]"
+alert "\"endsAt\": \"$(date -u +%Y-%m-%dT%H:%M:%SZ)\","
 
 echo ""
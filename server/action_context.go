@@ -10,6 +10,9 @@ type ActionContext struct {
 	ConfigID    string                 `json:"config_id"`
 	Duration    string                 `json:"duration"` // For silence: 1h, 4h, 12h, 24h
 	Severity    string                 `json:"severity"` // Alert severity for color mapping
+	Name        string                 `json:"name"`     // For link: the name of the link
+	URL         string                 `json:"url"`      // For link: the rendered URL
+	Runbook     string                 `json:"runbook"`  // For runbook: the key of the runbook
 }
 
 // Action type for decoding action buttons
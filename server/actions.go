@@ -6,8 +6,6 @@ import (
 	"net/http"
 
 	"github.com/mattermost/mattermost/server/public/model"
-
-	"github.com/Kuzyashin/mattermost-plugin-alertmanager/server/alertmanager"
 )
 
 func (p *Plugin) handleExpireAction(w http.ResponseWriter, r *http.Request, alertConfig alertConfig) {
@@ -16,29 +14,45 @@ func (p *Plugin) handleExpireAction(w http.ResponseWriter, r *http.Request, aler
 	var action *Action
 	if err := json.NewDecoder(r.Body).Decode(&action); err != nil {
 		p.API.LogError("Failed to decode action", "error", err.Error())
-		encodeEphemeralMessage(w, "We could not decode the action")
+		encodeEphemeralMessage(w, newLocalizer(defaultLanguage).T("action.invalid"))
 		return
 	}
 
-	if action == nil {
-		encodeEphemeralMessage(w, "We could not decode the action")
+	if action == nil || action.Context == nil {
+		encodeEphemeralMessage(w, newLocalizer(defaultLanguage).T("action.invalid"))
 		return
 	}
+	p.metrics.observeAction(action.Context.Action)
+
+	// The ephemeral replies are for the user who clicked, the post is for the channel
+	l := p.userLocalizer(action.UserID)
+	cl := configLocalizer(alertConfig)
 
 	if action.Context.SilenceID == "" {
-		encodeEphemeralMessage(w, "Silence ID cannot be empty")
+		encodeEphemeralMessage(w, l.T("action.expire.missing_id"))
 		return
 	}
 
-	silenceDeletedMsg := fmt.Sprintf("Silence %s expired.", action.Context.SilenceID)
+	silenceDeletedMsg := l.T("command.expire_silence.done", action.Context.SilenceID)
 
-	err := alertmanager.ExpireSilence(action.Context.SilenceID, alertConfig.AlertManagerURL)
+	err := p.amClient.ExpireSilence(action.Context.SilenceID, alertConfig.alertmanagerAPIURL())
 	if err != nil {
-		msg := fmt.Sprintf("failed to expire the silence: %v", err)
-		encodeEphemeralMessage(w, msg)
+		encodeEphemeralMessage(w, l.T("action.expire.failed", err))
 		return
 	}
 
+	if fingerprint := p.getSilenceAlert(action.Context.SilenceID); fingerprint != "" {
+		event := alertEvent{
+			Type:    eventSilenceExpired,
+			ActorID: action.UserID,
+			Details: cl.T("event.details.silence_expired", action.Context.SilenceID),
+		}
+		if user, appErr := p.API.GetUser(action.UserID); appErr == nil {
+			event.Actor = user.Username
+		}
+		p.recordAlertEvent(alertConfig, fingerprint, nil, event)
+	}
+
 	updatePost := &model.Post{}
 
 	attachments := []*model.SlackAttachment{}
@@ -59,13 +73,13 @@ func (p *Plugin) handleExpireAction(w http.ResponseWriter, r *http.Request, aler
 					var silenceMsg string
 					userName, errUser := p.API.GetUser(action.UserID)
 					if errUser != nil {
-						silenceMsg = "Silence expired"
+						silenceMsg = cl.T("silences.expired")
 					} else {
-						silenceMsg = fmt.Sprintf("Silence expired by %s", userName.Username)
+						silenceMsg = cl.T("silences.expired_by", userName.Username)
 					}
 
 					field := &model.SlackAttachmentField{
-						Title: "Expired by",
+						Title: cl.T("silences.expired_by_title"),
 						Value: silenceMsg,
 						Short: false,
 					}
@@ -0,0 +1,509 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/alertmanager/notify/webhook"
+	"github.com/prometheus/alertmanager/template"
+	"github.com/prometheus/common/model"
+)
+
+// Webhook payload sources of a config, each decoded by its inbound adapter
+const (
+	sourceAlertmanager = "alertmanager"
+	sourceGrafana      = "grafana"
+	sourceMapping      = "mapping"
+
+	// defaultMappingReceiver is the receiver of mapped alerts without a Receiver expression
+	defaultMappingReceiver = "webhook"
+)
+
+// defaultResolvedValues are the status values of mapped alerts that mean resolved, compared
+// case-insensitively
+var defaultResolvedValues = []string{"resolved", "ok", "success", "up"}
+
+// inboundMessage is a webhook payload normalized into an Alertmanager notification
+type inboundMessage struct {
+	webhook.Message
+	// Grafana holds the Grafana fields of the alerts by fingerprint, nil for other sources
+	Grafana map[string]grafanaAlert
+}
+
+// inboundAdapter normalizes the webhook payloads of an alert source, so that the lifecycle,
+// actions and templates of the alerts do not depend on where they come from
+type inboundAdapter interface {
+	decode(data []byte, now time.Time) (inboundMessage, error)
+}
+
+// adapterFor returns the inbound adapter of the source of the config
+func adapterFor(alertConfig alertConfig) inboundAdapter {
+	if alertConfig.Source == sourceMapping {
+		return mappingAdapter{mapping: alertConfig.FieldMapping}
+	}
+	return alertmanagerAdapter{config: alertConfig}
+}
+
+// alertmanagerAdapter decodes Alertmanager payloads, with the fields Grafana adds to them
+type alertmanagerAdapter struct {
+	config alertConfig
+}
+
+func (a alertmanagerAdapter) decode(data []byte, _ time.Time) (inboundMessage, error) {
+	var inbound inboundMessage
+	if err := json.Unmarshal(data, &inbound.Message); err != nil {
+		return inboundMessage{}, err
+	}
+
+	grafana, err := decodeGrafanaAlerts(a.config, data)
+	if err != nil {
+		return inboundMessage{}, fmt.Errorf("invalid Grafana fields: %w", err)
+	}
+	inbound.Grafana = grafana
+	return inbound, nil
+}
+
+// FieldMapping maps arbitrary JSON payloads to alerts with JSONPath-like expressions. An expression
+// starting with "@" is evaluated against the alert, one starting with "$" against the whole payload,
+// e.g. "@.check.name" or "$.pipeline['build-id']"; any other expression is a literal value, quoted
+// with single quotes when it starts with "@" or "$".
+type FieldMapping struct {
+	Alerts         string            // Path of the list of alerts, the payload is a single alert when empty
+	Labels         map[string]string // Label name to expression, e.g. {"alertname": "@.check", "severity": "critical"}
+	Annotations    map[string]string // Annotation name to expression
+	Status         string            // Status of the alert, resolved when its value is one of ResolvedValues
+	ResolvedValues []string          // Status values meaning resolved, defaults to resolved, ok, success and up
+	StartsAt       string            // RFC 3339 time or Unix timestamp, defaults to the time the payload is received
+	EndsAt         string            // RFC 3339 time or Unix timestamp, without a Status the alert is resolved once it passed
+	Fingerprint    string            // Computed from the labels, like Alertmanager does, when empty
+	GeneratorURL   string
+	Receiver       string // Receiver of the notification, "webhook" by default
+}
+
+// UnmarshalJSON implements custom unmarshaling to handle both string and object
+func (m *FieldMapping) UnmarshalJSON(data []byte) error {
+	// fieldMapping has the fields without the method, to decode them without recursing
+	type fieldMapping FieldMapping
+
+	// Try to unmarshal as an object first
+	var mapping fieldMapping
+	if err := json.Unmarshal(data, &mapping); err == nil {
+		*m = FieldMapping(mapping)
+		return nil
+	}
+
+	// If that fails, try to unmarshal as a string (JSON string)
+	var str string
+	if err := json.Unmarshal(data, &str); err != nil {
+		return err
+	}
+	if str == "" {
+		*m = FieldMapping{}
+		return nil
+	}
+
+	if err := json.Unmarshal([]byte(str), &mapping); err != nil {
+		return err
+	}
+	*m = FieldMapping(mapping)
+	return nil
+}
+
+// expressions returns every expression of the mapping by field name
+func (m FieldMapping) expressions() map[string]string {
+	expressions := map[string]string{
+		"Alerts":       m.Alerts,
+		"Status":       m.Status,
+		"StartsAt":     m.StartsAt,
+		"EndsAt":       m.EndsAt,
+		"Fingerprint":  m.Fingerprint,
+		"GeneratorURL": m.GeneratorURL,
+		"Receiver":     m.Receiver,
+	}
+	for name, expr := range m.Labels {
+		expressions[fmt.Sprintf("Labels[%s]", name)] = expr
+	}
+	for name, expr := range m.Annotations {
+		expressions[fmt.Sprintf("Annotations[%s]", name)] = expr
+	}
+	return expressions
+}
+
+// validate checks that the mapping labels the alerts and that its expressions parse
+func (m FieldMapping) validate() []error {
+	var errs []error
+	if len(m.Labels) == 0 {
+		errs = append(errs, errors.New("needs Labels, they identify the alerts"))
+	}
+	for name := range m.Labels {
+		if !model.LabelName(name).IsValid() {
+			errs = append(errs, fmt.Errorf("invalid label name %q", name))
+		}
+	}
+
+	expressions := m.expressions()
+	for _, field := range sortedKeys(expressions) {
+		expr, err := parseMappingExpr(expressions[field])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", field, err))
+			continue
+		}
+		if field == "Alerts" && expr.root == 0 && expr.literal != "" {
+			errs = append(errs, fmt.Errorf("%s: %q is not a path", field, expressions[field]))
+		}
+	}
+	return errs
+}
+
+// pathStep is an object key or a list index of a mapping path
+type pathStep struct {
+	key     string
+	index   int
+	isIndex bool
+}
+
+// mappingExpr is a parsed mapping expression, a path from its root or a literal when root is 0
+type mappingExpr struct {
+	root    byte
+	steps   []pathStep
+	literal string
+}
+
+// parseMappingExpr parses a path like "@.labels['app.kubernetes.io/name']" or "$.alerts[0].id", or
+// a literal
+func parseMappingExpr(expr string) (mappingExpr, error) {
+	if expr == "" || (expr[0] != '$' && expr[0] != '@') {
+		if len(expr) >= 2 && expr[0] == '\'' && expr[len(expr)-1] == '\'' {
+			expr = expr[1 : len(expr)-1]
+		}
+		return mappingExpr{literal: expr}, nil
+	}
+
+	e := mappingExpr{root: expr[0]}
+	rest := expr[1:]
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			end := strings.IndexAny(rest[1:], ".[")
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			key := rest[1 : end+1]
+			if key == "" {
+				return mappingExpr{}, fmt.Errorf("empty key in %q", expr)
+			}
+			e.steps = append(e.steps, pathStep{key: key})
+			rest = rest[end+1:]
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return mappingExpr{}, fmt.Errorf("unclosed [ in %q", expr)
+			}
+			inner := rest[1:end]
+			if len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0] {
+				e.steps = append(e.steps, pathStep{key: inner[1 : len(inner)-1]})
+			} else if index, err := strconv.Atoi(inner); err == nil && index >= 0 {
+				e.steps = append(e.steps, pathStep{index: index, isIndex: true})
+			} else {
+				return mappingExpr{}, fmt.Errorf("invalid index [%s] in %q, use a number or a quoted key", inner, expr)
+			}
+			rest = rest[end+1:]
+		default:
+			return mappingExpr{}, fmt.Errorf("unexpected %q in %q, use .key, ['key'] or [index]", rest[0], expr)
+		}
+	}
+	return e, nil
+}
+
+// eval returns the value the expression selects, nil when the path does not exist
+func (e mappingExpr) eval(payload, alert any) any {
+	if e.root == 0 {
+		if e.literal == "" {
+			return nil
+		}
+		return e.literal
+	}
+
+	value := payload
+	if e.root == '@' {
+		value = alert
+	}
+	for _, step := range e.steps {
+		switch v := value.(type) {
+		case map[string]any:
+			if step.isIndex {
+				return nil
+			}
+			value = v[step.key]
+		case []any:
+			if !step.isIndex || step.index >= len(v) {
+				return nil
+			}
+			value = v[step.index]
+		default:
+			return nil
+		}
+	}
+	return value
+}
+
+// evalString returns the value the expression selects as text, JSON for objects and lists
+func (e mappingExpr) evalString(payload, alert any) string {
+	switch v := e.eval(payload, alert).(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return ""
+		}
+		return string(data)
+	}
+}
+
+// evalTime returns the time the expression selects, an RFC 3339 string or a Unix timestamp in
+// seconds or milliseconds, zero when the path does not exist
+func (e mappingExpr) evalTime(payload, alert any) (time.Time, error) {
+	switch v := e.eval(payload, alert).(type) {
+	case nil:
+		return time.Time{}, nil
+	case json.Number:
+		timestamp, err := v.Float64()
+		if err != nil {
+			return time.Time{}, err
+		}
+		return unixTime(timestamp), nil
+	case string:
+		if v == "" {
+			return time.Time{}, nil
+		}
+		if timestamp, err := strconv.ParseFloat(v, 64); err == nil {
+			return unixTime(timestamp), nil
+		}
+		return time.Parse(time.RFC3339Nano, v)
+	default:
+		return time.Time{}, fmt.Errorf("%v is not a time", v)
+	}
+}
+
+// unixTime converts a Unix timestamp, in milliseconds when it is too large for seconds
+func unixTime(timestamp float64) time.Time {
+	if timestamp > 1e12 {
+		timestamp /= 1000
+	}
+	seconds, frac := math.Modf(timestamp)
+	return time.Unix(int64(seconds), int64(frac*1e9)).UTC()
+}
+
+// mappingAdapter normalizes arbitrary JSON payloads with the field mapping of a config
+type mappingAdapter struct {
+	mapping FieldMapping
+}
+
+// mappingExprs are the parsed expressions of a field mapping
+type mappingExprs struct {
+	alerts, status, startsAt, endsAt, fingerprint, generatorURL, receiver mappingExpr
+	labels, annotations                                                   map[string]mappingExpr
+}
+
+func (a mappingAdapter) parse() (mappingExprs, error) {
+	var exprs mappingExprs
+	var err error
+	for _, field := range []struct {
+		expr *mappingExpr
+		src  string
+	}{
+		{&exprs.alerts, a.mapping.Alerts},
+		{&exprs.status, a.mapping.Status},
+		{&exprs.startsAt, a.mapping.StartsAt},
+		{&exprs.endsAt, a.mapping.EndsAt},
+		{&exprs.fingerprint, a.mapping.Fingerprint},
+		{&exprs.generatorURL, a.mapping.GeneratorURL},
+		{&exprs.receiver, a.mapping.Receiver},
+	} {
+		if *field.expr, err = parseMappingExpr(field.src); err != nil {
+			return mappingExprs{}, err
+		}
+	}
+
+	parseMap := func(src map[string]string) (map[string]mappingExpr, error) {
+		parsed := make(map[string]mappingExpr, len(src))
+		for name, s := range src {
+			expr, err := parseMappingExpr(s)
+			if err != nil {
+				return nil, err
+			}
+			parsed[name] = expr
+		}
+		return parsed, nil
+	}
+	if exprs.labels, err = parseMap(a.mapping.Labels); err != nil {
+		return mappingExprs{}, err
+	}
+	if exprs.annotations, err = parseMap(a.mapping.Annotations); err != nil {
+		return mappingExprs{}, err
+	}
+	return exprs, nil
+}
+
+func (a mappingAdapter) decode(data []byte, now time.Time) (inboundMessage, error) {
+	exprs, err := a.parse()
+	if err != nil {
+		return inboundMessage{}, fmt.Errorf("invalid field mapping: %w", err)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var payload any
+	if err := decoder.Decode(&payload); err != nil {
+		return inboundMessage{}, err
+	}
+
+	items := []any{payload}
+	if a.mapping.Alerts != "" {
+		list, ok := exprs.alerts.eval(payload, payload).([]any)
+		if !ok {
+			return inboundMessage{}, fmt.Errorf("%s is not a list", a.mapping.Alerts)
+		}
+		items = list
+	}
+
+	resolvedValues := a.mapping.ResolvedValues
+	if len(resolvedValues) == 0 {
+		resolvedValues = defaultResolvedValues
+	}
+
+	receiver := exprs.receiver.evalString(payload, payload)
+	if receiver == "" {
+		receiver = defaultMappingReceiver
+	}
+	message := webhook.Message{
+		Data: &template.Data{
+			Receiver:          receiver,
+			Status:            alertStatusResolved,
+			Alerts:            make(template.Alerts, 0, len(items)),
+			GroupLabels:       template.KV{},
+			CommonLabels:      template.KV{},
+			CommonAnnotations: template.KV{},
+		},
+	}
+
+	for i, item := range items {
+		alert := template.Alert{
+			Labels:       evalKV(exprs.labels, payload, item),
+			Annotations:  evalKV(exprs.annotations, payload, item),
+			GeneratorURL: exprs.generatorURL.evalString(payload, item),
+			Fingerprint:  exprs.fingerprint.evalString(payload, item),
+		}
+		if len(alert.Labels) == 0 {
+			return inboundMessage{}, fmt.Errorf("alert #%d has no labels", i+1)
+		}
+		if alert.Fingerprint == "" {
+			alert.Fingerprint = model.LabelSet(labelSet(alert.Labels)).Fingerprint().String()
+		}
+
+		if alert.StartsAt, err = exprs.startsAt.evalTime(payload, item); err != nil {
+			return inboundMessage{}, fmt.Errorf("alert #%d: StartsAt: %w", i+1, err)
+		}
+		if alert.StartsAt.IsZero() {
+			alert.StartsAt = now
+		}
+		if alert.EndsAt, err = exprs.endsAt.evalTime(payload, item); err != nil {
+			return inboundMessage{}, fmt.Errorf("alert #%d: EndsAt: %w", i+1, err)
+		}
+
+		resolved := !alert.EndsAt.IsZero() && !alert.EndsAt.After(now)
+		if a.mapping.Status != "" {
+			status := exprs.status.evalString(payload, item)
+			resolved = containsFold(resolvedValues, status)
+		}
+		alert.Status = "firing"
+		if resolved {
+			alert.Status = alertStatusResolved
+			if alert.EndsAt.IsZero() {
+				alert.EndsAt = now
+			}
+		} else {
+			message.Status = "firing"
+		}
+
+		message.Alerts = append(message.Alerts, alert)
+	}
+
+	if len(message.Alerts) > 0 {
+		message.CommonLabels = commonKV(message.Alerts, func(alert template.Alert) template.KV { return alert.Labels })
+		message.CommonAnnotations = commonKV(message.Alerts, func(alert template.Alert) template.KV { return alert.Annotations })
+	}
+	return inboundMessage{Message: message}, nil
+}
+
+// evalKV evaluates the expressions of labels or annotations, dropping the empty values
+func evalKV(exprs map[string]mappingExpr, payload, item any) template.KV {
+	kv := make(template.KV, len(exprs))
+	for name, expr := range exprs {
+		if value := expr.evalString(payload, item); value != "" {
+			kv[name] = value
+		}
+	}
+	return kv
+}
+
+func labelSet(kv template.KV) model.LabelSet {
+	set := make(model.LabelSet, len(kv))
+	for name, value := range kv {
+		set[model.LabelName(name)] = model.LabelValue(value)
+	}
+	return set
+}
+
+// commonKV returns the pairs all alerts share, as Alertmanager does for CommonLabels
+func commonKV(alerts template.Alerts, kv func(alert template.Alert) template.KV) template.KV {
+	common := make(template.KV)
+	for name, value := range kv(alerts[0]) {
+		common[name] = value
+	}
+	for _, alert := range alerts[1:] {
+		pairs := kv(alert)
+		for name, value := range common {
+			if pairs[name] != value {
+				delete(common, name)
+			}
+		}
+	}
+	return common
+}
+
+func containsFold(values []string, s string) bool {
+	for _, value := range values {
+		if strings.EqualFold(value, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// formatGeneratedBy renders where an alert comes from, with the values and links of Grafana alerts
+func formatGeneratedBy(config alertConfig, l localizer, alert template.Alert, notification alertNotification) string {
+	if ga, ok := notification.Grafana[alert.Fingerprint]; ok {
+		return formatGrafanaDetails(l, ga, alert.Status != alertStatusResolved) + l.T("grafana.generated_by", alert.GeneratorURL, notification.Receiver)
+	}
+	if config.Source == sourceMapping {
+		if alert.GeneratorURL != "" {
+			return l.T("adapter.generated_by_link", notification.Receiver, alert.GeneratorURL)
+		}
+		return l.T("adapter.generated_by", notification.Receiver)
+	}
+	return l.T("alert.generated_by", alert.GeneratorURL, notification.ExternalURL, notification.Receiver)
+}
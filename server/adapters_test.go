@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const sampleCIPayload = `{
+	"pipeline": {"name": "deploy", "url": "https://ci.example.com/pipelines/42"},
+	"failures": [
+		{"job": "build", "state": "failed", "started": 1700000000, "log": {"tail": "exit 1"}},
+		{"job": "test", "state": "success", "started": "2023-11-14T22:13:20Z", "finished": "2023-11-14T22:20:00Z"}
+	]
+}`
+
+func sampleFieldMapping() FieldMapping {
+	return FieldMapping{
+		Alerts:         "$.failures",
+		Labels:         map[string]string{"alertname": "CIJobFailed", "pipeline": "$.pipeline.name", "job": "@.job"},
+		Annotations:    map[string]string{"summary": "@.log.tail", "missing": "@.nope"},
+		Status:         "@.state",
+		ResolvedValues: []string{"success"},
+		StartsAt:       "@.started",
+		EndsAt:         "@['finished']",
+		GeneratorURL:   "$.pipeline.url",
+		Receiver:       "ci",
+	}
+}
+
+func TestMappingAdapter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	inbound, err := mappingAdapter{mapping: sampleFieldMapping()}.decode([]byte(sampleCIPayload), now)
+	require.NoError(t, err)
+	require.Len(t, inbound.Alerts, 2)
+	assert.Nil(t, inbound.Grafana)
+	assert.Equal(t, "ci", inbound.Receiver)
+	assert.Equal(t, "firing", inbound.Status)
+	assert.Equal(t, "deploy", inbound.CommonLabels["pipeline"])
+	assert.NotContains(t, inbound.CommonLabels, "job")
+
+	build := inbound.Alerts[0]
+	assert.Equal(t, "firing", build.Status)
+	assert.Equal(t, map[string]string{"alertname": "CIJobFailed", "pipeline": "deploy", "job": "build"}, map[string]string(build.Labels))
+	assert.Equal(t, map[string]string{"summary": "exit 1"}, map[string]string(build.Annotations))
+	assert.Equal(t, time.Unix(1700000000, 0).UTC(), build.StartsAt)
+	assert.True(t, build.EndsAt.IsZero())
+	assert.Equal(t, "https://ci.example.com/pipelines/42", build.GeneratorURL)
+	assert.Len(t, build.Fingerprint, 16, "the fingerprint is computed from the labels")
+
+	test := inbound.Alerts[1]
+	assert.Equal(t, alertStatusResolved, test.Status)
+	assert.Equal(t, time.Date(2023, 11, 14, 22, 20, 0, 0, time.UTC), test.EndsAt)
+	assert.NotEqual(t, build.Fingerprint, test.Fingerprint)
+
+	// The same labels give the same fingerprint, so the alert resolves its post
+	again, err := mappingAdapter{mapping: sampleFieldMapping()}.decode([]byte(sampleCIPayload), now.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, build.Fingerprint, again.Alerts[0].Fingerprint)
+}
+
+func TestMappingAdapterSingleAlert(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	mapping := FieldMapping{
+		Labels:      map[string]string{"alertname": "@.check", "host": "@.host"},
+		Fingerprint: "@.id",
+		EndsAt:      "@.ends",
+	}
+
+	inbound, err := mappingAdapter{mapping: mapping}.decode([]byte(`{"check": "Disk", "host": "db1", "id": 7, "ends": 1704067200000}`), now)
+	require.NoError(t, err)
+	require.Len(t, inbound.Alerts, 1)
+	alert := inbound.Alerts[0]
+	assert.Equal(t, "7", alert.Fingerprint)
+	assert.Equal(t, now, alert.StartsAt)
+	assert.Equal(t, alertStatusResolved, alert.Status, "without a Status the alert is resolved once it ended")
+	assert.Equal(t, defaultMappingReceiver, inbound.Receiver)
+
+	_, err = mappingAdapter{mapping: mapping}.decode([]byte(`{"other": 1}`), now)
+	assert.Error(t, err, "alerts need labels")
+
+	mapping.Alerts = "@.items"
+	_, err = mappingAdapter{mapping: mapping}.decode([]byte(`{"items": {}}`), now)
+	assert.Error(t, err)
+}
+
+func TestParseMappingExpr(t *testing.T) {
+	payload := map[string]any{"a": map[string]any{"b.c": []any{"x", "y"}}}
+
+	expr, err := parseMappingExpr(`$.a['b.c'][1]`)
+	require.NoError(t, err)
+	assert.Equal(t, "y", expr.evalString(payload, nil))
+
+	expr, err = parseMappingExpr(`'@home'`)
+	require.NoError(t, err)
+	assert.Equal(t, "@home", expr.evalString(payload, nil))
+
+	expr, err = parseMappingExpr(`$.a`)
+	require.NoError(t, err)
+	assert.Equal(t, `{"b.c":["x","y"]}`, expr.evalString(payload, nil))
+
+	for _, invalid := range []string{"$.", "$.a[", "$[x]", "$a"} {
+		_, err := parseMappingExpr(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestFieldMappingConfig(t *testing.T) {
+	var alertCfg alertConfig
+	require.NoError(t, json.Unmarshal([]byte(`{"source": "mapping", "fieldmapping": "{\"labels\": {\"alertname\": \"@.check\"}, \"status\": \"@.state\"}"}`), &alertCfg))
+	assert.Equal(t, "@.check", alertCfg.FieldMapping.Labels["alertname"])
+	assert.Equal(t, "@.state", alertCfg.FieldMapping.Status)
+	assert.IsType(t, mappingAdapter{}, adapterFor(alertCfg))
+	assert.IsType(t, alertmanagerAdapter{}, adapterFor(alertConfig{Source: sourceGrafana}))
+
+	assert.Empty(t, alertCfg.FieldMapping.validate())
+	errs := FieldMapping{Alerts: "items", Status: "$.a["}.validate()
+	require.Len(t, errs, 3)
+	assert.Contains(t, errs[0].Error(), "needs Labels")
+	assert.Contains(t, errs[1].Error(), "Alerts")
+	assert.Contains(t, errs[2].Error(), "Status")
+}
@@ -41,6 +41,8 @@ func (p *Plugin) handleAlertAction(w http.ResponseWriter, r *http.Request) {
 		"fingerprint", action.Context.Fingerprint,
 	)
 
+	p.metrics.observeAction(action.Context.Action)
+
 	switch action.Context.Action {
 	case actionSilence:
 		p.handleSilenceAction(w, action)
@@ -48,6 +50,10 @@ func (p *Plugin) handleAlertAction(w http.ResponseWriter, r *http.Request) {
 		p.handleAckAction(w, action)
 	case actionUnack:
 		p.handleUnackAction(w, action)
+	case actionLink:
+		p.handleLinkAction(w, action)
+	case actionRunbook:
+		p.handleRunbookAction(w, action)
 	default:
 		p.API.LogWarn("[ACTION] Unknown action", "action", action.Context.Action)
 		http.Error(w, "Unknown action", http.StatusBadRequest)
@@ -68,6 +74,11 @@ func (p *Plugin) handleSilenceAction(w http.ResponseWriter, action Action) {
 		http.Error(w, "Config not found", http.StatusNotFound)
 		return
 	}
+	if !alertCfg.hasAlertmanager() {
+		p.API.LogWarn("[ACTION] Silence requested for a config without Alertmanager", "config_id", configID)
+		http.Error(w, "The config has no Alertmanager", http.StatusBadRequest)
+		return
+	}
 
 	// Parse duration
 	dur, err := time.ParseDuration(duration)
@@ -93,8 +104,9 @@ func (p *Plugin) handleSilenceAction(w http.ResponseWriter, action Action) {
 	)
 
 	// Create silence in AlertManager
-	comment := fmt.Sprintf("Silenced from Mattermost by %s", user.Username)
-	silenceID, err := p.createSilence(alertCfg.AlertManagerURL, labels, dur, user.Username, comment)
+	l := configLocalizer(alertCfg)
+	comment := l.T("silences.comment", user.Username)
+	silenceID, err := p.createSilence(alertCfg.alertmanagerAPIURL(), labels, dur, user.Username, comment)
 	if err != nil {
 		p.API.LogError("[ACTION] Failed to create silence in AlertManager",
 			"error", err.Error(),
@@ -113,29 +125,25 @@ func (p *Plugin) handleSilenceAction(w http.ResponseWriter, action Action) {
 	}
 
 	// Add thread reply with silence ID
-	threadMessage := fmt.Sprintf(
-		"🔕 **Silenced for %s**\n\nBy: @%s\nUntil: %s\nSilence ID: `%s`",
-		duration,
-		user.Username,
-		time.Now().Add(dur).Format(time.RFC1123),
-		silenceID,
-	)
-
-	threadPost := &model.Post{
-		ChannelId: post.ChannelId,
-		UserId:    p.BotUserID,
-		RootId:    post.Id,
-		Message:   threadMessage,
-	}
-
-	if _, appErr := p.API.CreatePost(threadPost); appErr != nil {
-		p.API.LogError("[ACTION] Failed to create thread post", "error", appErr.Error())
-	}
+	threadData := p.actionThreadTemplateData(alertCfg, fingerprint, post.Id, threadEventSilenced, user.Username)
+	threadData.SilenceID = silenceID
+	threadData.SilenceDuration = duration
+	threadData.SilenceEndsAt = threadData.At.Add(dur)
+	eventPostID := p.postThreadReply(alertCfg, post, threadData)
+
+	p.saveSilenceAlert(alertCfg, silenceID, fingerprint)
+	p.recordAlertEvent(alertCfg, fingerprint, nil, alertEvent{
+		Type:    eventSilenced,
+		ActorID: user.Id,
+		Actor:   user.Username,
+		PostID:  eventPostID,
+		Details: l.T("event.details.silenced", duration, silenceID),
+	})
 
 	w.WriteHeader(http.StatusOK)
 	response := map[string]interface{}{
 		"update": map[string]interface{}{
-			"message": fmt.Sprintf("🔕 Silenced for %s by @%s", duration, user.Username),
+			"message": l.T("action.silenced", duration, user.Username),
 		},
 	}
 	if err := json.NewEncoder(w).Encode(response); err != nil {
@@ -181,27 +189,24 @@ func (p *Plugin) handleAckAction(w http.ResponseWriter, action Action) {
 	}
 
 	// Add thread reply
-	threadMessage := fmt.Sprintf(
-		"👁️ **Alert Acknowledged**\n\nBy: @%s\nAt: %s",
-		user.Username,
-		time.Now().Format(time.RFC1123),
-	)
-
-	threadPost := &model.Post{
-		ChannelId: post.ChannelId,
-		UserId:    p.BotUserID,
-		RootId:    post.Id,
-		Message:   threadMessage,
-	}
-
-	if _, appErr := p.API.CreatePost(threadPost); appErr != nil {
-		p.API.LogError("[ACTION] Failed to create thread post", "error", appErr.Error())
-	}
+	threadData := p.actionThreadTemplateData(alertCfg, fingerprint, post.Id, threadEventAcked, user.Username)
+	eventPostID := p.postThreadReply(alertCfg, post, threadData)
 
 	p.API.LogInfo("[ACTION] Alert acknowledged",
 		"fingerprint", fingerprint,
 		"user", user.Username,
 	)
+	p.recordAlertEvent(alertCfg, fingerprint, nil, alertEvent{
+		Type:    eventAcked,
+		ActorID: user.Id,
+		Actor:   user.Username,
+		PostID:  eventPostID,
+	})
+
+	// Render the acked template of the alert, or the firing one again once unacknowledged
+	if message, ok := p.renderAckMessage(alertCfg, fingerprint, post.Id, true); ok {
+		post.Message = message
+	}
 
 	// Update post buttons - replace ACK with UNACK
 	updatedAttachments := p.updateActionButtons(post, fingerprint, modeAckToUnack, alertCfg, severity)
@@ -284,27 +289,24 @@ func (p *Plugin) handleUnackAction(w http.ResponseWriter, action Action) {
 	}
 
 	// Add thread reply
-	threadMessage := fmt.Sprintf(
-		"🔄 **Alert Unacknowledged**\n\nBy: @%s\nAt: %s",
-		user.Username,
-		time.Now().Format(time.RFC1123),
-	)
-
-	threadPost := &model.Post{
-		ChannelId: post.ChannelId,
-		UserId:    p.BotUserID,
-		RootId:    post.Id,
-		Message:   threadMessage,
-	}
-
-	if _, appErr := p.API.CreatePost(threadPost); appErr != nil {
-		p.API.LogError("[ACTION] Failed to create thread post", "error", appErr.Error())
-	}
+	threadData := p.actionThreadTemplateData(alertCfg, fingerprint, post.Id, threadEventUnacked, user.Username)
+	eventPostID := p.postThreadReply(alertCfg, post, threadData)
 
 	p.API.LogInfo("[ACTION] Alert unacknowledged",
 		"fingerprint", fingerprint,
 		"user", user.Username,
 	)
+	p.recordAlertEvent(alertCfg, fingerprint, nil, alertEvent{
+		Type:    eventUnacked,
+		ActorID: user.Id,
+		Actor:   user.Username,
+		PostID:  eventPostID,
+	})
+
+	// Render the acked template of the alert, or the firing one again once unacknowledged
+	if message, ok := p.renderAckMessage(alertCfg, fingerprint, post.Id, false); ok {
+		post.Message = message
+	}
 
 	// Update post buttons - replace UNACK with ACK
 	updatedAttachments := p.updateActionButtons(post, fingerprint, modeUnackToAck, alertCfg, severity)
@@ -352,6 +354,8 @@ func (p *Plugin) handleUnackAction(w http.ResponseWriter, action Action) {
 // updateActionButtons updates the action buttons in a post
 // mode: "ack_to_unack" or "unack_to_ack"
 func (p *Plugin) updateActionButtons(post *model.Post, fingerprint, mode string, alertCfg alertConfig, severity string) []*model.SlackAttachment {
+	l := configLocalizer(alertCfg)
+
 	// Get current attachments - they might be stored as []interface{}
 	attachmentsProp := post.GetProp("attachments")
 	if attachmentsProp == nil {
@@ -467,10 +471,12 @@ func (p *Plugin) updateActionButtons(post *model.Post, fingerprint, mode string,
 				continue
 			}
 
-			// Keep Silence buttons as-is
+			// Keep Silence buttons as-is, posts of mapping configs created before they lost them drop them
 			if action.Integration != nil {
 				if ctx, ok := action.Integration.Context["action"].(string); ok && ctx == actionSilence {
-					newActions = append(newActions, action)
+					if alertCfg.hasAlertmanager() {
+						newActions = append(newActions, action)
+					}
 					continue
 				}
 			}
@@ -482,13 +488,15 @@ func (p *Plugin) updateActionButtons(post *model.Post, fingerprint, mode string,
 					if ctx, ok := action.Integration.Context["action"].(string); ok && ctx == actionAck {
 						// Replace with UNACK button
 						newActions = append(newActions, &model.PostAction{
-							Name: "🔄 UNACK",
+							Name: l.T("button.unack"),
 							Type: model.PostActionTypeButton,
 							Integration: &model.PostActionIntegration{
 								URL: fmt.Sprintf("%s/plugins/%s/api/action", siteURL, Manifest.Id),
 								Context: map[string]interface{}{
 									"action":      actionUnack,
 									"fingerprint": fingerprint,
+									"config_id":   alertCfg.ID,
+									"severity":    severity,
 								},
 							},
 						})
@@ -501,13 +509,15 @@ func (p *Plugin) updateActionButtons(post *model.Post, fingerprint, mode string,
 					if ctx, ok := action.Integration.Context["action"].(string); ok && ctx == actionUnack {
 						// Replace with ACK button
 						newActions = append(newActions, &model.PostAction{
-							Name: "👁️ ACK",
+							Name: l.T("button.ack"),
 							Type: model.PostActionTypeButton,
 							Integration: &model.PostActionIntegration{
 								URL: fmt.Sprintf("%s/plugins/%s/api/action", siteURL, Manifest.Id),
 								Context: map[string]interface{}{
 									"action":      actionAck,
 									"fingerprint": fingerprint,
+									"config_id":   alertCfg.ID,
+									"severity":    severity,
 								},
 							},
 						})
@@ -528,13 +538,13 @@ func (p *Plugin) updateActionButtons(post *model.Post, fingerprint, mode string,
 			attachments[0].Color = getAlertColor(alertCfg, severity, stateAcked)
 			// Update title in first field if it exists
 			if len(attachments[0].Fields) > 0 && attachments[0].Fields[0] != nil {
-				attachments[0].Fields[0].Title = "👁️ ACKNOWLEDGED 👁️"
+				attachments[0].Fields[0].Title = l.T("alert.acked_title")
 			}
 		} else if mode == modeUnackToAck {
 			attachments[0].Color = getAlertColor(alertCfg, severity, stateFiring)
 			// Restore firing title in first field if it exists
 			if len(attachments[0].Fields) > 0 && attachments[0].Fields[0] != nil {
-				attachments[0].Fields[0].Title = "🔥 FIRING 🔥"
+				attachments[0].Fields[0].Title = l.T("alert.firing_title")
 			}
 		}
 	}
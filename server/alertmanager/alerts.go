@@ -2,14 +2,78 @@ package alertmanager
 
 import (
 	"encoding/json"
+	"fmt"
+	"io"
 	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/prometheus/alertmanager/types"
 )
 
 // ListAlerts returns a slice of Alert and an error.
-func ListAlerts(alertmanagerURL string) ([]*types.Alert, error) {
-	resp, err := httpRetry(http.MethodGet, alertmanagerURL+"/api/v2/alerts")
+func (c *Client) ListAlerts(alertmanagerURL string) ([]*types.Alert, error) {
+	return c.listAlerts(alertmanagerURL + "/api/v2/alerts")
+}
+
+// ListGroupAlerts returns the active alerts routed to the receiver that match
+// all the group labels of a notification.
+func (c *Client) ListGroupAlerts(alertmanagerURL, receiver string, groupLabels map[string]string) ([]*types.Alert, error) {
+	params := url.Values{}
+	params.Set("active", "true")
+	params.Set("silenced", "false")
+	params.Set("inhibited", "false")
+	if receiver != "" {
+		params.Set("receiver", regexp.QuoteMeta(receiver))
+	}
+
+	names := make([]string, 0, len(groupLabels))
+	for name := range groupLabels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		params.Add("filter", fmt.Sprintf("%s=%q", name, groupLabels[name]))
+	}
+
+	return c.listAlerts(alertmanagerURL + "/api/v2/alerts?" + params.Encode())
+}
+
+// PostableAlert is an alert sent to the Alertmanager API. Alertmanager resolves it at EndsAt,
+// or after its resolve_timeout when EndsAt is zero.
+type PostableAlert struct {
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+	StartsAt     time.Time         `json:"startsAt"`
+	EndsAt       time.Time         `json:"endsAt"`
+	GeneratorURL string            `json:"generatorURL,omitempty"`
+}
+
+// PostAlerts sends alerts to Alertmanager, as Prometheus does
+func (c *Client) PostAlerts(alertmanagerURL string, alerts []PostableAlert) error {
+	body, err := json.Marshal(alerts)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.httpRetry(http.MethodPost, alertmanagerURL+"/api/v2/alerts", body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("status code is %d: %s", resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
+
+func (c *Client) listAlerts(alertsURL string) ([]*types.Alert, error) {
+	resp, err := c.httpRetry(http.MethodGet, alertsURL, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,38 @@
+package alertmanager
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPostAlerts(t *testing.T) {
+	var received []PostableAlert
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "/api/v2/alerts", r.URL.Path)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil || len(received) == 0 {
+			http.Error(w, "invalid alerts", http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	startsAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	err := NewClient(nil).PostAlerts(server.URL, []PostableAlert{{Labels: map[string]string{"alertname": "Test"}, StartsAt: startsAt}})
+	require.NoError(t, err)
+	require.Len(t, received, 1)
+	assert.Equal(t, "Test", received[0].Labels["alertname"])
+	assert.True(t, received[0].StartsAt.Equal(startsAt))
+
+	start := time.Now()
+	err = NewClient(nil).PostAlerts(server.URL, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "400")
+	assert.Less(t, time.Since(start), time.Second, "bad requests are not retried")
+}
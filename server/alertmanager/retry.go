@@ -1,14 +1,50 @@
 package alertmanager
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/cenkalti/backoff"
 )
 
+// RequestObserver is called after every request to the Alertmanager API with the Alertmanager
+// base URL, the duration including retries and the resulting error.
+type RequestObserver func(alertmanagerURL string, duration time.Duration, err error)
+
+// Client sends the requests to the Alertmanager API. The zero value, and a nil Client, send them
+// without observer.
+type Client struct {
+	observer RequestObserver
+}
+
+// NewClient returns a client calling observer after every request, observer may be nil
+func NewClient(observer RequestObserver) *Client {
+	return &Client{observer: observer}
+}
+
+func (c *Client) observe(alertmanagerURL string, duration time.Duration, err error) {
+	if c == nil || c.observer == nil {
+		return
+	}
+	c.observer(BaseURL(alertmanagerURL), duration, err)
+}
+
+// BaseURL strips the API path and the credentials from an Alertmanager API URL
+func BaseURL(apiURL string) string {
+	base, _, _ := strings.Cut(apiURL, "/api/v2/")
+	if u, err := url.Parse(base); err == nil && u.User != nil {
+		u.User = nil
+		return u.String()
+	}
+	return base
+}
+
 func httpBackoff() *backoff.ExponentialBackOff {
 	b := backoff.NewExponentialBackOff()
 	b.InitialInterval = 200 * time.Millisecond
@@ -17,7 +53,8 @@ func httpBackoff() *backoff.ExponentialBackOff {
 	return b
 }
 
-func httpRetry(method string, url string) (*http.Response, error) {
+// httpRetry sends a request with an optional JSON body, retrying failures with an exponential backoff
+func (c *Client) httpRetry(method string, url string, body []byte) (*http.Response, error) {
 	var resp *http.Response
 	var err error
 
@@ -25,10 +62,17 @@ func httpRetry(method string, url string) (*http.Response, error) {
 	defer cancel()
 
 	fn := func() error {
-		req, errReq := http.NewRequest(method, url, nil)
+		var reqBody io.Reader
+		if body != nil {
+			reqBody = bytes.NewReader(body)
+		}
+		req, errReq := http.NewRequest(method, url, reqBody)
 		if errReq != nil {
 			return errReq
 		}
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
 
 		req = req.WithContext(ctx)
 		resp, err = http.DefaultClient.Do(req) // nolint: bodyclose
@@ -43,14 +87,18 @@ func httpRetry(method string, url string) (*http.Response, error) {
 			}
 		case http.MethodPost:
 			if resp.StatusCode == http.StatusBadRequest {
-				return fmt.Errorf("status code is %d not 3xx", resp.StatusCode)
+				// The request itself is wrong, sending it again does not help
+				return backoff.Permanent(fmt.Errorf("status code is %d not 3xx", resp.StatusCode))
 			}
 		}
 
 		return nil
 	}
 
-	if errRetry := backoff.Retry(fn, httpBackoff()); errRetry != nil {
+	start := time.Now()
+	errRetry := backoff.Retry(fn, httpBackoff())
+	c.observe(url, time.Since(start), errRetry)
+	if errRetry != nil {
 		return nil, errRetry
 	}
 
@@ -2,10 +2,14 @@ package alertmanager
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"time"
 )
 
+// probeTimeout bounds a health probe, probes are not retried
+const probeTimeout = 5 * time.Second
+
 // StatusResponse is the data returned by Alertmanager about its current status.
 type StatusResponse struct {
 	Uptime      time.Time `json:"uptime"`
@@ -17,13 +21,20 @@ type StatusResponse struct {
 		Revision  string `json:"revision"`
 		Version   string `json:"version"`
 	} `json:"versionInfo"`
+	Cluster struct {
+		Status string `json:"status"`
+		Peers  []struct {
+			Name    string `json:"name"`
+			Address string `json:"address"`
+		} `json:"peers"`
+	} `json:"cluster"`
 }
 
 // Status returns a StatusResponse or an error.
-func Status(alertmanagerURL string) (StatusResponse, error) {
+func (c *Client) Status(alertmanagerURL string) (StatusResponse, error) {
 	var statusResponse StatusResponse
 
-	resp, err := httpRetry(http.MethodGet, alertmanagerURL+"/api/v2/status")
+	resp, err := c.httpRetry(http.MethodGet, alertmanagerURL+"/api/v2/status", nil)
 	if err != nil {
 		return statusResponse, err
 	}
@@ -36,3 +47,20 @@ func Status(alertmanagerURL string) (StatusResponse, error) {
 
 	return statusResponse, nil
 }
+
+// Probe requests a health endpoint of Alertmanager once, like "/-/healthy" or "/-/ready", and
+// returns an error unless it answers 200
+func (c *Client) Probe(alertmanagerURL, path string) error {
+	client := &http.Client{Timeout: probeTimeout}
+
+	start := time.Now()
+	resp, err := client.Get(alertmanagerURL + path)
+	if err == nil {
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			err = fmt.Errorf("%s answered status code %d", path, resp.StatusCode)
+		}
+	}
+	c.observe(alertmanagerURL, time.Since(start), err)
+	return err
+}
@@ -7,6 +7,8 @@ import (
 	"io"
 	"net/http"
 	"time"
+
+	"github.com/Kuzyashin/mattermost-plugin-alertmanager/server/alertmanager"
 )
 
 // Silence represents an AlertManager silence
@@ -68,7 +70,7 @@ func (p *Plugin) createSilence(alertManagerURL string, labels map[string]interfa
 	}
 
 	p.API.LogDebug("[SILENCE] Creating silence in AlertManager",
-		"url", alertManagerURL,
+		"url", alertmanager.BaseURL(alertManagerURL),
 		"matchers", fmt.Sprintf("%+v", matchers),
 		"duration", duration.String(),
 	)
@@ -86,7 +88,13 @@ func (p *Plugin) createSilence(alertManagerURL string, labels map[string]interfa
 		Timeout: 10 * time.Second,
 	}
 
+	start := time.Now()
 	resp, err := client.Do(req)
+	requestErr := err
+	if err == nil && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		requestErr = fmt.Errorf("AlertManager returned status %d", resp.StatusCode)
+	}
+	p.metrics.observeAlertmanagerRequest(alertmanager.BaseURL(alertManagerURL), time.Since(start), requestErr)
 	if err != nil {
 		return "", fmt.Errorf("failed to send request to AlertManager: %w", err)
 	}
@@ -2,11 +2,12 @@ package main
 
 import (
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
+	"unicode"
 
-	"github.com/hako/durafmt"
 	"github.com/mattermost/mattermost/server/public/plugin"
 	"github.com/prometheus/alertmanager/types"
 
@@ -17,21 +18,14 @@ import (
 )
 
 const (
-	actionHelp   = "help"
-	actionAbout  = "about"
-	actionReload = "reload"
-	actionConfig = "config"
-
-	helpMsg = `run:
-	/alertmanager alerts - to list the existing alerts
-	/alertmanager silences - to list the existing silences
-	/alertmanager expire_silence - to expire a silence
-	/alertmanager status - to list the version and uptime of the Alertmanager instance
-	/alertmanager reload - reload channel configuration and mappings
-	/alertmanager config - display current channel mappings
-	/alertmanager help - display Slash Command help text
-	/alertmanager about - display build information
-	`
+	actionHelp     = "help"
+	actionAbout    = "about"
+	actionReload   = "reload"
+	actionConfig   = "config"
+	actionHistory  = "history"
+	actionStats    = "stats"
+	actionDoctor   = "doctor"
+	actionTemplate = "template"
 )
 
 func (p *Plugin) getCommand() (*model.Command, error) {
@@ -43,7 +37,7 @@ func (p *Plugin) getCommand() (*model.Command, error) {
 	return &model.Command{
 		Trigger:              "alertmanager",
 		AutoComplete:         true,
-		AutoCompleteDesc:     fmt.Sprintf("Available commands: status, alerts, silences, expire_silence, reload, config, %s, %s", actionHelp, actionAbout),
+		AutoCompleteDesc:     fmt.Sprintf("Available commands: status, alerts, silences, expire_silence, reload, config, history, stats, doctor, template, test, runbook, %s, %s", actionHelp, actionAbout),
 		AutoCompleteHint:     "[command]",
 		AutocompleteData:     getAutocompleteData(),
 		AutocompleteIconData: iconData,
@@ -51,7 +45,7 @@ func (p *Plugin) getCommand() (*model.Command, error) {
 }
 
 func getAutocompleteData() *model.AutocompleteData {
-	root := model.NewAutocompleteData("alertmanager", "[command]", fmt.Sprintf("Available commands: status, alerts, silences, expire_silence, reload, config, %s, %s", actionHelp, actionAbout))
+	root := model.NewAutocompleteData("alertmanager", "[command]", fmt.Sprintf("Available commands: status, alerts, silences, expire_silence, reload, config, history, stats, doctor, template, test, runbook, %s, %s", actionHelp, actionAbout))
 
 	alerts := model.NewAutocompleteData("alerts", "", "List the existing alerts")
 	root.AddCommand(alerts)
@@ -73,6 +67,60 @@ func getAutocompleteData() *model.AutocompleteData {
 	config := model.NewAutocompleteData(actionConfig, "", "Display current channel mappings")
 	root.AddCommand(config)
 
+	history := model.NewAutocompleteData(actionHistory, "<alertname|fingerprint|labels>", "Display the incident timeline of an alert")
+	history.AddTextArgument("Alert name, fingerprint or label matchers like severity=critical,instance=db1", "<alertname|fingerprint|labels>", "")
+	root.AddCommand(history)
+
+	stats := model.NewAutocompleteData(actionStats, "[config ID] [period] [csv]", "Display MTTA/MTTR and alert noise statistics")
+	stats.AddTextArgument("Optional alert configuration ID, period like 24h, 7d or 4w, and csv to export the incidents", "[config ID] [period] [csv]", "")
+	root.AddCommand(stats)
+
+	doctor := model.NewAutocompleteData(actionDoctor, "", "Check every configuration and explain how to fix problems")
+	root.AddCommand(doctor)
+
+	template := model.NewAutocompleteData(actionTemplate, "preview|list|show|history|set|delete|rollback", "Work with the alert templates and the template library")
+	templatePreview := model.NewAutocompleteData("preview", "[config ID]", "Preview the alert templates against the last received or a built-in sample alert")
+	templatePreview.AddTextArgument("Optional alert configuration ID", "[config ID]", "")
+	template.AddCommand(templatePreview)
+	templateList := model.NewAutocompleteData("list", "", "List the templates of the template library")
+	template.AddCommand(templateList)
+	templateShow := model.NewAutocompleteData("show", "<name> [version]", "Display a library template, its current version by default")
+	templateShow.AddTextArgument("Template name and optional version", "<name> [version]", "")
+	template.AddCommand(templateShow)
+	templateHistory := model.NewAutocompleteData("history", "<name>", "List the versions of a library template")
+	templateHistory.AddTextArgument("Template name", "<name>", "")
+	template.AddCommand(templateHistory)
+	templateSet := model.NewAutocompleteData("set", "<name> <template>", "Create or change a library template, system admins only")
+	templateSet.AddTextArgument("Template name and Go template, optionally in a code block", "<name> <template>", "")
+	template.AddCommand(templateSet)
+	templateDelete := model.NewAutocompleteData("delete", "<name>", "Delete a library template, system admins only")
+	templateDelete.AddTextArgument("Template name", "<name>", "")
+	template.AddCommand(templateDelete)
+	templateRollback := model.NewAutocompleteData("rollback", "<name> <version>", "Restore a previous version of a library template, system admins only")
+	templateRollback.AddTextArgument("Template name and version", "<name> <version>", "")
+	template.AddCommand(templateRollback)
+	root.AddCommand(template)
+
+	test := model.NewAutocompleteData(actionTest, "fire", "Test the delivery of alerts end to end")
+	testFire := model.NewAutocompleteData("fire", "<config ID> [labels] [--resolve-after 2m]", "Send a test alert to the AlertManager of a config and report where it lands, system admins only")
+	testFire.AddTextArgument("Alert configuration ID, optional labels like severity=warning,team=db and when to resolve the alert", "<config ID> [labels] [--resolve-after 2m]", "")
+	test.AddCommand(testFire)
+	root.AddCommand(test)
+
+	runbook := model.NewAutocompleteData(actionRunbook, "list|show|set|delete", "Manage the runbooks posted in the threads of alerts")
+	runbookList := model.NewAutocompleteData("list", "", "List the runbooks")
+	runbook.AddCommand(runbookList)
+	runbookShow := model.NewAutocompleteData("show", "<alertname|matchers>", "Display a runbook")
+	runbookShow.AddTextArgument("Alertname or label matchers of the runbook", "<alertname|matchers>", "")
+	runbook.AddCommand(runbookShow)
+	runbookSet := model.NewAutocompleteData("set", "<alertname|matchers> <markdown>", "Create or change a runbook, system admins only")
+	runbookSet.AddTextArgument("Alertname or label matchers like severity=\"critical\",team=\"db\", and the markdown of the runbook", "<alertname|matchers> <markdown>", "")
+	runbook.AddCommand(runbookSet)
+	runbookDelete := model.NewAutocompleteData("delete", "<alertname|matchers>", "Delete a runbook, system admins only")
+	runbookDelete.AddTextArgument("Alertname or label matchers of the runbook", "<alertname|matchers>", "")
+	runbook.AddCommand(runbookDelete)
+	root.AddCommand(runbook)
+
 	help := model.NewAutocompleteData(actionHelp, "", "Display Slash Command help text")
 	root.AddCommand(help)
 
@@ -113,49 +161,67 @@ func (p *Plugin) executeCommand(args *model.CommandArgs) string {
 		return ""
 	}
 
+	// Command replies are only seen by the invoking user, in their language
+	l := p.userLocalizer(args.UserId)
+
 	if action == "" {
-		return "Missing command, please run `/alertmanager help` to check all commands available."
+		return l.T("command.missing")
 	}
 
 	var msg string
 	var err error
 	switch action {
 	case "alerts":
-		msg, err = p.handleAlert(args)
+		msg, err = p.handleAlert(args, l)
 	case "status":
-		msg, err = p.handleStatus(args)
+		msg, err = p.handleStatus(args, l)
 	case "silences":
-		msg, err = p.handleListSilences(args)
+		msg, err = p.handleListSilences(args, l)
 	case "expire_silence":
-		msg, err = p.handleExpireSilence(args)
+		msg, err = p.handleExpireSilence(args, l)
 	case actionReload:
-		msg, err = p.handleReload(args)
+		msg, err = p.handleReload(args, l)
 	case actionConfig:
-		msg, err = p.handleConfig(args)
+		msg, err = p.handleConfig(args, l)
+	case actionHistory:
+		msg, err = p.handleHistory(args, l)
+	case actionStats:
+		msg, err = p.handleStats(args, l)
+	case actionDoctor:
+		msg, err = p.handleDoctor(args, l)
+	case actionTemplate:
+		msg, err = p.handleTemplate(args, l)
+	case actionTest:
+		msg, err = p.handleTest(args, l)
+	case actionRunbook:
+		msg, err = p.handleRunbook(args, l)
 	case actionAbout:
 		msg, err = command.BuildInfo(Manifest)
 	case actionHelp:
-		msg = helpMsg
+		msg = l.T("command.help")
 	default:
-		msg = helpMsg
+		msg = l.T("command.help")
 	}
 
 	if err != nil {
-		return err.Error()
+		return l.T("command.failed", err)
 	}
 
 	return msg
 }
 
-func (p *Plugin) handleAlert(args *model.CommandArgs) (string, error) {
+func (p *Plugin) handleAlert(args *model.CommandArgs, l localizer) (string, error) {
 	configuration := p.getConfiguration()
 	var alertsCount = 0
 	var errors []string
 
 	for _, alertConfig := range configuration.AlertConfigs {
-		alerts, err := alertmanager.ListAlerts(alertConfig.AlertManagerURL)
+		if !alertConfig.hasAlertmanager() {
+			continue
+		}
+		alerts, err := p.amClient.ListAlerts(alertConfig.alertmanagerAPIURL())
 		if err != nil {
-			errors = append(errors, fmt.Sprintf("AlertManagerURL %q: failed to list alerts... %v", alertConfig.AlertManagerURL, err))
+			errors = append(errors, l.T("command.alerts.failed", alertConfig.AlertManagerURL, err))
 			continue
 		}
 		if len(alerts) == 0 {
@@ -163,21 +229,23 @@ func (p *Plugin) handleAlert(args *model.CommandArgs) (string, error) {
 		}
 		alertsCount += len(alerts)
 
+		// The alerts are posted in the config channel, in the language of the config
+		cl := configLocalizer(alertConfig)
 		attachments := make([]*model.SlackAttachment, 0)
 		for _, alert := range alerts {
 			var fields []*model.SlackAttachmentField
-			fields = addFields(fields, "Status", string(alert.Status()), false)
+			fields = addFields(fields, cl.T("alerts.status"), string(alert.Status()), false)
 			for k, v := range alert.Annotations {
 				fields = addFields(fields, string(k), string(v), true)
 			}
 			for k, v := range alert.Labels {
 				fields = addFields(fields, string(k), string(v), true)
 			}
-			fields = addFields(fields, "Resolved", strconv.FormatBool(alert.Resolved()), false)
-			fields = addFields(fields, "Start At", alert.StartsAt.String(), true)
-			fields = addFields(fields, "Ended At", alert.EndsAt.String(), true)
+			fields = addFields(fields, cl.T("alerts.resolved"), strconv.FormatBool(alert.Resolved()), false)
+			fields = addFields(fields, cl.T("alerts.starts_at"), alert.StartsAt.String(), true)
+			fields = addFields(fields, cl.T("alerts.ends_at"), alert.EndsAt.String(), true)
 			attachment := &model.SlackAttachment{
-				Title:  fmt.Sprintf("Alert Name: %s", alert.Name()),
+				Title:  cl.T("alerts.title", alert.Name()),
 				Fields: fields,
 				Color:  setColor(string(alert.Status())),
 			}
@@ -185,14 +253,14 @@ func (p *Plugin) handleAlert(args *model.CommandArgs) (string, error) {
 		}
 
 		post := &model.Post{
-			ChannelId: p.AlertConfigIDChannelID[alertConfig.ID],
+			ChannelId: p.getChannelID(alertConfig.ID),
 			UserId:    p.BotUserID,
 			RootId:    args.RootId,
 		}
 
 		model.ParseSlackAttachment(post, attachments)
 		if _, appErr := p.API.CreatePost(post); appErr != nil {
-			errors = append(errors, fmt.Sprintf("Channel %q: Error creating the Alert post", alertConfig.Channel))
+			errors = append(errors, l.T("command.alerts.post_failed", alertConfig.Channel))
 			continue
 		}
 	}
@@ -202,41 +270,44 @@ func (p *Plugin) handleAlert(args *model.CommandArgs) (string, error) {
 	}
 
 	if alertsCount == 0 {
-		return "No alerts right now! :tada:", nil
+		return l.T("command.alerts.none"), nil
 	}
 
 	return "", nil
 }
 
-func (p *Plugin) handleStatus(args *model.CommandArgs) (string, error) {
+func (p *Plugin) handleStatus(args *model.CommandArgs, l localizer) (string, error) {
 	configuration := p.getConfiguration()
 
 	var errors []string
 	for _, alertConfig := range configuration.AlertConfigs {
-		status, err := alertmanager.Status(alertConfig.AlertManagerURL)
+		if !alertConfig.hasAlertmanager() {
+			continue
+		}
+		status, err := p.amClient.Status(alertConfig.alertmanagerAPIURL())
 		if err != nil {
-			errors = append(errors, fmt.Sprintf("AlertManagerURL %q: failed to get status... %v", alertConfig.AlertManagerURL, err))
+			errors = append(errors, l.T("command.status.failed", alertConfig.AlertManagerURL, err))
 			continue
 		}
 
-		uptime := durafmt.Parse(time.Since(status.Uptime)).String()
+		cl := configLocalizer(alertConfig)
 		var fields []*model.SlackAttachmentField
-		fields = addFields(fields, "AlertManager Version ", status.VersionInfo.Version, false)
-		fields = addFields(fields, "AlertManager Uptime", uptime, false)
+		fields = addFields(fields, cl.T("status.version"), status.VersionInfo.Version, false)
+		fields = addFields(fields, cl.T("status.uptime"), cl.Duration(time.Since(status.Uptime)), false)
 
 		attachment := &model.SlackAttachment{
 			Fields: fields,
 		}
 
 		post := &model.Post{
-			ChannelId: p.AlertConfigIDChannelID[alertConfig.ID],
+			ChannelId: p.getChannelID(alertConfig.ID),
 			UserId:    p.BotUserID,
 			RootId:    args.RootId,
 		}
 
 		model.ParseSlackAttachment(post, []*model.SlackAttachment{attachment})
 		if _, appErr := p.API.CreatePost(post); appErr != nil {
-			errors = append(errors, fmt.Sprintf("Channel %q: Error creating the Status post", alertConfig.Channel))
+			errors = append(errors, l.T("command.status.post_failed", alertConfig.Channel))
 			continue
 		}
 	}
@@ -246,13 +317,13 @@ func (p *Plugin) handleStatus(args *model.CommandArgs) (string, error) {
 	}
 
 	if len(configuration.AlertConfigs) == 0 {
-		return "No alert managers are configured!", nil
+		return l.T("command.no_configs"), nil
 	}
 
 	return "", nil
 }
 
-func (p *Plugin) handleListSilences(args *model.CommandArgs) (string, error) {
+func (p *Plugin) handleListSilences(args *model.CommandArgs, l localizer) (string, error) {
 	configuration := p.getConfiguration()
 	var errors []string
 	var silencesCount = 0
@@ -262,9 +333,12 @@ func (p *Plugin) handleListSilences(args *model.CommandArgs) (string, error) {
 	siteURLPort := *config.ServiceSettings.ListenAddress
 
 	for _, alertConfig := range configuration.AlertConfigs {
-		silences, err := alertmanager.ListSilences(alertConfig.AlertManagerURL)
+		if !alertConfig.hasAlertmanager() {
+			continue
+		}
+		silences, err := p.amClient.ListSilences(alertConfig.alertmanagerAPIURL())
 		if err != nil {
-			errors = append(errors, fmt.Sprintf("AlertManagerURL %q: failed to get silences... %v", alertConfig.AlertManagerURL, err))
+			errors = append(errors, l.T("command.silences.failed", alertConfig.AlertManagerURL, err))
 			continue
 		}
 		if len(silences) == 0 {
@@ -286,24 +360,24 @@ func (p *Plugin) handleListSilences(args *model.CommandArgs) (string, error) {
 		pendingSilencesCount += len(attachments)
 
 		post := &model.Post{
-			ChannelId: p.AlertConfigIDChannelID[alertConfig.ID],
+			ChannelId: p.getChannelID(alertConfig.ID),
 			UserId:    p.BotUserID,
 			RootId:    args.RootId,
 		}
 
 		model.ParseSlackAttachment(post, attachments)
 		if _, appErr := p.API.CreatePost(post); appErr != nil {
-			errors = append(errors, fmt.Sprintf("Channel %q: Error creating the Alert post", alertConfig.Channel))
+			errors = append(errors, l.T("command.silences.post_failed", alertConfig.Channel))
 			continue
 		}
 	}
 
 	if silencesCount == 0 {
-		return "No silences right now.", nil
+		return l.T("command.silences.none"), nil
 	}
 
 	if pendingSilencesCount == 0 {
-		return "No active or pending silences right now.", nil
+		return l.T("command.silences.none_pending"), nil
 	}
 
 	if len(errors) > 0 {
@@ -313,7 +387,7 @@ func (p *Plugin) handleListSilences(args *model.CommandArgs) (string, error) {
 	return "", nil
 }
 
-func (p *Plugin) handleExpireSilence(args *model.CommandArgs) (string, error) {
+func (p *Plugin) handleExpireSilence(args *model.CommandArgs, l localizer) (string, error) {
 	split := strings.Fields(args.Command)
 	var parameters []string
 	if len(split) > 2 {
@@ -321,57 +395,59 @@ func (p *Plugin) handleExpireSilence(args *model.CommandArgs) (string, error) {
 	}
 
 	if len(parameters) != 2 {
-		return "Command requires 2 parameters: alert configuration number and silence ID", nil
+		return l.T("command.expire_silence.usage"), nil
 	}
 
 	configuration := p.getConfiguration()
 
 	if config, ok := configuration.AlertConfigs[parameters[0]]; ok {
-		err := alertmanager.ExpireSilence(parameters[1], config.AlertManagerURL)
+		if !config.hasAlertmanager() {
+			return l.T("command.expire_silence.no_alertmanager", parameters[0], config.Source), nil
+		}
+		err := p.amClient.ExpireSilence(parameters[1], config.alertmanagerAPIURL())
 		if err != nil {
 			return "", fmt.Errorf("failed to expire the silence: %w", err)
 		}
 	} else {
-		return fmt.Sprintf("Alert configuration %s not found", parameters[0]), nil
+		return l.T("command.expire_silence.unknown_config", parameters[0]), nil
 	}
 
-	return fmt.Sprintf("Silence %s expired.", parameters[1]), nil
+	return l.T("command.expire_silence.done", parameters[1]), nil
 }
 
 func ConvertSilenceToSlackAttachment(silence types.Silence, config alertConfig, userID, siteURLPort string) *model.SlackAttachment {
 	if string(silence.Status.State) == "expired" {
 		return nil
 	}
+	l := configLocalizer(config)
 	var fields []*model.SlackAttachmentField
 	var emoji, matchers, duration string
 	for _, m := range silence.Matchers {
 		if m.Name == "alertname" {
-			fields = addFields(fields, "Alert Name", m.Value, false)
+			fields = addFields(fields, l.T("silences.alertname"), m.Value, false)
 		} else {
 			matchers += fmt.Sprintf(`%s="%s"`, m.Name, m.Value)
 		}
 	}
-	fields = addFields(fields, "State", string(silence.Status.State), true)
-	fields = addFields(fields, "Matchers", matchers, false)
+	fields = addFields(fields, l.T("silences.state"), string(silence.Status.State), true)
+	fields = addFields(fields, l.T("silences.matchers"), matchers, false)
 	resolved := alertmanager.Resolved(silence)
 	if !resolved {
 		emoji = "🔕"
-		duration = fmt.Sprintf(
-			"**Started**: %s ago\n**Ends:** %s\n",
-			durafmt.Parse(time.Since(silence.StartsAt)),
-			durafmt.Parse(time.Since(silence.EndsAt)),
+		duration = l.T("silences.active",
+			l.Duration(time.Since(silence.StartsAt)),
+			l.Duration(time.Until(silence.EndsAt)),
 		)
 		fields = addFields(fields, emoji, duration, false)
 	} else {
-		duration = fmt.Sprintf(
-			"**Ended**: %s ago\n**Duration**: %s",
-			durafmt.Parse(time.Since(silence.EndsAt)),
-			durafmt.Parse(silence.EndsAt.Sub(silence.StartsAt)),
+		duration = l.T("silences.ended",
+			l.Duration(time.Since(silence.EndsAt)),
+			l.Duration(silence.EndsAt.Sub(silence.StartsAt)),
 		)
 		fields = addFields(fields, "", duration, false)
 	}
-	fields = addFields(fields, "Comments", silence.Comment, false)
-	fields = addFields(fields, "Created by", silence.CreatedBy, true)
+	fields = addFields(fields, l.T("silences.comments"), silence.Comment, false)
+	fields = addFields(fields, l.T("silences.created_by"), silence.CreatedBy, true)
 
 	color := colorResolved
 	if string(silence.Status.State) == "active" {
@@ -379,7 +455,7 @@ func ConvertSilenceToSlackAttachment(silence types.Silence, config alertConfig,
 	}
 
 	expireSilenceAction := &model.PostAction{
-		Name: "Expire Silence",
+		Name: l.T("silences.expire"),
 		Type: model.PostActionTypeButton,
 		Integration: &model.PostActionIntegration{
 			Context: map[string]interface{}{
@@ -391,7 +467,7 @@ func ConvertSilenceToSlackAttachment(silence types.Silence, config alertConfig,
 		},
 	}
 	attachment := &model.SlackAttachment{
-		Title:  fmt.Sprintf("Silence ID: %s", silence.ID),
+		Title:  l.T("silences.title", silence.ID),
 		Fields: fields,
 		Color:  color,
 		Actions: []*model.PostAction{
@@ -402,7 +478,7 @@ func ConvertSilenceToSlackAttachment(silence types.Silence, config alertConfig,
 	return attachment
 }
 
-func (p *Plugin) handleReload(_ *model.CommandArgs) (string, error) {
+func (p *Plugin) handleReload(_ *model.CommandArgs, l localizer) (string, error) {
 	p.API.LogInfo("Reloading channel mappings via command")
 
 	err := p.reloadChannelMappings()
@@ -410,22 +486,27 @@ func (p *Plugin) handleReload(_ *model.CommandArgs) (string, error) {
 		return "", fmt.Errorf("failed to reload channel mappings: %w", err)
 	}
 
-	return "✅ Channel mappings reloaded successfully!", nil
+	if err := p.publishReload(); err != nil {
+		p.API.LogError("Failed to ask the other nodes to reload channel mappings", "error", err.Error())
+		return l.T("command.reload.partial"), nil
+	}
+
+	return l.T("command.reload.done"), nil
 }
 
-func (p *Plugin) handleConfig(args *model.CommandArgs) (string, error) {
+func (p *Plugin) handleConfig(args *model.CommandArgs, l localizer) (string, error) {
 	p.API.LogInfo("Displaying current configuration via command")
 
 	configuration := p.getConfiguration()
 
 	var fields []*model.SlackAttachmentField
-	fields = addFields(fields, "Total Configurations", fmt.Sprintf("%d", len(configuration.AlertConfigs)), false)
+	fields = addFields(fields, l.T("config.total"), fmt.Sprintf("%d", len(configuration.AlertConfigs)), false)
 
 	for id, alertConfig := range configuration.AlertConfigs {
-		channelID := p.AlertConfigIDChannelID[alertConfig.ID]
+		channelID := p.getChannelID(alertConfig.ID)
 
 		// Get channel name
-		channelName := "unknown"
+		channelName := l.T("config.unknown_channel")
 		if channelID != "" {
 			channel, err := p.API.GetChannel(channelID)
 			if err == nil {
@@ -433,8 +514,7 @@ func (p *Plugin) handleConfig(args *model.CommandArgs) (string, error) {
 			}
 		}
 
-		configInfo := fmt.Sprintf(
-			"**Team:** %s\n**Channel:** %s (ID: %s)\n**AlertManager URL:** %s\n**Token:** %s...%s",
+		configInfo := l.T("config.info",
 			alertConfig.Team,
 			channelName,
 			channelID,
@@ -443,11 +523,11 @@ func (p *Plugin) handleConfig(args *model.CommandArgs) (string, error) {
 			alertConfig.Token[len(alertConfig.Token)-8:],
 		)
 
-		fields = addFields(fields, fmt.Sprintf("Config #%s", id), configInfo, false)
+		fields = addFields(fields, l.T("config.field", id), configInfo, false)
 	}
 
 	attachment := &model.SlackAttachment{
-		Title:  "📋 Current AlertManager Configuration",
+		Title:  l.T("config.title"),
 		Fields: fields,
 		Color:  "#0066cc",
 	}
@@ -465,3 +545,385 @@ func (p *Plugin) handleConfig(args *model.CommandArgs) (string, error) {
 
 	return "", nil
 }
+
+func (p *Plugin) handleHistory(args *model.CommandArgs, l localizer) (string, error) {
+	split := strings.Fields(args.Command)
+	if len(split) < 3 {
+		return l.T("command.history.usage"), nil
+	}
+
+	query, err := parseHistoryQuery(strings.Join(split[2:], " "))
+	if err != nil {
+		return l.T("command.history.invalid", err), nil
+	}
+
+	histories, err := p.findAlertHistories(query)
+	if err != nil {
+		return "", fmt.Errorf("failed to load alert history: %w", err)
+	}
+	if len(histories) == 0 {
+		return l.T("command.history.none"), nil
+	}
+
+	configuration := p.getConfiguration()
+	loc := p.userLocation(args.UserId)
+	attachments := make([]*model.SlackAttachment, 0, historyMaxResults)
+	for i, history := range histories {
+		if i == historyMaxResults {
+			break
+		}
+		alertConfig := configuration.AlertConfigs[history.ConfigID]
+		attachments = append(attachments, buildHistoryAttachment(history, l, loc, func(postID string) string {
+			return p.getPermalink(alertConfig, postID)
+		}))
+	}
+
+	post := &model.Post{
+		ChannelId: args.ChannelId,
+		UserId:    p.BotUserID,
+		RootId:    args.RootId,
+	}
+	if len(histories) > historyMaxResults {
+		post.Message = l.T("command.history.truncated", historyMaxResults, len(histories))
+	}
+
+	model.ParseSlackAttachment(post, attachments)
+	_ = p.API.SendEphemeralPost(args.UserId, post)
+
+	return "", nil
+}
+
+func (p *Plugin) handleStats(args *model.CommandArgs, l localizer) (string, error) {
+	split := strings.Fields(args.Command)
+
+	// System admins see every config, other users the configs posting to the current channel
+	configs := p.getConfiguration().AlertConfigs
+	admin := p.API.HasPermissionTo(args.UserId, model.PermissionManageSystem)
+	if !admin {
+		channelConfigs := make(map[string]alertConfig)
+		for id, alertConfig := range configs {
+			if p.getChannelID(id) == args.ChannelId {
+				channelConfigs[id] = alertConfig
+			}
+		}
+		if len(channelConfigs) == 0 {
+			return l.T("command.stats.no_configs"), nil
+		}
+		configs = channelConfigs
+	}
+
+	configID := ""
+	period := defaultStatsPeriod
+	exportCSV := false
+	for _, param := range split[2:] {
+		if _, ok := configs[param]; ok {
+			configID = param
+			continue
+		}
+		if strings.EqualFold(param, "csv") {
+			exportCSV = true
+			continue
+		}
+		parsed, err := parseStatsPeriod(param)
+		if err != nil {
+			return l.T("command.stats.invalid", param), nil
+		}
+		period = parsed
+	}
+
+	scope := l.T("stats.scope_all")
+	if !admin {
+		scope = l.T("stats.scope_channel")
+	}
+	if configID != "" {
+		configs = map[string]alertConfig{configID: configs[configID]}
+		scope = l.T("stats.scope_config", configID)
+	}
+
+	histories, err := p.findAlertHistories(historyQuery{})
+	if err != nil {
+		return "", fmt.Errorf("failed to load alert history: %w", err)
+	}
+
+	loc := statsLocation(configs)
+	until := time.Now().UTC()
+	if loc != nil {
+		until = until.In(loc)
+	}
+	since := until.Add(-period)
+	stats := computeAlertStats(extractIncidents(histories, configs, since, until), since, until)
+	stats.Location = loc
+
+	post := &model.Post{
+		ChannelId: args.ChannelId,
+		UserId:    p.BotUserID,
+		RootId:    args.RootId,
+	}
+
+	if exportCSV {
+		data, err := statsCSV(stats)
+		if err != nil {
+			return "", fmt.Errorf("failed to export stats: %w", err)
+		}
+		if err := p.sendStatsCSV(args.UserId, data, since, until, l, scope); err != nil {
+			return "", err
+		}
+		post.Message = l.T("command.stats.csv_sent")
+	}
+
+	// The report is only shown to the user, it covers configs of other channels for system admins
+	model.ParseSlackAttachment(post, []*model.SlackAttachment{buildStatsAttachment(stats, l, scope)})
+	_ = p.API.SendEphemeralPost(args.UserId, post)
+
+	return "", nil
+}
+
+// sendStatsCSV sends the CSV export of the stats to the user in a direct message of the bot, an
+// ephemeral post cannot carry files
+func (p *Plugin) sendStatsCSV(userID string, data []byte, since, until time.Time, l localizer, scope string) error {
+	channel, appErr := p.API.GetDirectChannel(userID, p.BotUserID)
+	if appErr != nil {
+		return fmt.Errorf("failed to get the direct channel for the stats export: %w", appErr)
+	}
+
+	filename := fmt.Sprintf("alert-stats-%s-%s.csv", since.Format("20060102"), until.Format("20060102"))
+	fileInfo, appErr := p.API.UploadFile(data, channel.Id, filename)
+	if appErr != nil {
+		return fmt.Errorf("failed to upload stats export: %w", appErr)
+	}
+
+	post := &model.Post{
+		ChannelId: channel.Id,
+		UserId:    p.BotUserID,
+		Message:   l.T("stats.title", scope),
+		FileIds:   model.StringArray{fileInfo.Id},
+	}
+	if _, appErr := p.API.CreatePost(post); appErr != nil {
+		return fmt.Errorf("failed to create stats export post: %w", appErr)
+	}
+	return nil
+}
+
+func (p *Plugin) handleDoctor(args *model.CommandArgs, l localizer) (string, error) {
+	// The report lists the AlertManager URLs and token details of every config
+	if !p.API.HasPermissionTo(args.UserId, model.PermissionManageSystem) {
+		return l.T("command.doctor.forbidden"), nil
+	}
+
+	results := p.runDiagnostics(l)
+	if len(results) == 0 {
+		return l.T("command.no_configs"), nil
+	}
+
+	attachments := make([]*model.SlackAttachment, 0, len(results))
+	for _, diagnostics := range results {
+		attachments = append(attachments, buildDiagnosticsAttachment(diagnostics, l))
+	}
+
+	post := &model.Post{
+		ChannelId: args.ChannelId,
+		UserId:    p.BotUserID,
+		RootId:    args.RootId,
+	}
+	model.ParseSlackAttachment(post, attachments)
+	_ = p.API.SendEphemeralPost(args.UserId, post)
+
+	return "", nil
+}
+
+func (p *Plugin) handleTemplate(args *model.CommandArgs, l localizer) (string, error) {
+	split := strings.Fields(args.Command)
+	if len(split) < 3 {
+		return l.T("command.template.usage"), nil
+	}
+
+	switch split[2] {
+	case "preview":
+		return p.handleTemplatePreviewCommand(args, l)
+	case "list":
+		return p.handleTemplateList(args, l)
+	case "show", "history":
+		if len(split) < 4 {
+			return l.T("command.template.usage"), nil
+		}
+		return p.handleTemplateShow(args, l, split[2], split[3], split[4:])
+	case "set", "delete", "rollback":
+		if len(split) < 4 {
+			return l.T("command.template.usage"), nil
+		}
+		if !p.API.HasPermissionTo(args.UserId, model.PermissionManageSystem) {
+			return l.T("command.template.forbidden"), nil
+		}
+		return p.handleTemplateChange(args, l, split[2], split[3], split[4:])
+	default:
+		return l.T("command.template.usage"), nil
+	}
+}
+
+func (p *Plugin) handleTemplateList(args *model.CommandArgs, l localizer) (string, error) {
+	lib, err := p.getTemplateLibrary()
+	if err != nil {
+		return "", err
+	}
+	names := lib.names()
+	if len(names) == 0 {
+		return l.T("command.template.library_empty"), nil
+	}
+
+	loc := p.userLocation(args.UserId)
+	lines := []string{l.T("command.template.library_title")}
+	for _, name := range names {
+		current, _ := lib.current(name)
+		lines = append(lines, l.T("command.template.library_entry", name, formatTemplateVersion(current, l, loc)))
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// handleTemplateShow displays the current or a given version of a library template, or its versions
+func (p *Plugin) handleTemplateShow(args *model.CommandArgs, l localizer, subcommand, name string, rest []string) (string, error) {
+	lib, err := p.getTemplateLibrary()
+	if err != nil {
+		return "", err
+	}
+	if len(lib.Templates[name]) == 0 {
+		return l.T("command.template.not_found", name), nil
+	}
+	loc := p.userLocation(args.UserId)
+
+	if subcommand == "history" {
+		current, _ := lib.current(name)
+		lines := []string{l.T("command.template.versions_title", name)}
+		for i := len(lib.Templates[name]) - 1; i >= 0; i-- {
+			version := lib.Templates[name][i]
+			line := "- " + formatTemplateVersion(version, l, loc)
+			if version.Version == current.Version {
+				line += l.T("command.template.current")
+			}
+			lines = append(lines, line)
+		}
+		return strings.Join(lines, "\n"), nil
+	}
+
+	version, ok := lib.current(name)
+	if len(rest) > 0 {
+		number, err := strconv.Atoi(rest[0])
+		if err != nil {
+			return l.T("command.template.usage"), nil
+		}
+		version, ok = lib.version(name, number)
+	}
+	if !ok {
+		return l.T("command.template.version_not_found", name), nil
+	}
+	return l.T("command.template.show", name, formatTemplateVersion(version, l, loc), version.Body), nil
+}
+
+// handleTemplateChange sets, deletes or rolls back a library template
+func (p *Plugin) handleTemplateChange(args *model.CommandArgs, l localizer, subcommand, name string, rest []string) (string, error) {
+	author := args.UserId
+	if user, appErr := p.API.GetUser(args.UserId); appErr == nil {
+		author = user.Username
+	}
+
+	switch subcommand {
+	case "set":
+		body := templateCommandBody(args.Command)
+		if body == "" {
+			return l.T("command.template.usage"), nil
+		}
+		version, err := p.setTemplate(name, body, author)
+		if err != nil {
+			return "", err
+		}
+		return l.T("command.template.saved", name, version.Version), nil
+	case "delete":
+		version, err := p.deleteTemplate(name, author)
+		if err != nil {
+			return "", err
+		}
+		return l.T("command.template.deleted", name, version.Version), nil
+	default:
+		if len(rest) == 0 {
+			return l.T("command.template.usage"), nil
+		}
+		number, err := strconv.Atoi(rest[0])
+		if err != nil {
+			return l.T("command.template.usage"), nil
+		}
+		version, err := p.rollbackTemplate(name, number, author)
+		if err != nil {
+			return "", err
+		}
+		return l.T("command.template.rolled_back", name, number, version.Version), nil
+	}
+}
+
+// templateCommandBody returns the template of a "/alertmanager template set <name> <template>"
+// command with its line breaks, without the code block it may be wrapped in
+func templateCommandBody(command string) string {
+	return commandBody(skipCommandFields(command, 4))
+}
+
+// skipCommandFields returns the command after its first n words, with its line breaks
+func skipCommandFields(command string, n int) string {
+	rest := command
+	for i := 0; i < n; i++ {
+		rest = strings.TrimLeftFunc(rest, unicode.IsSpace)
+		end := strings.IndexFunc(rest, unicode.IsSpace)
+		if end < 0 {
+			return ""
+		}
+		rest = rest[end:]
+	}
+	return strings.TrimSpace(rest)
+}
+
+// commandBody removes a code block wrapping all of the body of a command
+func commandBody(body string) string {
+	if strings.HasPrefix(body, "```") && strings.HasSuffix(body, "```") && len(body) > 6 {
+		body = strings.TrimSuffix(body, "```")
+		if newline := strings.Index(body, "\n"); newline >= 0 {
+			body = body[newline+1:]
+		} else {
+			body = strings.TrimPrefix(body, "```")
+		}
+		body = strings.TrimSpace(body)
+	}
+	return body
+}
+
+func (p *Plugin) handleTemplatePreviewCommand(args *model.CommandArgs, l localizer) (string, error) {
+	split := strings.Fields(args.Command)
+
+	configs := p.getConfiguration().AlertConfigs
+	var ids []string
+	if len(split) > 3 {
+		if _, ok := configs[split[3]]; !ok {
+			return l.T("command.template.unknown_config", split[3]), nil
+		}
+		ids = []string{split[3]}
+	} else {
+		for id := range configs {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+	}
+	if len(ids) == 0 {
+		return l.T("command.no_configs"), nil
+	}
+
+	attachments := make([]*model.SlackAttachment, 0, len(ids))
+	for _, id := range ids {
+		attachments = append(attachments, p.buildPreviewAttachment(configs[id], l))
+	}
+
+	post := &model.Post{
+		ChannelId: args.ChannelId,
+		UserId:    p.BotUserID,
+		RootId:    args.RootId,
+	}
+	model.ParseSlackAttachment(post, attachments)
+	_ = p.API.SendEphemeralPost(args.UserId, post)
+
+	return "", nil
+}
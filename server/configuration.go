@@ -4,8 +4,22 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"reflect"
+	"maps"
+	"net/url"
+	"regexp"
+	"slices"
+	"sort"
 	"strings"
+	"time"
+
+	alerttemplate "github.com/prometheus/alertmanager/template"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+var (
+	colorRegexp   = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+	mentionRegexp = regexp.MustCompile(`^@[a-zA-Z0-9._-]+$`)
 )
 
 // configuration captures the plugin's external configuration as exposed in the Mattermost server
@@ -24,17 +38,36 @@ type configuration struct {
 }
 
 type alertConfig struct {
-	SeverityMentions SeverityMentionsMap // e.g. {"critical": "@devops-oncall", "warning": "@devops"}
-	StateColors      StateColorMap       // e.g. {"firing": "#FF0000", "acked": "#FFAA00", "resolved": "#008000"}
-	SeverityColors   SeverityColorMap    // e.g. {"critical": "#FF0000", "warning": "#FFA500", "info": "#0080FF"}
-	ID               string
-	Token            string
-	Channel          string
-	Team             string
-	AlertManagerURL  string
-	FiringTemplate   string // Custom template for firing alerts
-	ResolvedTemplate string // Custom template for resolved alerts
-	EnableActions    bool   // Enable Silence/ACK/UNACK buttons
+	SeverityMentions     SeverityMentionsMap // e.g. {"critical": "@devops-oncall", "warning": "@devops"}
+	StateColors          StateColorMap       // e.g. {"firing": "#FF0000", "acked": "#FFAA00", "resolved": "#008000"}
+	SeverityColors       SeverityColorMap    // e.g. {"critical": "#FF0000", "warning": "#FFA500", "info": "#0080FF"}
+	ID                   string
+	Token                string
+	Channel              string
+	Team                 string
+	AlertManagerURL      string
+	Source               string         // Webhook payload source, "alertmanager", "grafana" or "mapping", Alertmanager or Grafana detected when empty
+	GrafanaToken         string         // Grafana service account token of the Grafana Alertmanager API, for the "grafana" source
+	FieldMapping         FieldMapping   // Alert fields of the JSON payloads of the "mapping" source
+	FiringTemplate       string         // Custom template for firing alerts
+	ResolvedTemplate     string         // Custom template for resolved alerts
+	TemplateRules        TemplateRules  // Templates selected by labels or receiver, before the templates above
+	Links                AlertLinks     // Links of the alert posts, rendered from templates, e.g. runbooks and dashboards
+	ExternalURL          string         // Alertmanager UI of the links of the posts, e.g. Karma, defaults to the external URL of the notifications
+	UILinks              string         // Built-in links of the alerts in the UI at the external URL, "alertmanager" or "karma" routes, empty leaves them out
+	ThreadReplies        ThreadReplyMap // e.g. {"acked": {"Template": "..."}, "unacked": {"Disabled": true}}
+	StormThreshold       int            // Alerts per channel per minute above which a storm summary replaces individual posts, 0 disables
+	HistoryRetentionDays int            // Days alert timelines are kept, defaults to 30
+	DigestSchedule       string         // Cron expression of the digest posts, e.g. "0 9 * * 1-5", empty disables
+	DigestTimezone       string         // IANA timezone of DigestSchedule, e.g. "Europe/Berlin", defaults to Timezone
+	Timezone             string         // IANA timezone of the times in alert posts, e.g. "Europe/Berlin", defaults to UTC
+	Language             string         // Language of the channel posts, e.g. "de", defaults to English
+	HeartbeatMatchers    string         // Label matchers of the always-firing heartbeat alert, e.g. `alertname="Watchdog"`, empty disables the dead man's switch
+	HeartbeatInterval    string         // Expected repeat interval of the heartbeat alert, e.g. "5m"
+	HeartbeatGrace       string         // Delay past HeartbeatInterval before the pipeline is reported broken, defaults to HeartbeatInterval
+	HealthChannel        string         // Channel of the AlertManager health notifications in the team, defaults to Channel
+	EnableActions        bool           // Enable Silence/ACK/UNACK buttons
+	HealthCheck          bool           // Check the AlertManager every minute, post when it goes down, loses cluster peers or changes version
 }
 
 // SeverityMentionsMap is a custom type that handles both string (JSON) and map unmarshaling
@@ -149,64 +182,328 @@ func (ac *alertConfig) IsValid() error {
 		return errors.New("must set a Token")
 	}
 
-	if ac.AlertManagerURL == "" {
+	if ac.AlertManagerURL == "" && ac.hasAlertmanager() {
 		return errors.New("must set the AlertManager URL")
 	}
 
 	return nil
 }
 
-// Clone shallow copies the configuration. Your implementation may require a deep copy if
-// your configuration has reference types.
-func (c *configuration) Clone() *configuration {
-	var clone configuration
-	for k, v := range c.AlertConfigs {
-		clone.AlertConfigs[k] = v
+// sampleTemplateData is the alert custom templates are trial-rendered against on save
+func sampleTemplateData() alertTemplateData {
+	now := time.Now()
+	labels := alerttemplate.KV{"alertname": "SampleAlert", "severity": "critical", "instance": "host:9100", "job": "node"}
+	alert := alerttemplate.Alert{
+		Status:       "firing",
+		Labels:       labels,
+		Annotations:  alerttemplate.KV{"summary": "Sample summary", "description": "Sample description"},
+		StartsAt:     now.Add(-time.Hour),
+		EndsAt:       now,
+		GeneratorURL: "http://prometheus.example.com/graph",
+		Fingerprint:  "0123456789abcdef",
 	}
-	return &clone
+	data := newAlertTemplateData(alert, alertNotification{
+		Alerts:            alerttemplate.Alerts{alert},
+		GroupLabels:       alerttemplate.KV{"alertname": "SampleAlert"},
+		CommonLabels:      labels,
+		CommonAnnotations: alerttemplate.KV{},
+		Receiver:          "mattermost",
+		Status:            "firing",
+		ExternalURL:       "http://alertmanager.example.com",
+		GroupKey:          `{}:{alertname="SampleAlert"}`,
+	})
+	data.ConfigID = "0"
+	data.PostID = "samplepostid"
+	return data
 }
 
-// getConfiguration retrieves the active configuration under lock, making it safe to use
-// concurrently. The active configuration may change underneath the client of this method, but
-// the struct returned by this API call is considered immutable.
-func (p *Plugin) getConfiguration() *configuration {
-	p.configurationLock.RLock()
-	defer p.configurationLock.RUnlock()
+// validate checks every setting of the config, the error names the config and the field. Templates
+// are trial-rendered with the templates of the library.
+func (ac *alertConfig) validate(library map[string]string) error {
+	var errs []error
+	fail := func(field string, err error) {
+		errs = append(errs, fmt.Errorf("config #%s: %s: %w", ac.ID, field, err))
+	}
+
+	if ac.Team == "" {
+		fail("Team", errors.New("must be set"))
+	}
+	if ac.Channel == "" {
+		fail("Channel", errors.New("must be set"))
+	}
+
+	switch {
+	case ac.Token == "":
+		fail("Token", errors.New("must be set"))
+	case len(ac.Token) < minTokenLength:
+		fail("Token", fmt.Errorf("must be at least %d characters long", minTokenLength))
+	}
+
+	if ac.AlertManagerURL == "" {
+		if ac.hasAlertmanager() {
+			fail("AlertManagerURL", errors.New("must be set"))
+		}
+	} else if u, err := url.Parse(ac.AlertManagerURL); err != nil {
+		fail("AlertManagerURL", err)
+	} else if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		fail("AlertManagerURL", fmt.Errorf("%q must be an absolute http or https URL", ac.AlertManagerURL))
+	}
+
+	for i, rule := range ac.TemplateRules {
+		if err := rule.validate(); err != nil {
+			fail(fmt.Sprintf("TemplateRules %s", rule.name(i)), err)
+		}
+	}
+	for i, link := range ac.Links {
+		if err := link.validate(); err != nil {
+			fail(fmt.Sprintf("Links #%d", i+1), err)
+		}
+	}
+	if ac.ExternalURL != "" {
+		if u, err := url.Parse(ac.ExternalURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			fail("ExternalURL", fmt.Errorf("%q must be an absolute http or https URL", ac.ExternalURL))
+		}
+	}
+	switch ac.UILinks {
+	case "", uiLinksAlertmanager, uiLinksKarma:
+	default:
+		fail("UILinks", fmt.Errorf("invalid UI %q, must be %s or %s", ac.UILinks, uiLinksAlertmanager, uiLinksKarma))
+	}
+	errs = append(errs, ac.validateTemplates(library)...)
+
+	for _, colors := range []struct {
+		field  string
+		values map[string]string
+	}{
+		{field: "StateColors", values: ac.StateColors},
+		{field: "SeverityColors", values: ac.SeverityColors},
+	} {
+		for _, key := range sortedKeys(colors.values) {
+			if value := colors.values[key]; value != "" && !colorRegexp.MatchString(value) {
+				fail(colors.field, fmt.Errorf("color %q of %q must be a hex color like #FF0000", value, key))
+			}
+		}
+	}
 
-	if p.configuration == nil {
-		return &configuration{
-			AlertConfigs: make(map[string]alertConfig),
+	for _, severity := range sortedKeys(ac.SeverityMentions) {
+		for _, mention := range strings.Fields(ac.SeverityMentions[severity]) {
+			if !mentionRegexp.MatchString(mention) {
+				fail("SeverityMentions", fmt.Errorf("mention %q of %q must be like @username, @group, @here or @channel", mention, severity))
+			}
 		}
 	}
 
-	return p.configuration
+	if ac.StormThreshold < 0 {
+		fail("StormThreshold", errors.New("must not be negative"))
+	}
+	if ac.HistoryRetentionDays < 0 {
+		fail("HistoryRetentionDays", errors.New("must not be negative"))
+	}
+	if ac.DigestSchedule != "" {
+		if _, err := parseCronSchedule(ac.DigestSchedule); err != nil {
+			fail("DigestSchedule", err)
+		}
+	}
+	if _, err := displayLocation(*ac); err != nil {
+		fail("Timezone", err)
+	}
+	switch ac.Source {
+	case "", sourceAlertmanager, sourceGrafana:
+	case sourceMapping:
+		for _, err := range ac.FieldMapping.validate() {
+			fail("FieldMapping", err)
+		}
+	default:
+		fail("Source", fmt.Errorf("unknown source %q, must be %s, %s or %s", ac.Source, sourceAlertmanager, sourceGrafana, sourceMapping))
+	}
+	if ac.HealthCheck && ac.Source == sourceMapping {
+		fail("HealthCheck", fmt.Errorf("the %s source has no AlertManager to check", sourceMapping))
+	}
+	if _, _, _, err := ac.heartbeatSettings(); err != nil {
+		fail("Heartbeat", err)
+	}
+	if _, ok := matchLanguage(ac.Language); ac.Language != "" && !ok {
+		fail("Language", fmt.Errorf("unsupported language %q, must be one of %s", ac.Language, strings.Join(supportedLanguages(), ", ")))
+	}
+	if _, err := digestLocation(*ac); err != nil {
+		fail("DigestTimezone", err)
+	}
+
+	return errors.Join(errs...)
 }
 
-// setConfiguration replaces the active configuration under lock.
-//
-// Do not call setConfiguration while holding the configurationLock, as sync.Mutex is not
-// reentrant. In particular, avoid using the plugin API entirely, as this may in turn trigger a
-// hook back into the plugin. If that hook attempts to acquire this lock, a deadlock may occur.
-//
-// This method panics if setConfiguration is called with the existing configuration. This almost
-// certainly means that the configuration was modified without being cloned and may result in
-// an unsafe access.
-func (p *Plugin) setConfiguration(configuration *configuration) {
-	p.configurationLock.Lock()
-	defer p.configurationLock.Unlock()
-
-	if configuration != nil && p.configuration == configuration {
-		// Ignore assignment if the configuration struct is empty. Go will optimize the
-		// allocation for same to point at the same memory address, breaking the check
-		// above.
-		if reflect.ValueOf(*configuration).NumField() == 0 {
-			return
+// validateTemplates trial-renders the templates of the config with the templates of the library,
+// the errors name the config and the field
+func (ac *alertConfig) validateTemplates(library map[string]string) []error {
+	var errs []error
+	fail := func(field string, err error) {
+		errs = append(errs, fmt.Errorf("config #%s: %s: %w", ac.ID, field, err))
+	}
+
+	data := sampleTemplateData()
+	data.library = parseLibrary(library)
+
+	for _, tmpl := range []struct{ field, value string }{
+		{field: "FiringTemplate", value: ac.FiringTemplate},
+		{field: "ResolvedTemplate", value: ac.ResolvedTemplate},
+	} {
+		if tmpl.value == "" {
+			continue
+		}
+		if _, err := renderAlertTemplate(tmpl.value, data); err != nil {
+			fail(tmpl.field, err)
+		}
+	}
+
+	for _, err := range ac.validateThreadReplies(library) {
+		fail("ThreadReplies", err)
+	}
+
+	for i, rule := range ac.TemplateRules {
+		field := fmt.Sprintf("TemplateRules %s", rule.name(i))
+		for _, tmpl := range []struct{ field, value string }{
+			{field: "FiringTemplate", value: rule.FiringTemplate},
+			{field: "ResolvedTemplate", value: rule.ResolvedTemplate},
+			{field: "AckedTemplate", value: rule.AckedTemplate},
+		} {
+			if tmpl.value == "" {
+				continue
+			}
+			if _, err := renderAlertTemplate(tmpl.value, data); err != nil {
+				fail(field+" "+tmpl.field, err)
+			}
+		}
+	}
+
+	for i, link := range ac.Links {
+		if _, err := renderAlertTemplate(link.URL, data); err != nil {
+			fail(fmt.Sprintf("Links #%d URL", i+1), err)
+		}
+	}
+	return errs
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// validate checks every config and that webhook tokens are unique, so that routing is unambiguous
+func (c *configuration) validate(library map[string]string) error {
+	ids := make([]string, 0, len(c.AlertConfigs))
+	for id := range c.AlertConfigs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var errs []error
+	tokens := make(map[string]string)
+	for _, id := range ids {
+		alertConfig := c.AlertConfigs[id]
+		if err := alertConfig.validate(library); err != nil {
+			errs = append(errs, err)
+		}
+		if alertConfig.Token == "" {
+			continue
+		}
+		if other, ok := tokens[alertConfig.Token]; ok {
+			errs = append(errs, fmt.Errorf("config #%s: Token: must be unique, it is also used by config #%s", id, other))
+			continue
 		}
+		tokens[alertConfig.Token] = id
+	}
+
+	return errors.Join(errs...)
+}
+
+// loadConfiguration decodes the plugin settings and normalizes them
+func loadConfiguration(settings map[string]any) (*configuration, error) {
+	configurationInstance := configuration{
+		AlertConfigs: make(map[string]alertConfig),
+	}
+
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &configurationInstance); err != nil {
+		return nil, err
+	}
+	configurationInstance.normalize()
+
+	return &configurationInstance, nil
+}
+
+// normalize sets the config IDs from the map keys and cleans up the URLs
+func (c *configuration) normalize() {
+	for id, alertConfigInstance := range c.AlertConfigs {
+		alertConfigInstance.ID = id
+		alertConfigInstance.AlertManagerURL = strings.TrimRight(alertConfigInstance.AlertManagerURL, `/`)
+		c.AlertConfigs[id] = alertConfigInstance
+	}
+}
 
-		panic("setConfiguration called with the existing configuration")
+// ConfigurationWillBeSaved rejects saving an invalid plugin configuration. Servers before 8.0 do
+// not call it, OnConfigurationChange logs the problems and /alertmanager doctor reports them.
+func (p *Plugin) ConfigurationWillBeSaved(newCfg *model.Config) (*model.Config, error) {
+	if newCfg == nil || newCfg.PluginSettings.Plugins == nil {
+		return nil, nil
+	}
+	settings, ok := newCfg.PluginSettings.Plugins[Manifest.Id]
+	if !ok {
+		return nil, nil
+	}
+
+	configurationInstance, err := loadConfiguration(settings)
+	if err != nil {
+		return nil, fmt.Errorf("invalid AlertManager plugin configuration: %w", err)
+	}
+	if err := configurationInstance.validate(p.templateLibraryBodies()); err != nil {
+		return nil, fmt.Errorf("invalid AlertManager plugin configuration: %w", err)
 	}
 
-	p.configuration = configuration
+	return nil, nil
+}
+
+// Clone deep copies the configuration.
+func (c *configuration) Clone() *configuration {
+	clone := configuration{
+		AlertConfigs: make(map[string]alertConfig, len(c.AlertConfigs)),
+	}
+	for k, v := range c.AlertConfigs {
+		v.SeverityMentions = cloneStringMap(v.SeverityMentions)
+		v.StateColors = cloneStringMap(v.StateColors)
+		v.SeverityColors = cloneStringMap(v.SeverityColors)
+		v.TemplateRules = slices.Clone(v.TemplateRules)
+		v.Links = slices.Clone(v.Links)
+		v.ThreadReplies = maps.Clone(v.ThreadReplies)
+		v.FieldMapping.Labels = maps.Clone(v.FieldMapping.Labels)
+		v.FieldMapping.Annotations = maps.Clone(v.FieldMapping.Annotations)
+		v.FieldMapping.ResolvedValues = slices.Clone(v.FieldMapping.ResolvedValues)
+		clone.AlertConfigs[k] = v
+	}
+	return &clone
+}
+
+func cloneStringMap[M ~map[string]string](m M) M {
+	if m == nil {
+		return nil
+	}
+	clone := make(M, len(m))
+	for k, v := range m {
+		clone[k] = v
+	}
+	return clone
+}
+
+// getConfiguration retrieves the active configuration. It is part of an immutable snapshot,
+// safe to use concurrently, and must not be modified.
+func (p *Plugin) getConfiguration() *configuration {
+	return p.getState().configuration
 }
 
 // OnConfigurationChange is invoked when configuration changes may have been made.
@@ -220,18 +517,18 @@ func (p *Plugin) OnConfigurationChange() error {
 		return fmt.Errorf("failed to load plugin configuration: %w", err)
 	}
 
-	for id, alertConfigInstance := range configurationInstance.AlertConfigs {
-		alertConfigInstance.ID = id
-		alertConfigInstance.AlertManagerURL = strings.TrimRight(alertConfigInstance.AlertManagerURL, `/`)
-		configurationInstance.AlertConfigs[id] = alertConfigInstance
-	}
+	configurationInstance.normalize()
 
-	p.setConfiguration(&configurationInstance)
+	// Saving an invalid configuration is rejected by ConfigurationWillBeSaved, configurations
+	// predating validation or edited in the config file are still applied
+	if err := configurationInstance.validate(p.templateLibraryBodies()); err != nil {
+		p.API.LogWarn("Plugin configuration is invalid", "error", err.Error())
+	}
 
 	// Reload channel mappings after configuration change
 	p.API.LogInfo("Configuration changed, reloading channel mappings")
-	if err := p.reloadChannelMappings(); err != nil {
-		p.API.LogError("Failed to reload channel mappings after configuration change", "error", err.Error())
+	if err := p.applyConfiguration(&configurationInstance); err != nil {
+		return fmt.Errorf("failed to apply plugin configuration: %w", err)
 	}
 
 	return nil
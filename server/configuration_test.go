@@ -0,0 +1,74 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigurationValidate(t *testing.T) {
+	valid := func() alertConfig {
+		return alertConfig{
+			ID:               "0",
+			Team:             "ops",
+			Channel:          "alerts",
+			Token:            "Qw8eR5tY2uI9oP3aS6dF1gH4jK7lZ0xC",
+			AlertManagerURL:  "http://alertmanager:9093",
+			FiringTemplate:   "{{ .Labels.alertname }} on {{ .Receiver }}",
+			StateColors:      StateColorMap{"firing": "#F00"},
+			SeverityMentions: SeverityMentionsMap{"critical": "@devops-oncall @here"},
+		}
+	}
+	ac := valid()
+	require.NoError(t, ac.validate(nil))
+
+	for field, mutate := range map[string]func(*alertConfig){
+		"Team":             func(ac *alertConfig) { ac.Team = "" },
+		"Token":            func(ac *alertConfig) { ac.Token = "short" },
+		"AlertManagerURL":  func(ac *alertConfig) { ac.AlertManagerURL = "alertmanager:9093" },
+		"FiringTemplate":   func(ac *alertConfig) { ac.FiringTemplate = "{{ .Labels.alertname " },
+		"ResolvedTemplate": func(ac *alertConfig) { ac.ResolvedTemplate = "{{ formatTime .Labels }}" },
+		"SeverityColors":   func(ac *alertConfig) { ac.SeverityColors = SeverityColorMap{"critical": "red"} },
+		"SeverityMentions": func(ac *alertConfig) { ac.SeverityMentions = SeverityMentionsMap{"critical": "devops"} },
+		"DigestSchedule":   func(ac *alertConfig) { ac.DigestSchedule = "every day" },
+		"DigestTimezone":   func(ac *alertConfig) { ac.DigestTimezone = "Mars/Olympus" },
+		"Language":         func(ac *alertConfig) { ac.Language = "tlh" },
+	} {
+		ac := valid()
+		mutate(&ac)
+		err := ac.validate(nil)
+		require.Error(t, err, field)
+		assert.Contains(t, err.Error(), "config #0: "+field+":")
+	}
+
+	first, second := valid(), valid()
+	second.ID = "1"
+	err := (&configuration{AlertConfigs: map[string]alertConfig{"0": first, "1": second}}).validate(nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "config #1: Token: must be unique")
+
+	// Only configs with an AlertManager need its URL
+	ac = valid()
+	ac.AlertManagerURL = ""
+	require.Error(t, ac.validate(nil))
+	ac.Source = sourceMapping
+	ac.FieldMapping = FieldMapping{Labels: map[string]string{"alertname": "@.name"}}
+	require.NoError(t, ac.validate(nil))
+	require.NoError(t, ac.IsValid())
+}
+
+func TestLoadConfiguration(t *testing.T) {
+	c, err := loadConfiguration(map[string]any{
+		"alertconfigs": map[string]any{
+			"7": map[string]any{
+				"alertmanagerurl":  "http://alertmanager:9093/",
+				"severitymentions": `{"critical": "@oncall"}`,
+			},
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "7", c.AlertConfigs["7"].ID)
+	assert.Equal(t, "http://alertmanager:9093", c.AlertConfigs["7"].AlertManagerURL)
+	assert.Equal(t, "@oncall", c.AlertConfigs["7"].SeverityMentions["critical"])
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/alertmanager/notify/webhook"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+const (
+	webhookSeenKeyPrefix = "webhook_seen_"
+
+	// webhookSeenTTL is how long a notification ID is remembered to detect duplicates.
+	// It covers Alertmanager delivery retries and HA peers notifying concurrently.
+	webhookSeenTTL = 10 * time.Minute
+)
+
+// webhookMessageID identifies a notification by its group key, status and the
+// fingerprint and timestamps of every alert it carries.
+func webhookMessageID(message webhook.Message) string {
+	var status string
+	var alerts []string
+	if message.Data != nil {
+		status = message.Status
+		alerts = make([]string, 0, len(message.Alerts))
+		for _, alert := range message.Alerts {
+			alerts = append(alerts, fmt.Sprintf("%s|%s|%d|%d",
+				alert.Fingerprint,
+				alert.Status,
+				alert.StartsAt.UnixNano(),
+				alert.EndsAt.UnixNano(),
+			))
+		}
+		sort.Strings(alerts)
+	}
+
+	h := sha256.New()
+	_, _ = fmt.Fprintf(h, "%s\n%s\n%s", message.GroupKey, status, strings.Join(alerts, "\n"))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func getWebhookSeenKey(configID, messageID string) string {
+	// KV keys are limited to 150 characters, the hash is 64
+	return fmt.Sprintf("%s%s_%s", webhookSeenKeyPrefix, configID, messageID)
+}
+
+// markWebhookSeen atomically records the notification ID. It returns false when
+// the ID was already recorded, i.e. the notification is a duplicate.
+func (p *Plugin) markWebhookSeen(configID, messageID string) (bool, error) {
+	stored, appErr := p.API.KVSetWithOptions(getWebhookSeenKey(configID, messageID), []byte(fmt.Sprintf("%d", model.GetMillis())), model.PluginKVSetOptions{
+		Atomic:          true,
+		OldValue:        nil,
+		ExpireInSeconds: int64(webhookSeenTTL.Seconds()),
+	})
+	if appErr != nil {
+		return false, appErr
+	}
+	return stored, nil
+}
+
+// forgetWebhookSeen removes the notification ID so that a redelivery is processed,
+// used when the notification could not be accepted.
+func (p *Plugin) forgetWebhookSeen(configID, messageID string) {
+	if appErr := p.API.KVDelete(getWebhookSeenKey(configID, messageID)); appErr != nil {
+		p.API.LogWarn("[WEBHOOK] Failed to forget notification ID",
+			"config_id", configID,
+			"message_id", messageID,
+			"error", appErr.Error(),
+		)
+	}
+}
+
+// ingestStats counts the webhooks received by this node since activation. The counts differ between
+// the nodes of a cluster and reset on restarts, they are only reported as counts of this node.
+type ingestStats struct {
+	received   map[string]int64
+	duplicates map[string]int64
+	mu         sync.Mutex
+}
+
+func newIngestStats() *ingestStats {
+	return &ingestStats{
+		received:   make(map[string]int64),
+		duplicates: make(map[string]int64),
+	}
+}
+
+func (s *ingestStats) recordReceived(configID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.received[configID]++
+}
+
+func (s *ingestStats) recordDuplicate(configID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.duplicates[configID]++
+}
+
+// get returns the number of received and duplicate webhooks for the config
+func (s *ingestStats) get(configID string) (received, duplicates int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.received[configID], s.duplicates[configID]
+}
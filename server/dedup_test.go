@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/alertmanager/notify/webhook"
+	"github.com/prometheus/alertmanager/template"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebhookMessageID(t *testing.T) {
+	startsAt := time.Date(2024, 11, 21, 10, 0, 0, 0, time.UTC)
+	newMessage := func(alerts ...template.Alert) webhook.Message {
+		return webhook.Message{
+			GroupKey: `{}:{alertname="HighLatency"}`,
+			Data:     &template.Data{Status: "firing", Alerts: alerts},
+		}
+	}
+	a := template.Alert{Status: "firing", Fingerprint: "a", StartsAt: startsAt}
+	b := template.Alert{Status: "firing", Fingerprint: "b", StartsAt: startsAt}
+
+	id := webhookMessageID(newMessage(a, b))
+	assert.Len(t, id, 64)
+	assert.Equal(t, id, webhookMessageID(newMessage(b, a)), "alert order does not matter")
+
+	resolved := b
+	resolved.Status = "resolved"
+	resolved.EndsAt = startsAt.Add(time.Hour)
+	assert.NotEqual(t, id, webhookMessageID(newMessage(a, resolved)))
+
+	other := newMessage(a, b)
+	other.GroupKey = `{}:{alertname="DiskFull"}`
+	assert.NotEqual(t, id, webhookMessageID(other))
+
+	assert.NotPanics(t, func() { webhookMessageID(webhook.Message{}) })
+}
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+const (
+	checkPass = "pass"
+	checkWarn = "warn"
+	checkFail = "fail"
+
+	webhookLastKeyPrefix = "webhook_last_"
+
+	// minAlertmanagerVersion is the first release sending truncatedAlerts and supporting the API v2 filters used by the plugin
+	minAlertmanagerVersion = "0.25.0"
+	minTokenLength         = 16
+	strongTokenLength      = 32
+	// webhookSilenceWarning is how long without webhooks before the doctor warns
+	webhookSilenceWarning = 24 * time.Hour
+)
+
+// diagnosticCheck is the result of a single doctor check
+type diagnosticCheck struct {
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	Hint    string `json:"hint,omitempty"`
+}
+
+// configDiagnostics are the doctor checks of an alert config
+type configDiagnostics struct {
+	ConfigID string            `json:"config_id"`
+	Team     string            `json:"team"`
+	Channel  string            `json:"channel"`
+	Checks   []diagnosticCheck `json:"checks"`
+}
+
+func (d *configDiagnostics) add(name, status, message, hint string) {
+	d.Checks = append(d.Checks, diagnosticCheck{Name: name, Status: status, Message: message, Hint: hint})
+}
+
+// status returns the worst status of the checks
+func (d *configDiagnostics) status() string {
+	status := checkPass
+	for _, check := range d.Checks {
+		switch check.Status {
+		case checkFail:
+			return checkFail
+		case checkWarn:
+			status = checkWarn
+		}
+	}
+	return status
+}
+
+func getWebhookLastKey(configID string) string {
+	return webhookLastKeyPrefix + configID
+}
+
+// saveLastWebhook records when the config last received a webhook
+func (p *Plugin) saveLastWebhook(configID string) {
+	if appErr := p.API.KVSet(getWebhookLastKey(configID), []byte(strconv.FormatInt(model.GetMillis(), 10))); appErr != nil {
+		p.API.LogWarn("[WEBHOOK] Failed to record last webhook time",
+			"config_id", configID,
+			"error", appErr.Error(),
+		)
+	}
+}
+
+func (p *Plugin) getLastWebhook(configID string) (time.Time, error) {
+	data, appErr := p.API.KVGet(getWebhookLastKey(configID))
+	if appErr != nil {
+		return time.Time{}, appErr
+	}
+	if data == nil {
+		return time.Time{}, nil
+	}
+	millis, err := strconv.ParseInt(string(data), 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.UnixMilli(millis), nil
+}
+
+// parseVersion parses "v1.2.3" or "1.2.3-rc.0" into its numeric components
+func parseVersion(version string) ([3]int, bool) {
+	var parsed [3]int
+	version = strings.TrimPrefix(strings.TrimSpace(version), "v")
+	version, _, _ = strings.Cut(version, "-")
+	parts := strings.Split(version, ".")
+	if len(parts) != 3 {
+		return parsed, false
+	}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return parsed, false
+		}
+		parsed[i] = n
+	}
+	return parsed, true
+}
+
+// versionAtLeast reports whether version >= minimum, ok is false when version cannot be parsed
+func versionAtLeast(version, minimum string) (atLeast, ok bool) {
+	v, ok := parseVersion(version)
+	if !ok {
+		return false, false
+	}
+	m, _ := parseVersion(minimum)
+	for i := range v {
+		if v[i] != m[i] {
+			return v[i] > m[i], true
+		}
+	}
+	return true, true
+}
+
+// checkToken rates the webhook token, tokens are compared against every config
+func checkToken(alertConfig alertConfig, configs map[string]alertConfig, l localizer) (status, message, hint string) {
+	for id, other := range configs {
+		if id != alertConfig.ID && other.Token == alertConfig.Token {
+			return checkFail, l.T("doctor.token.shared", id), l.T("doctor.token.shared_hint")
+		}
+	}
+
+	distinct := make(map[rune]bool)
+	for _, r := range alertConfig.Token {
+		distinct[r] = true
+	}
+
+	switch {
+	case len(alertConfig.Token) < minTokenLength || len(distinct) < 8:
+		return checkFail, l.T("doctor.token.weak", len(alertConfig.Token)), l.T("doctor.token.hint", strongTokenLength)
+	case len(alertConfig.Token) < strongTokenLength:
+		return checkWarn, l.T("doctor.token.short", len(alertConfig.Token)), l.T("doctor.token.hint", strongTokenLength)
+	}
+	return checkPass, l.T("doctor.token.strong"), ""
+}
+
+// diagnoseConfig runs the doctor checks of a config, the checks are written in the language of l.
+// Its templates are validated with the templates of library.
+func (p *Plugin) diagnoseConfig(alertConfig alertConfig, configs map[string]alertConfig, library map[string]string, siteURL string, l localizer) configDiagnostics {
+	diagnostics := configDiagnostics{
+		ConfigID: alertConfig.ID,
+		Team:     alertConfig.Team,
+		Channel:  alertConfig.Channel,
+	}
+
+	// Servers before 8.0 save a configuration without validating it, its problems are reported here
+	if err := alertConfig.validate(library); err != nil {
+		diagnostics.add(l.T("doctor.configuration"), checkFail, strings.ReplaceAll(err.Error(), "\n", "; "), l.T("doctor.configuration.hint"))
+	}
+
+	team, appErr := p.API.GetTeamByName(alertConfig.Team)
+	if appErr != nil {
+		diagnostics.add(l.T("doctor.team"), checkFail, l.T("doctor.team.not_found", alertConfig.Team, appErr.Error()), l.T("doctor.team.hint"))
+	} else {
+		diagnostics.add(l.T("doctor.team"), checkPass, l.T("doctor.team.exists", team.Name), "")
+
+		channel, appErr := p.API.GetChannelByName(team.Id, alertConfig.Channel, false)
+		if appErr != nil {
+			diagnostics.add(l.T("doctor.channel"), checkFail, l.T("doctor.channel.not_found", alertConfig.Channel, appErr.Error()), l.T("doctor.channel.hint"))
+		} else {
+			diagnostics.add(l.T("doctor.channel"), checkPass, l.T("doctor.channel.exists", channel.Name), "")
+
+			if _, appErr := p.API.GetChannelMember(channel.Id, p.BotUserID); appErr != nil {
+				diagnostics.add(l.T("doctor.membership"), checkFail, l.T("doctor.membership.missing"), l.T("doctor.membership.hint", channel.Name))
+			} else {
+				diagnostics.add(l.T("doctor.membership"), checkPass, l.T("doctor.membership.ok"), "")
+			}
+
+			if mapped := p.getChannelID(alertConfig.ID); mapped != channel.Id {
+				diagnostics.add(l.T("doctor.mapping"), checkWarn, l.T("doctor.mapping.outdated"), l.T("doctor.mapping.hint"))
+			}
+		}
+	}
+
+	switch {
+	case siteURL != "":
+		diagnostics.add(l.T("doctor.site_url"), checkPass, l.T("doctor.site_url.ok", siteURL), "")
+	case alertConfig.EnableActions:
+		diagnostics.add(l.T("doctor.site_url"), checkFail, l.T("doctor.site_url.missing_actions"), l.T("doctor.site_url.hint"))
+	default:
+		diagnostics.add(l.T("doctor.site_url"), checkWarn, l.T("doctor.site_url.missing"), l.T("doctor.site_url.hint_actions"))
+	}
+
+	if !alertConfig.hasAlertmanager() {
+		diagnostics.add(l.T("doctor.alertmanager"), checkPass, l.T("doctor.alertmanager.none", alertConfig.Source), "")
+	} else if status, err := p.amClient.Status(alertConfig.alertmanagerAPIURL()); err != nil {
+		diagnostics.add(l.T("doctor.alertmanager"), checkFail, l.T("doctor.alertmanager.unreachable", alertConfig.AlertManagerURL, err), l.T("doctor.alertmanager.unreachable_hint"))
+	} else {
+		version := status.VersionInfo.Version
+		supported, ok := versionAtLeast(version, minAlertmanagerVersion)
+		switch {
+		case alertConfig.Source == sourceGrafana:
+			// The Alertmanager of Grafana managed alerts reports no version, it goes with Grafana
+			diagnostics.add(l.T("doctor.alertmanager"), checkPass, l.T("doctor.alertmanager.grafana_ok", alertConfig.AlertManagerURL), "")
+		case !ok:
+			diagnostics.add(l.T("doctor.alertmanager"), checkWarn, l.T("doctor.alertmanager.unknown_version", alertConfig.AlertManagerURL, version),
+				l.T("doctor.alertmanager.unknown_version_hint", minAlertmanagerVersion))
+		case !supported:
+			diagnostics.add(l.T("doctor.alertmanager"), checkWarn, l.T("doctor.alertmanager.unsupported", alertConfig.AlertManagerURL, version),
+				l.T("doctor.alertmanager.unsupported_hint", minAlertmanagerVersion))
+		default:
+			diagnostics.add(l.T("doctor.alertmanager"), checkPass, l.T("doctor.alertmanager.ok", alertConfig.AlertManagerURL, version), "")
+		}
+	}
+
+	tokenStatus, tokenMessage, tokenHint := checkToken(alertConfig, configs, l)
+	diagnostics.add(l.T("doctor.token"), tokenStatus, tokenMessage, tokenHint)
+
+	for _, tmpl := range []struct{ name, value string }{
+		{name: l.T("doctor.firing_template"), value: alertConfig.FiringTemplate},
+		{name: l.T("doctor.resolved_template"), value: alertConfig.ResolvedTemplate},
+	} {
+		if tmpl.value == "" {
+			continue
+		}
+		if _, err := parseAlertTemplate(tmpl.value); err != nil {
+			diagnostics.add(tmpl.name, checkFail, err.Error(), l.T("doctor.template.hint"))
+		} else {
+			diagnostics.add(tmpl.name, checkPass, l.T("doctor.template.ok"), "")
+		}
+	}
+
+	lastWebhook, err := p.getLastWebhook(alertConfig.ID)
+	switch {
+	case err != nil:
+		diagnostics.add(l.T("doctor.webhook"), checkWarn, l.T("doctor.webhook.failed", err), "")
+	case lastWebhook.IsZero():
+		diagnostics.add(l.T("doctor.webhook"), checkWarn, l.T("doctor.webhook.none"), l.T("doctor.webhook.none_hint"))
+	default:
+		since := time.Since(lastWebhook)
+		message := l.T("doctor.webhook.received", l.Duration(since.Round(time.Second)))
+		if since > webhookSilenceWarning {
+			diagnostics.add(l.T("doctor.webhook"), checkWarn, message, l.T("doctor.webhook.old_hint"))
+		} else {
+			diagnostics.add(l.T("doctor.webhook"), checkPass, message, "")
+		}
+	}
+
+	// The counts are kept in memory, per node since its activation
+	received, duplicates := p.ingest.get(alertConfig.ID)
+	diagnostics.add(l.T("doctor.duplicates"), checkPass, l.T("doctor.duplicates.count", received, duplicates), "")
+
+	return diagnostics
+}
+
+// runDiagnostics runs the doctor checks of every config, ordered by config ID
+func (p *Plugin) runDiagnostics(l localizer) []configDiagnostics {
+	configs := p.getConfiguration().AlertConfigs
+
+	siteURL := ""
+	if config := p.API.GetConfig(); config != nil && config.ServiceSettings.SiteURL != nil {
+		siteURL = *config.ServiceSettings.SiteURL
+	}
+
+	ids := make([]string, 0, len(configs))
+	for id := range configs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	library := p.templateLibraryBodies()
+	results := make([]configDiagnostics, 0, len(ids))
+	for _, id := range ids {
+		results = append(results, p.diagnoseConfig(configs[id], configs, library, siteURL, l))
+	}
+	return results
+}
+
+func checkEmoji(status string) string {
+	switch status {
+	case checkPass:
+		return "✅"
+	case checkWarn:
+		return "⚠️"
+	}
+	return "❌"
+}
+
+// buildDiagnosticsAttachment renders the checks of a config
+func buildDiagnosticsAttachment(diagnostics configDiagnostics, l localizer) *model.SlackAttachment {
+	lines := make([]string, 0, len(diagnostics.Checks))
+	for _, check := range diagnostics.Checks {
+		line := fmt.Sprintf("%s **%s:** %s", checkEmoji(check.Status), check.Name, check.Message)
+		if check.Hint != "" && check.Status != checkPass {
+			line += fmt.Sprintf("\n    ↳ %s", check.Hint)
+		}
+		lines = append(lines, line)
+	}
+
+	color := colorResolved
+	switch diagnostics.status() {
+	case checkWarn:
+		color = colorWarning
+	case checkFail:
+		color = colorFiring
+	}
+
+	return &model.SlackAttachment{
+		Title: l.T("doctor.title", diagnostics.ConfigID, diagnostics.Team, diagnostics.Channel),
+		Text:  strings.Join(lines, "\n"),
+		Color: color,
+	}
+}
+
+// isSystemAdmin authorizes requests authenticated by Mattermost as a system admin
+func (p *Plugin) isSystemAdmin(w http.ResponseWriter, r *http.Request) bool {
+	userID := r.Header.Get("Mattermost-User-Id")
+	if userID == "" {
+		http.Error(w, "Not authorized", http.StatusUnauthorized)
+		return false
+	}
+	if !p.API.HasPermissionTo(userID, model.PermissionManageSystem) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// handleDiagnostics returns the doctor checks as JSON to system admins
+func (p *Plugin) handleDiagnostics(w http.ResponseWriter, r *http.Request) {
+	if !p.isSystemAdmin(w, r) {
+		return
+	}
+
+	l := p.userLocalizer(r.Header.Get("Mattermost-User-Id"))
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(p.runDiagnostics(l)); err != nil {
+		p.API.LogError("[HTTP] Failed to encode diagnostics", "error", err.Error())
+	}
+}
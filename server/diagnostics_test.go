@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVersionAtLeast(t *testing.T) {
+	for version, expected := range map[string]bool{
+		"0.25.0":       true,
+		"v0.29.0":      true,
+		"1.0.0-rc.1":   true,
+		"0.24.9":       false,
+		"0.9.100":      false,
+		"0.25.0-rc.0":  true,
+		"0.100.0":      true,
+		"0.3.0-alpha1": false,
+	} {
+		atLeast, ok := versionAtLeast(version, minAlertmanagerVersion)
+		assert.True(t, ok, version)
+		assert.Equal(t, expected, atLeast, version)
+	}
+
+	_, ok := versionAtLeast("main", minAlertmanagerVersion)
+	assert.False(t, ok)
+}
+
+func TestCheckToken(t *testing.T) {
+	strong := "Rk3n9XqPz7LmV2cW8bHy5TfJ1aSdGe4u"
+	configs := map[string]alertConfig{
+		"1": {ID: "1", Token: strong},
+		"2": {ID: "2", Token: strong},
+		"3": {ID: "3", Token: "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"},
+		"4": {ID: "4", Token: "Rk3n9XqPz7LmV2cW8b"},
+		"5": {ID: "5", Token: "Qw8eR5tY2uI9oP3aS6dF1gH4jK7lZ0xC"},
+	}
+
+	for id, expected := range map[string]string{
+		"1": checkFail,
+		"3": checkFail,
+		"4": checkWarn,
+		"5": checkPass,
+	} {
+		status, _, _ := checkToken(configs[id], configs, newLocalizer(defaultLanguage))
+		assert.Equal(t, expected, status, id)
+	}
+
+	diagnostics := configDiagnostics{}
+	diagnostics.add("a", checkPass, "", "")
+	diagnostics.add("b", checkWarn, "", "")
+	assert.Equal(t, checkWarn, diagnostics.status())
+	diagnostics.add("c", checkFail, "", "")
+	assert.Equal(t, checkFail, diagnostics.status())
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/alertmanager/types"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/pluginapi/cluster"
+)
+
+const (
+	digestJobKey         = "digest_job"
+	digestLastKeyPrefix  = "digest_last_"
+	digestCheckInterval  = time.Minute
+	digestExpiringWithin = 24 * time.Hour
+	// digestMaxListed caps the alerts and silences listed by name in a digest
+	digestMaxListed = 10
+	colorDigest     = "#0066cc"
+)
+
+func getDigestLastKey(configID string) string {
+	return digestLastKeyPrefix + configID
+}
+
+// digestLocation returns the timezone of the digest schedule, the display timezone of the config by default
+func digestLocation(alertConfig alertConfig) (*time.Location, error) {
+	if alertConfig.DigestTimezone == "" {
+		return displayLocation(alertConfig)
+	}
+	return time.LoadLocation(alertConfig.DigestTimezone)
+}
+
+func (p *Plugin) startDigestJob() {
+	job, err := cluster.Schedule(p.API, digestJobKey, cluster.MakeWaitForRoundedInterval(digestCheckInterval), p.runDigests)
+	if err != nil {
+		p.API.LogError("[DIGEST] Failed to schedule the digest job", "error", err.Error())
+		return
+	}
+	p.digestJob = job
+}
+
+func (p *Plugin) stopDigestJob() {
+	if p.digestJob == nil {
+		return
+	}
+	if err := p.digestJob.Close(); err != nil {
+		p.API.LogWarn("[DIGEST] Failed to stop the digest job", "error", err.Error())
+	}
+	p.digestJob = nil
+}
+
+// runDigests posts the digests that are due. It runs on a single node of the cluster at a time.
+func (p *Plugin) runDigests() {
+	now := time.Now()
+	for _, alertConfig := range p.getConfiguration().AlertConfigs {
+		if alertConfig.DigestSchedule == "" {
+			continue
+		}
+
+		schedule, err := parseCronSchedule(alertConfig.DigestSchedule)
+		if err != nil {
+			p.API.LogWarn("[DIGEST] Invalid digest schedule", "config_id", alertConfig.ID, "error", err.Error())
+			continue
+		}
+		loc, err := digestLocation(alertConfig)
+		if err != nil {
+			p.API.LogWarn("[DIGEST] Invalid digest timezone", "config_id", alertConfig.ID, "error", err.Error())
+			continue
+		}
+
+		key := getDigestLastKey(alertConfig.ID)
+		data, appErr := p.API.KVGet(key)
+		if appErr != nil {
+			p.API.LogWarn("[DIGEST] Failed to get last digest time", "config_id", alertConfig.ID, "error", appErr.Error())
+			continue
+		}
+
+		// The first run only records the start of the first digest period
+		if data != nil {
+			lastMillis, parseErr := strconv.ParseInt(string(data), 10, 64)
+			if parseErr == nil {
+				last := time.UnixMilli(lastMillis).In(loc)
+				due := schedule.next(last)
+				if due.IsZero() || due.After(now) {
+					continue
+				}
+				if err := p.postDigest(alertConfig, last, now.In(loc)); err != nil {
+					p.API.LogError("[DIGEST] Failed to post digest", "config_id", alertConfig.ID, "error", err.Error())
+					continue
+				}
+			}
+		}
+
+		if appErr := p.API.KVSet(key, []byte(strconv.FormatInt(now.UnixMilli(), 10))); appErr != nil {
+			p.API.LogWarn("[DIGEST] Failed to save last digest time", "config_id", alertConfig.ID, "error", appErr.Error())
+		}
+	}
+}
+
+// firingAlert is an alert still firing at the end of a digest period
+type firingAlert struct {
+	Since       time.Time
+	Alertname   string
+	Fingerprint string
+	Owner       string
+}
+
+// createdSilence is a silence created from an alert post during a digest period
+type createdSilence struct {
+	Alertname string
+	Actor     string
+	Details   string
+}
+
+// alertDigest is the content of a digest post
+type alertDigest struct {
+	Since            time.Time
+	Until            time.Time
+	Fired            map[string]int
+	Resolved         map[string]int
+	Firing           []firingAlert
+	SilencesCreated  []createdSilence
+	SilencesExpiring []types.Silence
+	Stats            alertStats
+}
+
+// buildAlertDigest summarizes the timelines of a config over [since, until)
+func buildAlertDigest(histories []*alertHistory, ac alertConfig, since, until time.Time) alertDigest {
+	digest := alertDigest{
+		Since:    since,
+		Until:    until,
+		Fired:    make(map[string]int),
+		Resolved: make(map[string]int),
+	}
+
+	for _, history := range histories {
+		if history.ConfigID != ac.ID || len(history.Events) == 0 {
+			continue
+		}
+		alertname := orUnknown(history.Labels["alertname"])
+
+		var firedAt time.Time
+		var owner string
+		for _, event := range history.Events {
+			at := time.UnixMilli(event.Timestamp)
+			inPeriod := !at.Before(since) && at.Before(until)
+
+			switch event.Type {
+			case eventFired:
+				firedAt = at
+				owner = ""
+				if inPeriod {
+					digest.Fired[alertname]++
+				}
+			case eventAcked:
+				owner = event.Actor
+			case eventUnacked:
+				owner = ""
+			case eventSilenced:
+				if inPeriod {
+					digest.SilencesCreated = append(digest.SilencesCreated, createdSilence{
+						Alertname: alertname,
+						Actor:     event.Actor,
+						Details:   event.Details,
+					})
+				}
+			case eventResolved:
+				firedAt = time.Time{}
+				if inPeriod {
+					digest.Resolved[alertname]++
+				}
+			}
+		}
+
+		if !firedAt.IsZero() {
+			digest.Firing = append(digest.Firing, firingAlert{
+				Since:       firedAt,
+				Alertname:   alertname,
+				Fingerprint: history.Fingerprint,
+				Owner:       owner,
+			})
+		}
+	}
+
+	sort.Slice(digest.Firing, func(i, j int) bool {
+		return digest.Firing[i].Since.Before(digest.Firing[j].Since)
+	})
+
+	configs := map[string]alertConfig{ac.ID: ac}
+	digest.Stats = computeAlertStats(extractIncidents(histories, configs, since, until), since, until)
+	digest.Stats.Location = statsLocation(configs)
+	return digest
+}
+
+// expiringSilences keeps the active silences ending within the window
+func expiringSilences(silences []types.Silence, now time.Time, window time.Duration) []types.Silence {
+	var expiring []types.Silence
+	for _, silence := range silences {
+		if silence.Status.State != types.SilenceStateActive {
+			continue
+		}
+		if silence.EndsAt.After(now) && silence.EndsAt.Before(now.Add(window)) {
+			expiring = append(expiring, silence)
+		}
+	}
+	sort.Slice(expiring, func(i, j int) bool {
+		return expiring[i].EndsAt.Before(expiring[j].EndsAt)
+	})
+	return expiring
+}
+
+func limitLines(lines []string, l localizer) string {
+	if len(lines) == 0 {
+		return l.T("list.none")
+	}
+	if len(lines) > digestMaxListed {
+		more := len(lines) - digestMaxListed
+		lines = append(lines[:digestMaxListed:digestMaxListed], l.T("list.more", more))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func sumCounts(counts map[string]int) int {
+	total := 0
+	for _, count := range counts {
+		total += count
+	}
+	return total
+}
+
+// buildDigestAttachment renders the digest, times are shown in the location of digest.Until
+func buildDigestAttachment(digest alertDigest, l localizer) *model.SlackAttachment {
+	loc := digest.Until.Location()
+	identity := func(key string) string { return fmt.Sprintf("`%s`", key) }
+
+	firing := make([]string, 0, len(digest.Firing))
+	for _, alert := range digest.Firing {
+		duration := l.Duration(digest.Until.Sub(alert.Since))
+		if alert.Owner != "" {
+			firing = append(firing, l.T("digest.firing_owner", alert.Alertname, duration, alert.Owner))
+		} else {
+			firing = append(firing, l.T("digest.firing_no_owner", alert.Alertname, duration))
+		}
+	}
+
+	created := make([]string, 0, len(digest.SilencesCreated))
+	for _, silence := range digest.SilencesCreated {
+		line := l.T("digest.silence_created", silence.Alertname, silence.Actor)
+		if silence.Details != "" {
+			line += fmt.Sprintf(" (%s)", silence.Details)
+		}
+		created = append(created, line)
+	}
+
+	expiring := make([]string, 0, len(digest.SilencesExpiring))
+	for _, silence := range digest.SilencesExpiring {
+		expiring = append(expiring, l.T("digest.silence_expiring",
+			silence.ID,
+			silence.EndsAt.In(loc).Format("Mon 15:04 MST"),
+			silence.Comment,
+		))
+	}
+
+	total := len(digest.Stats.Incidents)
+	ackedPercent := 0.0
+	if total > 0 {
+		ackedPercent = float64(digest.Stats.Acked) * 100 / float64(total)
+	}
+
+	var fields []*model.SlackAttachmentField
+	fields = addFields(fields, l.T("digest.fired", sumCounts(digest.Fired)), formatRanking(rankCounts(digest.Fired, digestMaxListed), l, identity), true)
+	fields = addFields(fields, l.T("digest.resolved", sumCounts(digest.Resolved)), formatRanking(rankCounts(digest.Resolved, digestMaxListed), l, identity), true)
+	fields = addFields(fields, l.T("digest.firing", len(digest.Firing)), limitLines(firing, l), false)
+	fields = addFields(fields, l.T("digest.silences_created", len(created)), limitLines(created, l), true)
+	fields = addFields(fields, l.T("digest.silences_expiring", l.Duration(digestExpiringWithin), len(digest.SilencesExpiring)), limitLines(expiring, l), true)
+	fields = addFields(fields, l.T("digest.acks"), l.T("digest.acks_value",
+		digest.Stats.Acked,
+		total,
+		ackedPercent,
+		l.Duration(meanDuration(digest.Stats.TimeToAck)),
+	), false)
+
+	return &model.SlackAttachment{
+		Title: l.T("digest.title"),
+		Text: l.T("stats.period",
+			digest.Since.In(loc).Format("Mon Jan 2 15:04 MST"),
+			digest.Until.Format("Mon Jan 2 15:04 MST"),
+		),
+		Fields: fields,
+		Color:  colorDigest,
+	}
+}
+
+// postDigest posts the digest of the config for [since, until) in the config channel
+func (p *Plugin) postDigest(alertConfig alertConfig, since, until time.Time) error {
+	channelID := p.getChannelID(alertConfig.ID)
+	if channelID == "" {
+		return fmt.Errorf("no channel for config %s", alertConfig.ID)
+	}
+
+	histories, err := p.findAlertHistories(historyQuery{})
+	if err != nil {
+		return fmt.Errorf("failed to load alert history: %w", err)
+	}
+	digest := buildAlertDigest(histories, alertConfig, since, until)
+
+	if alertConfig.hasAlertmanager() {
+		silences, err := p.amClient.ListSilences(alertConfig.alertmanagerAPIURL())
+		if err != nil {
+			p.API.LogWarn("[DIGEST] Failed to list silences", "config_id", alertConfig.ID, "error", err.Error())
+		} else {
+			digest.SilencesExpiring = expiringSilences(silences, until, digestExpiringWithin)
+		}
+	}
+
+	post := &model.Post{
+		ChannelId: channelID,
+		UserId:    p.BotUserID,
+	}
+	model.ParseSlackAttachment(post, []*model.SlackAttachment{buildDigestAttachment(digest, configLocalizer(alertConfig))})
+	if _, appErr := p.API.CreatePost(post); appErr != nil {
+		return appErr
+	}
+
+	p.API.LogInfo("[DIGEST] Digest posted",
+		"config_id", alertConfig.ID,
+		"fired", sumCounts(digest.Fired),
+		"resolved", sumCounts(digest.Resolved),
+		"firing", len(digest.Firing),
+	)
+	return nil
+}
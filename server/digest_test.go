@@ -0,0 +1,65 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/alertmanager/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildAlertDigest(t *testing.T) {
+	since := time.Date(2024, 11, 21, 9, 0, 0, 0, time.UTC)
+	until := since.Add(24 * time.Hour)
+	at := func(hours int) int64 { return since.Add(time.Duration(hours) * time.Hour).UnixMilli() }
+
+	histories := []*alertHistory{
+		{
+			Fingerprint: "aaaaaaaaaaaaaaaa",
+			ConfigID:    "1",
+			Labels:      map[string]string{"alertname": "HighLatency"},
+			Events: []alertEvent{
+				{Type: eventFired, Timestamp: at(1)},
+				{Type: eventResolved, Timestamp: at(2)},
+			},
+		},
+		{
+			Fingerprint: "bbbbbbbbbbbbbbbb",
+			ConfigID:    "1",
+			Labels:      map[string]string{"alertname": "DiskFull"},
+			Events: []alertEvent{
+				{Type: eventFired, Timestamp: at(-48)},
+				{Type: eventAcked, Actor: "alice", Timestamp: at(3)},
+				{Type: eventSilenced, Actor: "alice", Details: "for 4h", Timestamp: at(4)},
+			},
+		},
+		{
+			Fingerprint: "cccccccccccccccc",
+			ConfigID:    "2",
+			Labels:      map[string]string{"alertname": "OtherChannel"},
+			Events:      []alertEvent{{Type: eventFired, Timestamp: at(1)}},
+		},
+	}
+
+	digest := buildAlertDigest(histories, alertConfig{ID: "1"}, since, until)
+	assert.Equal(t, map[string]int{"HighLatency": 1}, digest.Fired)
+	assert.Equal(t, map[string]int{"HighLatency": 1}, digest.Resolved)
+	require.Len(t, digest.Firing, 1)
+	assert.Equal(t, "DiskFull", digest.Firing[0].Alertname)
+	assert.Equal(t, "alice", digest.Firing[0].Owner)
+	assert.Equal(t, []createdSilence{{Alertname: "DiskFull", Actor: "alice", Details: "for 4h"}}, digest.SilencesCreated)
+	assert.Len(t, digest.Stats.Incidents, 1)
+
+	attachment := buildDigestAttachment(digest, newLocalizer(defaultLanguage))
+	assert.Contains(t, attachment.Fields[2].Value, "owner @alice")
+
+	silences := []types.Silence{
+		{ID: "soon", EndsAt: until.Add(time.Hour), Status: types.SilenceStatus{State: types.SilenceStateActive}},
+		{ID: "later", EndsAt: until.Add(48 * time.Hour), Status: types.SilenceStatus{State: types.SilenceStateActive}},
+		{ID: "expired", EndsAt: until.Add(-time.Hour), Status: types.SilenceStatus{State: types.SilenceStateExpired}},
+	}
+	expiring := expiringSilences(silences, until, digestExpiringWithin)
+	require.Len(t, expiring, 1)
+	assert.Equal(t, "soon", expiring[0].ID)
+}
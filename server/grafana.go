@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// grafanaAlertmanagerPath is the path of the Alertmanager API of Grafana managed alerts
+	grafanaAlertmanagerPath = "/api/alertmanager/grafana"
+	// grafanaTokenUser is the basic auth user Grafana accepts service account tokens with
+	grafanaTokenUser = "api_key"
+)
+
+// grafanaAlert holds the fields Grafana unified alerting adds to the webhook payload of an alert.
+// The fields of the notification are copied to each of its alerts.
+type grafanaAlert struct {
+	Values       map[string]float64 `json:"values,omitempty"`
+	ValueString  string             `json:"valueString,omitempty"`
+	DashboardURL string             `json:"dashboardURL,omitempty"`
+	PanelURL     string             `json:"panelURL,omitempty"`
+	SilenceURL   string             `json:"silenceURL,omitempty"`
+	ImageURL     string             `json:"imageURL,omitempty"`
+	OrgID        int64              `json:"orgId,omitempty"`
+	Title        string             `json:"title,omitempty"`
+	State        string             `json:"state,omitempty"`
+	Message      string             `json:"message,omitempty"`
+}
+
+// grafanaPayload is a Grafana webhook payload, decoded for the fields Alertmanager payloads lack
+type grafanaPayload struct {
+	OrgID   *int64 `json:"orgId"`
+	Title   string `json:"title"`
+	State   string `json:"state"`
+	Message string `json:"message"`
+	Alerts  []struct {
+		grafanaAlert
+		Fingerprint string `json:"fingerprint"`
+	} `json:"alerts"`
+}
+
+// isGrafana reports whether the payload comes from Grafana, which sets the organization of the alerts
+func (payload grafanaPayload) isGrafana() bool {
+	if payload.OrgID != nil {
+		return true
+	}
+	for _, alert := range payload.Alerts {
+		if alert.DashboardURL != "" || alert.PanelURL != "" || alert.SilenceURL != "" || alert.ValueString != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeGrafanaAlerts returns the Grafana fields of the alerts of a webhook payload by fingerprint,
+// nil when the config does not take Grafana payloads or the payload does not come from Grafana
+func decodeGrafanaAlerts(alertConfig alertConfig, data []byte) (map[string]grafanaAlert, error) {
+	if alertConfig.Source == sourceAlertmanager {
+		return nil, nil
+	}
+
+	var payload grafanaPayload
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return nil, err
+	}
+	if alertConfig.Source != sourceGrafana && !payload.isGrafana() {
+		return nil, nil
+	}
+
+	alerts := make(map[string]grafanaAlert, len(payload.Alerts))
+	for _, alert := range payload.Alerts {
+		if alert.Fingerprint == "" {
+			continue
+		}
+		ga := alert.grafanaAlert
+		if payload.OrgID != nil {
+			ga.OrgID = *payload.OrgID
+		}
+		ga.Title = payload.Title
+		ga.State = payload.State
+		ga.Message = payload.Message
+		alerts[alert.Fingerprint] = ga
+	}
+	return alerts, nil
+}
+
+// hasAlertmanager reports whether the config has an Alertmanager API for silences, alerts and
+// status. Mapping configs receive the alerts of other tools, which have none.
+func (ac alertConfig) hasAlertmanager() bool {
+	return ac.Source != sourceMapping
+}
+
+// alertmanagerAPIURL returns the base URL of the Alertmanager API of the config. Grafana configs
+// use the Alertmanager of Grafana managed alerts, authenticated with the service account token.
+func (ac alertConfig) alertmanagerAPIURL() string {
+	if ac.Source != sourceGrafana {
+		return ac.AlertManagerURL
+	}
+
+	u, err := url.Parse(ac.AlertManagerURL + grafanaAlertmanagerPath)
+	if err != nil {
+		return ac.AlertManagerURL + grafanaAlertmanagerPath
+	}
+	if ac.GrafanaToken != "" {
+		u.User = url.UserPassword(grafanaTokenUser, ac.GrafanaToken)
+	}
+	return u.String()
+}
+
+// formatGrafanaValues renders the values of the queries of a Grafana alert, e.g. "B=22, C=1"
+func formatGrafanaValues(values map[string]float64) string {
+	refIDs := make([]string, 0, len(values))
+	for refID := range values {
+		refIDs = append(refIDs, refID)
+	}
+	sort.Strings(refIDs)
+
+	pairs := make([]string, 0, len(refIDs))
+	for _, refID := range refIDs {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", refID, strconv.FormatFloat(values[refID], 'g', -1, 64)))
+	}
+	return strings.Join(pairs, ", ")
+}
+
+// formatGrafanaDetails renders the current values and the dashboard, panel and silence links of a
+// Grafana alert, one per line
+func formatGrafanaDetails(l localizer, ga grafanaAlert, firing bool) string {
+	var msg string
+	if firing && len(ga.Values) > 0 {
+		msg += fmt.Sprintf("**%s:** %s\n", l.T("grafana.values"), formatGrafanaValues(ga.Values))
+	}
+
+	var links []string
+	for _, link := range []struct{ id, url string }{
+		{id: "grafana.dashboard", url: ga.DashboardURL},
+		{id: "grafana.panel", url: ga.PanelURL},
+		{id: "grafana.silence", url: ga.SilenceURL},
+	} {
+		if link.url == "" || (link.id == "grafana.silence" && !firing) {
+			continue
+		}
+		links = append(links, fmt.Sprintf("[%s](%s)", l.T(link.id), link.url))
+	}
+	if len(links) > 0 {
+		msg += strings.Join(links, " · ") + "\n"
+	}
+	return msg
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/pluginapi/cluster"
+
+	"github.com/Kuzyashin/mattermost-plugin-alertmanager/server/alertmanager"
+)
+
+const (
+	healthKeyPrefix = "am_health_"
+	healthJobKey    = "am_health_job"
+	// healthCheckInterval is how often the AlertManagers of the configs are checked
+	healthCheckInterval = time.Minute
+
+	// Flap damping: the consecutive checks that must agree before a change is reported
+	healthDownChecks  = 3
+	healthUpChecks    = 2
+	healthPeersChecks = 3
+
+	healthDown           = "down"
+	healthUp             = "up"
+	healthPeersLost      = "peers_lost"
+	healthPeersChanged   = "peers_changed"
+	healthVersionChanged = "version_changed"
+)
+
+// healthObservation is the result of a health check of an AlertManager
+type healthObservation struct {
+	Up      bool   `json:"up"`
+	Reason  string `json:"reason,omitempty"`
+	Version string `json:"version,omitempty"`
+	Peers   int    `json:"peers"`
+}
+
+// healthState is the reported health of an AlertManager, stored per AlertManager URL
+type healthState struct {
+	// Stable is the health last reported, Since when its reachability last changed
+	Stable healthObservation `json:"stable"`
+	Since  int64             `json:"since"`
+	// Pending and PendingPeers count the consecutive checks that disagree with Stable
+	Pending      int `json:"pending,omitempty"`
+	PendingPeers int `json:"pending_peers,omitempty"`
+}
+
+// healthEvent is a change of the health of an AlertManager to report
+type healthEvent struct {
+	kind     string
+	previous healthObservation
+	current  healthObservation
+	// duration is how long the AlertManager was up before going down, or down before recovering
+	duration time.Duration
+}
+
+// observe applies a health check to the state and returns the changes to report. A change is
+// only reported once enough consecutive checks agree on it, so that a flapping instance does not
+// flood the channel.
+func (s *healthState) observe(obs healthObservation, now time.Time) []healthEvent {
+	if s.Since == 0 {
+		// The first check sets the baseline, an instance that is down right away is reported
+		// once the next checks confirm it
+		s.Since = now.UnixMilli()
+		s.Stable = healthObservation{Up: true}
+		if obs.Up {
+			s.Stable = obs
+			return nil
+		}
+	}
+
+	var events []healthEvent
+	if obs.Up != s.Stable.Up {
+		s.Pending++
+		needed := healthDownChecks
+		if obs.Up {
+			needed = healthUpChecks
+		}
+		if s.Pending < needed {
+			return nil
+		}
+
+		event := healthEvent{kind: healthDown, previous: s.Stable, current: obs, duration: now.Sub(time.UnixMilli(s.Since))}
+		if obs.Up {
+			event.kind = healthUp
+		}
+		events = append(events, event)
+		// Version and peers are kept, to report what changed while the instance was down
+		s.Stable.Up, s.Stable.Reason = obs.Up, obs.Reason
+		s.Since = now.UnixMilli()
+		s.Pending = 0
+	} else {
+		s.Pending = 0
+		if !obs.Up {
+			s.Stable.Reason = obs.Reason
+		}
+	}
+	if !obs.Up || !s.Stable.Up {
+		return events
+	}
+
+	if obs.Version != "" && obs.Version != s.Stable.Version {
+		if s.Stable.Version != "" {
+			events = append(events, healthEvent{kind: healthVersionChanged, previous: s.Stable, current: obs})
+		}
+		s.Stable.Version = obs.Version
+	}
+
+	if obs.Peers == s.Stable.Peers {
+		s.PendingPeers = 0
+		return events
+	}
+	s.PendingPeers++
+	if s.PendingPeers >= healthPeersChecks {
+		kind := healthPeersChanged
+		if obs.Peers < s.Stable.Peers {
+			kind = healthPeersLost
+		}
+		events = append(events, healthEvent{kind: kind, previous: s.Stable, current: obs})
+		s.Stable.Peers = obs.Peers
+		s.PendingPeers = 0
+	}
+	return events
+}
+
+func getHealthKey(apiURL string) string {
+	// KV keys are limited to 150 characters, the hash is 64
+	sum := sha256.Sum256([]byte(alertmanager.BaseURL(apiURL)))
+	return healthKeyPrefix + hex.EncodeToString(sum[:])
+}
+
+// checkAlertmanagerHealth checks the AlertManager of every config with HealthCheck once, and reports
+// the changes of their health. It runs on a single node of the cluster at a time.
+func (p *Plugin) checkAlertmanagerHealth() {
+	byURL := make(map[string][]alertConfig)
+	for _, alertConfig := range p.getConfiguration().AlertConfigs {
+		if alertConfig.HealthCheck && alertConfig.Source != sourceMapping {
+			apiURL := alertConfig.alertmanagerAPIURL()
+			byURL[apiURL] = append(byURL[apiURL], alertConfig)
+		}
+	}
+
+	now := time.Now()
+	for _, apiURL := range sortedKeys(byURL) {
+		configs := byURL[apiURL]
+		sort.Slice(configs, func(i, j int) bool { return configs[i].ID < configs[j].ID })
+
+		obs := observeAlertmanager(p.amClient, apiURL, configs[0].Source)
+		var events []healthEvent
+		err := p.updateKVAtomically(getHealthKey(apiURL), 0, func(oldValue []byte) ([]byte, error) {
+			var state healthState
+			if oldValue != nil {
+				if err := json.Unmarshal(oldValue, &state); err != nil {
+					return nil, err
+				}
+			}
+			events = state.observe(obs, now)
+			return json.Marshal(state)
+		})
+		if err != nil {
+			p.API.LogWarn("[HEALTH] Failed to record AlertManager health",
+				"alertmanager_url", configs[0].AlertManagerURL,
+				"error", err.Error(),
+			)
+			continue
+		}
+
+		for _, event := range events {
+			p.API.LogWarn("[HEALTH] AlertManager health changed",
+				"alertmanager_url", configs[0].AlertManagerURL,
+				"change", event.kind,
+				"reason", event.current.Reason,
+				"version", event.current.Version,
+				"peers", event.current.Peers,
+			)
+
+			// Configs sharing an AlertManager and a channel report the change once
+			posted := make(map[string]bool)
+			for _, alertConfig := range configs {
+				channelID := p.healthChannelID(alertConfig)
+				if channelID == "" || posted[channelID] {
+					continue
+				}
+				posted[channelID] = true
+
+				post := &model.Post{
+					ChannelId: channelID,
+					UserId:    p.BotUserID,
+				}
+				model.ParseSlackAttachment(post, []*model.SlackAttachment{buildHealthAttachment(alertConfig, event)})
+				if _, appErr := p.API.CreatePost(post); appErr != nil {
+					p.metrics.observeFailure(failureCreatePost)
+					p.API.LogError("[HEALTH] Failed to post AlertManager health change",
+						"config_id", alertConfig.ID,
+						"error", appErr.Error(),
+					)
+				}
+			}
+		}
+	}
+}
+
+// observeAlertmanager checks the health and readiness endpoints and the status API of an
+// AlertManager. Grafana has no health endpoints of its Alertmanager, only its status is checked.
+func observeAlertmanager(client *alertmanager.Client, apiURL, source string) healthObservation {
+	if source != sourceGrafana {
+		for _, path := range []string{"/-/healthy", "/-/ready"} {
+			if err := client.Probe(apiURL, path); err != nil {
+				return healthObservation{Reason: err.Error()}
+			}
+		}
+	}
+
+	status, err := client.Status(apiURL)
+	if err != nil {
+		return healthObservation{Reason: err.Error()}
+	}
+	return healthObservation{
+		Up:      true,
+		Version: status.VersionInfo.Version,
+		Peers:   len(status.Cluster.Peers),
+	}
+}
+
+// healthChannelID returns the channel of the health notifications of a config, HealthChannel in
+// the team of the config or the alert channel
+func (p *Plugin) healthChannelID(alertConfig alertConfig) string {
+	if alertConfig.HealthChannel == "" || alertConfig.HealthChannel == alertConfig.Channel {
+		return p.getChannelID(alertConfig.ID)
+	}
+
+	healthConfig := alertConfig
+	healthConfig.Channel = alertConfig.HealthChannel
+	channelID, err := p.ensureAlertChannelExists(healthConfig)
+	if err != nil {
+		p.API.LogWarn("[HEALTH] Failed to get the health channel",
+			"config_id", alertConfig.ID,
+			"channel", alertConfig.HealthChannel,
+			"error", err.Error(),
+		)
+		return ""
+	}
+	return channelID
+}
+
+// buildHealthAttachment describes a change of the health of the AlertManager of a config
+func buildHealthAttachment(alertConfig alertConfig, event healthEvent) *model.SlackAttachment {
+	l := configLocalizer(alertConfig)
+	url := alertConfig.AlertManagerURL
+
+	attachment := &model.SlackAttachment{Title: l.T("health." + event.kind + "_title")}
+	switch event.kind {
+	case healthDown:
+		attachment.Text = l.T("health.down_text", url, event.current.Reason)
+		attachment.Color = colorFiring
+	case healthUp:
+		attachment.Text = l.T("health.up_text", url, l.Duration(event.duration))
+		attachment.Color = colorResolved
+	case healthPeersLost:
+		attachment.Text = l.T("health.peers_text", url, event.current.Peers, event.previous.Peers)
+		attachment.Color = colorError
+	case healthPeersChanged:
+		attachment.Text = l.T("health.peers_text", url, event.current.Peers, event.previous.Peers)
+		attachment.Color = colorResolved
+	case healthVersionChanged:
+		attachment.Text = l.T("health.version_text", url, event.current.Version, event.previous.Version)
+		attachment.Color = colorInfo
+	default:
+		attachment.Text = fmt.Sprintf("%s: %s", url, event.kind)
+	}
+	return attachment
+}
+
+func (p *Plugin) startHealthJob() {
+	job, err := cluster.Schedule(p.API, healthJobKey, cluster.MakeWaitForRoundedInterval(healthCheckInterval), p.checkAlertmanagerHealth)
+	if err != nil {
+		p.API.LogError("Failed to schedule the AlertManager health job", "error", err.Error())
+		return
+	}
+	p.healthJob = job
+}
+
+func (p *Plugin) stopHealthJob() {
+	if p.healthJob == nil {
+		return
+	}
+	if err := p.healthJob.Close(); err != nil {
+		p.API.LogWarn("Failed to stop the AlertManager health job", "error", err.Error())
+	}
+	p.healthJob = nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHealthStateObserveDamping(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	up := healthObservation{Up: true, Version: "0.27.0", Peers: 2}
+	down := healthObservation{Reason: "connection refused"}
+
+	var state healthState
+	assert.Empty(t, state.observe(up, now), "the first check sets the baseline")
+
+	// A single failed check in between good ones is not reported
+	assert.Empty(t, state.observe(down, now.Add(time.Minute)))
+	assert.Empty(t, state.observe(up, now.Add(2*time.Minute)))
+
+	assert.Empty(t, state.observe(down, now.Add(3*time.Minute)))
+	assert.Empty(t, state.observe(down, now.Add(4*time.Minute)))
+	events := state.observe(down, now.Add(5*time.Minute))
+	require.Len(t, events, 1)
+	assert.Equal(t, healthDown, events[0].kind)
+	assert.Equal(t, "connection refused", events[0].current.Reason)
+	assert.Empty(t, state.observe(down, now.Add(6*time.Minute)), "a down instance is reported once")
+
+	assert.Empty(t, state.observe(up, now.Add(7*time.Minute)))
+	events = state.observe(up, now.Add(8*time.Minute))
+	require.Len(t, events, 1)
+	assert.Equal(t, healthUp, events[0].kind)
+	assert.Equal(t, 3*time.Minute, events[0].duration)
+}
+
+func TestHealthStateObserveDownAtStart(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	down := healthObservation{Reason: "timeout"}
+
+	var state healthState
+	assert.Empty(t, state.observe(down, now))
+	assert.Empty(t, state.observe(down, now.Add(time.Minute)))
+	events := state.observe(down, now.Add(2*time.Minute))
+	require.Len(t, events, 1)
+	assert.Equal(t, healthDown, events[0].kind)
+}
+
+func TestHealthStateObservePeersAndVersion(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	var state healthState
+	assert.Empty(t, state.observe(healthObservation{Up: true, Version: "0.27.0", Peers: 3}, now))
+
+	events := state.observe(healthObservation{Up: true, Version: "0.28.0", Peers: 3}, now.Add(time.Minute))
+	require.Len(t, events, 1)
+	assert.Equal(t, healthVersionChanged, events[0].kind)
+	assert.Equal(t, "0.27.0", events[0].previous.Version)
+	assert.Equal(t, "0.28.0", events[0].current.Version)
+
+	// A peer dropping out for a single check is not reported
+	assert.Empty(t, state.observe(healthObservation{Up: true, Version: "0.28.0", Peers: 2}, now.Add(2*time.Minute)))
+	assert.Empty(t, state.observe(healthObservation{Up: true, Version: "0.28.0", Peers: 3}, now.Add(3*time.Minute)))
+
+	var kinds []string
+	for i := 4; i < 7; i++ {
+		for _, event := range state.observe(healthObservation{Up: true, Version: "0.28.0", Peers: 1}, now.Add(time.Duration(i)*time.Minute)) {
+			kinds = append(kinds, event.kind)
+		}
+	}
+	assert.Equal(t, []string{healthPeersLost}, kinds)
+	assert.Equal(t, 1, state.Stable.Peers)
+}
+
+func TestBuildHealthAttachment(t *testing.T) {
+	ac := alertConfig{AlertManagerURL: "http://alertmanager:9093"}
+
+	attachment := buildHealthAttachment(ac, healthEvent{kind: healthDown, current: healthObservation{Reason: "connection refused"}})
+	assert.Equal(t, "🔴 AlertManager unreachable", attachment.Title)
+	assert.Equal(t, "http://alertmanager:9093 fails its health checks: connection refused", attachment.Text)
+	assert.Equal(t, colorFiring, attachment.Color)
+
+	attachment = buildHealthAttachment(ac, healthEvent{kind: healthPeersLost, previous: healthObservation{Peers: 3}, current: healthObservation{Peers: 1}})
+	assert.Equal(t, "http://alertmanager:9093 has 1 cluster peers, 3 before.", attachment.Text)
+	assert.Equal(t, colorError, attachment.Color)
+
+	attachment = buildHealthAttachment(ac, healthEvent{kind: healthVersionChanged, previous: healthObservation{Version: "0.27.0"}, current: healthObservation{Version: "0.28.0"}})
+	assert.Equal(t, "http://alertmanager:9093 runs version 0.28.0, 0.27.0 before.", attachment.Text)
+
+	ac.Source, ac.HealthCheck = sourceMapping, true
+	assert.Error(t, ac.validate(nil))
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/pluginapi/cluster"
+	"github.com/prometheus/alertmanager/pkg/labels"
+	"github.com/prometheus/alertmanager/template"
+)
+
+const (
+	heartbeatKeyPrefix = "heartbeat_"
+	heartbeatJobKey    = "heartbeat_job"
+	// heartbeatCheckInterval is how often the heartbeats of the configs are checked
+	heartbeatCheckInterval = time.Minute
+)
+
+// heartbeatState is the dead man's switch of a config, stored per config
+type heartbeatState struct {
+	// Since is when the heartbeat started being monitored, LastSeen when it last arrived
+	Since    int64 `json:"since"`
+	LastSeen int64 `json:"last_seen,omitempty"`
+	// BrokenSince is set while the pipeline is reported broken
+	BrokenSince int64 `json:"broken_since,omitempty"`
+}
+
+// lastAlive returns when the pipeline was last known to work
+func (s heartbeatState) lastAlive() time.Time {
+	return time.UnixMilli(max(s.Since, s.LastSeen))
+}
+
+func getHeartbeatKey(configID string) string {
+	return heartbeatKeyPrefix + configID
+}
+
+// heartbeatSettings returns the parsed heartbeat settings of the config, the interval is 0 when
+// the heartbeat is not monitored
+func (ac alertConfig) heartbeatSettings() (matchers labels.Matchers, interval, grace time.Duration, err error) {
+	if ac.HeartbeatMatchers == "" {
+		return nil, 0, 0, nil
+	}
+
+	if matchers, err = labels.ParseMatchers(ac.HeartbeatMatchers); err != nil {
+		return nil, 0, 0, fmt.Errorf("invalid HeartbeatMatchers: %w", err)
+	}
+	if len(matchers) == 0 {
+		return nil, 0, 0, errors.New("HeartbeatMatchers selects every alert")
+	}
+	if interval, err = time.ParseDuration(ac.HeartbeatInterval); err != nil || interval <= 0 {
+		return nil, 0, 0, fmt.Errorf("HeartbeatInterval %q must be a positive duration like 5m", ac.HeartbeatInterval)
+	}
+	grace = interval
+	if ac.HeartbeatGrace != "" {
+		if grace, err = time.ParseDuration(ac.HeartbeatGrace); err != nil || grace < 0 {
+			return nil, 0, 0, fmt.Errorf("HeartbeatGrace %q must be a duration like 2m", ac.HeartbeatGrace)
+		}
+	}
+	return matchers, interval, grace, nil
+}
+
+// isHeartbeat reports whether the alert is the heartbeat of the config
+func (m *configMatchers) isHeartbeat(alert template.Alert) bool {
+	if m.heartbeat == nil {
+		return false
+	}
+	for _, matcher := range m.heartbeat {
+		if !matcher.Matches(alert.Labels[matcher.Name]) {
+			return false
+		}
+	}
+	return true
+}
+
+// recordHeartbeat records that the heartbeat of the config arrived, and reports the recovery of
+// the pipeline when it was reported broken
+func (p *Plugin) recordHeartbeat(alertConfig alertConfig, channelID string, now time.Time) {
+	var previous heartbeatState
+	err := p.updateKVAtomically(getHeartbeatKey(alertConfig.ID), 0, func(oldValue []byte) ([]byte, error) {
+		var state heartbeatState
+		if oldValue != nil {
+			if err := json.Unmarshal(oldValue, &state); err != nil {
+				return nil, err
+			}
+		}
+		previous = state
+		if state.Since == 0 {
+			state.Since = now.UnixMilli()
+		}
+		state.LastSeen = now.UnixMilli()
+		state.BrokenSince = 0
+		return json.Marshal(state)
+	})
+	if err != nil {
+		p.API.LogWarn("[HEARTBEAT] Failed to record heartbeat",
+			"config_id", alertConfig.ID,
+			"error", err.Error(),
+		)
+		return
+	}
+
+	if previous.BrokenSince != 0 {
+		p.API.LogInfo("[HEARTBEAT] Heartbeat resumed",
+			"config_id", alertConfig.ID,
+			"missing_for", now.Sub(previous.lastAlive()).String(),
+		)
+		p.postHeartbeat(alertConfig, channelID, buildHeartbeatAttachment(alertConfig, previous, false, now), "")
+	}
+}
+
+// checkHeartbeats reports the configs whose heartbeat did not arrive in time. It runs on a single
+// node of the cluster at a time.
+func (p *Plugin) checkHeartbeats() {
+	now := time.Now()
+	for _, alertConfig := range p.getConfiguration().AlertConfigs {
+		_, interval, grace, err := alertConfig.heartbeatSettings()
+		if err != nil || interval == 0 {
+			// Forget the state, so that monitoring starts afresh when the heartbeat is set again
+			_ = p.API.KVDelete(getHeartbeatKey(alertConfig.ID))
+			continue
+		}
+
+		var state heartbeatState
+		broken := false
+		err = p.updateKVAtomically(getHeartbeatKey(alertConfig.ID), 0, func(oldValue []byte) ([]byte, error) {
+			state = heartbeatState{Since: now.UnixMilli()}
+			if oldValue != nil {
+				if err := json.Unmarshal(oldValue, &state); err != nil {
+					return nil, err
+				}
+			}
+			broken = state.BrokenSince == 0 && now.Sub(state.lastAlive()) > interval+grace
+			if broken {
+				state.BrokenSince = now.UnixMilli()
+			}
+			return json.Marshal(state)
+		})
+		if err != nil {
+			p.API.LogWarn("[HEARTBEAT] Failed to check heartbeat",
+				"config_id", alertConfig.ID,
+				"error", err.Error(),
+			)
+			continue
+		}
+		if !broken {
+			continue
+		}
+
+		channelID := p.getChannelID(alertConfig.ID)
+		p.API.LogError("[HEARTBEAT] Heartbeat missing, the alerting pipeline appears broken",
+			"config_id", alertConfig.ID,
+			"channel_id", channelID,
+			"missing_for", now.Sub(state.lastAlive()).String(),
+		)
+		if channelID == "" {
+			continue
+		}
+		p.postHeartbeat(alertConfig, channelID, buildHeartbeatAttachment(alertConfig, state, true, now), severityMentions(alertConfig, "critical"))
+	}
+}
+
+func (p *Plugin) postHeartbeat(alertConfig alertConfig, channelID string, attachment *model.SlackAttachment, message string) {
+	post := &model.Post{
+		ChannelId: channelID,
+		UserId:    p.BotUserID,
+		Message:   message,
+	}
+	model.ParseSlackAttachment(post, []*model.SlackAttachment{attachment})
+	if _, appErr := p.API.CreatePost(post); appErr != nil {
+		p.metrics.observeFailure(failureCreatePost)
+		p.API.LogError("[HEARTBEAT] Failed to post heartbeat status",
+			"config_id", alertConfig.ID,
+			"error", appErr.Error(),
+		)
+	}
+}
+
+// buildHeartbeatAttachment describes a broken pipeline, or its recovery
+func buildHeartbeatAttachment(alertConfig alertConfig, state heartbeatState, broken bool, now time.Time) *model.SlackAttachment {
+	l := configLocalizer(alertConfig)
+	loc := mustDisplayLocation(alertConfig)
+	_, interval, _, _ := alertConfig.heartbeatSettings()
+
+	lastSeen := l.T("heartbeat.never")
+	if state.LastSeen != 0 {
+		lastSeen = formatAlertTime(time.UnixMilli(state.LastSeen), loc)
+	}
+
+	var fields []*model.SlackAttachmentField
+	fields = addFields(fields, l.T("heartbeat.matchers"), fmt.Sprintf("`%s`", alertConfig.HeartbeatMatchers), true)
+	fields = addFields(fields, l.T("heartbeat.last_seen"), lastSeen, true)
+
+	missing := l.Duration(now.Sub(state.lastAlive()))
+	if !broken {
+		return &model.SlackAttachment{
+			Title:  l.T("heartbeat.recovered_title"),
+			Text:   l.T("heartbeat.recovered_text", missing),
+			Color:  colorResolved,
+			Fields: fields,
+		}
+	}
+	return &model.SlackAttachment{
+		Title:  l.T("heartbeat.broken_title"),
+		Text:   l.T("heartbeat.broken_text", missing, l.Duration(interval)),
+		Color:  colorFiring,
+		Fields: fields,
+	}
+}
+
+func (p *Plugin) startHeartbeatJob() {
+	job, err := cluster.Schedule(p.API, heartbeatJobKey, cluster.MakeWaitForRoundedInterval(heartbeatCheckInterval), p.checkHeartbeats)
+	if err != nil {
+		p.API.LogError("Failed to schedule the heartbeat job", "error", err.Error())
+		return
+	}
+	p.heartbeatJob = job
+}
+
+func (p *Plugin) stopHeartbeatJob() {
+	if p.heartbeatJob == nil {
+		return
+	}
+	if err := p.heartbeatJob.Close(); err != nil {
+		p.API.LogWarn("Failed to stop the heartbeat job", "error", err.Error())
+	}
+	p.heartbeatJob = nil
+}
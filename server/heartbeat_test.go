@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/alertmanager/template"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHeartbeatSettings(t *testing.T) {
+	ac := alertConfig{HeartbeatMatchers: `alertname="Watchdog"`, HeartbeatInterval: "5m"}
+	_, interval, grace, err := ac.heartbeatSettings()
+	require.NoError(t, err)
+	assert.Equal(t, 5*time.Minute, interval)
+	assert.Equal(t, 5*time.Minute, grace, "the grace period defaults to the interval")
+
+	assert.True(t, parseConfigMatchers(ac).isHeartbeat(template.Alert{Labels: template.KV{"alertname": "Watchdog", "severity": "none"}}))
+	assert.False(t, parseConfigMatchers(ac).isHeartbeat(template.Alert{Labels: template.KV{"alertname": "HighCPU"}}))
+	assert.False(t, parseConfigMatchers(alertConfig{}).isHeartbeat(template.Alert{Labels: template.KV{"alertname": "Watchdog"}}))
+
+	for _, invalid := range []alertConfig{
+		{HeartbeatMatchers: `alertname="Watchdog"`},
+		{HeartbeatMatchers: `alertname="Watchdog"`, HeartbeatInterval: "5m", HeartbeatGrace: "soon"},
+		{HeartbeatMatchers: `alertname=~"("`, HeartbeatInterval: "5m"},
+	} {
+		_, _, _, err := invalid.heartbeatSettings()
+		assert.Error(t, err, invalid.HeartbeatMatchers)
+		assert.False(t, parseConfigMatchers(invalid).isHeartbeat(template.Alert{Labels: template.KV{"alertname": "Watchdog"}}))
+	}
+}
+
+func TestBuildHeartbeatAttachment(t *testing.T) {
+	ac := alertConfig{HeartbeatMatchers: `alertname="Watchdog"`, HeartbeatInterval: "1m", HeartbeatGrace: "30s"}
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	state := heartbeatState{Since: now.Add(-time.Hour).UnixMilli(), LastSeen: now.Add(-10 * time.Minute).UnixMilli()}
+
+	broken := buildHeartbeatAttachment(ac, state, true, now)
+	assert.Equal(t, "🚨 Alerting pipeline appears broken", broken.Title)
+	assert.Contains(t, broken.Text, "for 10 minutes, it is expected every 1 minute")
+	assert.Equal(t, colorFiring, broken.Color)
+	assert.Equal(t, "Mon, 01 Jan 2024 11:50:00 UTC", broken.Fields[1].Value)
+
+	recovered := buildHeartbeatAttachment(ac, heartbeatState{Since: now.Add(-3 * time.Minute).UnixMilli()}, false, now)
+	assert.Equal(t, colorResolved, recovered.Color)
+	assert.Contains(t, recovered.Text, "after 3 minutes without them")
+	assert.Equal(t, "never", recovered.Fields[1].Value)
+}
@@ -0,0 +1,564 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/alertmanager/template"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+const (
+	alertHistoryKeyPrefix = "alert_history_"
+	silenceAlertKeyPrefix = "silence_alert_"
+	// alertHistoryIndexKeyPrefix prefixes the shards of the index mapping the fingerprints of the
+	// recorded timelines to their alertname, so that lookups read the timelines without scanning
+	// the KV store. Fingerprints are spread over the shards to keep concurrent updates apart.
+	alertHistoryIndexKeyPrefix = "history_index_"
+	// legacyAlertHistoryIndexKey is the unsharded index of earlier versions, replaced by the shards
+	legacyAlertHistoryIndexKey = "history_index"
+	// alertHistoryIndexedKey marks that the timelines recorded before the shards existed were indexed
+	alertHistoryIndexedKey  = "history_indexed"
+	alertHistoryIndexShards = 16
+	// alertHistoryIndexRefresh is how often the index entry of an active timeline is extended.
+	// Entries are pruned that much after their expiry, timelines outlive their entry by less.
+	alertHistoryIndexRefresh = 24 * time.Hour
+
+	// defaultHistoryRetentionDays applies when a config does not set HistoryRetentionDays
+	defaultHistoryRetentionDays = 30
+	// historyMaxEvents caps the timeline of a single alert, oldest events are dropped first
+	historyMaxEvents = 200
+	// historyMaxResults is the number of timelines shown by /alertmanager history
+	historyMaxResults = 5
+	// kvAtomicRetries bounds the compare-and-set attempts of atomic KV updates
+	kvAtomicRetries = 5
+
+	eventFired          = "fired"
+	eventRepeat         = "repeat"
+	eventAcked          = "acked"
+	eventUnacked        = "unacked"
+	eventSilenced       = "silenced"
+	eventSilenceExpired = "silence_expired"
+	eventEscalated      = "escalated"
+	eventResolved       = "resolved"
+)
+
+var fingerprintRegexp = regexp.MustCompile(`^[0-9a-f]{16}$`)
+
+// alertEvent is a single entry of an alert timeline
+type alertEvent struct {
+	Type      string `json:"type"`
+	ActorID   string `json:"actor_id,omitempty"`
+	Actor     string `json:"actor,omitempty"`
+	PostID    string `json:"post_id,omitempty"`
+	Details   string `json:"details,omitempty"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// alertHistory is the persisted timeline of an alert, keyed by fingerprint
+type alertHistory struct {
+	Labels      map[string]string `json:"labels"`
+	Fingerprint string            `json:"fingerprint"`
+	ConfigID    string            `json:"config_id"`
+	PostID      string            `json:"post_id,omitempty"`
+	Events      []alertEvent      `json:"events"`
+	// IndexedUntil is the expiry of the index entry of the timeline
+	IndexedUntil int64 `json:"indexed_until,omitempty"`
+}
+
+// alertHistoryIndexEntry is the entry of a timeline in the index
+type alertHistoryIndexEntry struct {
+	Alertname string `json:"alertname"`
+	ExpiresAt int64  `json:"expires_at"`
+}
+
+func getAlertHistoryKey(fingerprint string) string {
+	return alertHistoryKeyPrefix + fingerprint
+}
+
+// getAlertHistoryIndexKey returns the index shard of a fingerprint
+func getAlertHistoryIndexKey(fingerprint string) string {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(fingerprint))
+	return fmt.Sprintf("%s%x", alertHistoryIndexKeyPrefix, h.Sum32()%alertHistoryIndexShards)
+}
+
+func getSilenceAlertKey(silenceID string) string {
+	return silenceAlertKeyPrefix + silenceID
+}
+
+func historyRetention(alertConfig alertConfig) time.Duration {
+	days := alertConfig.HistoryRetentionDays
+	if days <= 0 {
+		days = defaultHistoryRetentionDays
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// updateKVAtomically applies update to the value of key with compare-and-set
+// semantics, retrying when the value changed concurrently.
+func (p *Plugin) updateKVAtomically(key string, ttl time.Duration, update func(oldValue []byte) ([]byte, error)) error {
+	for i := 0; i < kvAtomicRetries; i++ {
+		oldValue, appErr := p.API.KVGet(key)
+		if appErr != nil {
+			return appErr
+		}
+
+		newValue, err := update(oldValue)
+		if err != nil {
+			return err
+		}
+
+		stored, appErr := p.API.KVSetWithOptions(key, newValue, model.PluginKVSetOptions{
+			Atomic:          true,
+			OldValue:        oldValue,
+			ExpireInSeconds: int64(ttl.Seconds()),
+		})
+		if appErr != nil {
+			return appErr
+		}
+		if stored {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("failed to update %s: too many concurrent updates", key)
+}
+
+// recordAlertEvent appends an event to the timeline of the alert. Failures are
+// logged only, the timeline must never block alert delivery.
+func (p *Plugin) recordAlertEvent(alertConfig alertConfig, fingerprint string, labels map[string]string, event alertEvent) {
+	if fingerprint == "" {
+		return
+	}
+	if event.Timestamp == 0 {
+		event.Timestamp = model.GetMillis()
+	}
+
+	retention := historyRetention(alertConfig)
+	var indexed *alertHistoryIndexEntry
+	err := p.updateKVAtomically(getAlertHistoryKey(fingerprint), retention, func(oldValue []byte) ([]byte, error) {
+		indexed = nil
+		history := alertHistory{
+			Fingerprint: fingerprint,
+			ConfigID:    alertConfig.ID,
+		}
+		if oldValue != nil {
+			if err := json.Unmarshal(oldValue, &history); err != nil {
+				return nil, err
+			}
+		}
+
+		if len(labels) > 0 {
+			history.Labels = labels
+		}
+		if event.Type == eventFired && event.PostID != "" {
+			history.PostID = event.PostID
+		}
+
+		history.Events = append(history.Events, event)
+		if len(history.Events) > historyMaxEvents {
+			history.Events = history.Events[len(history.Events)-historyMaxEvents:]
+		}
+
+		// Every event extends the retention of the timeline, its index entry is only extended
+		// once per refresh interval to keep the writes to the index shards rare
+		if expiresAt := event.Timestamp + retention.Milliseconds(); history.IndexedUntil < expiresAt-alertHistoryIndexRefresh.Milliseconds() {
+			history.IndexedUntil = expiresAt
+			indexed = &alertHistoryIndexEntry{Alertname: history.Labels["alertname"], ExpiresAt: expiresAt}
+		}
+
+		return json.Marshal(history)
+	})
+	if err != nil {
+		p.API.LogWarn("[HISTORY] Failed to record alert event",
+			"fingerprint", fingerprint,
+			"event", event.Type,
+			"error", err.Error(),
+		)
+		return
+	}
+
+	if indexed != nil {
+		if err := p.updateAlertHistoryIndex(map[string]alertHistoryIndexEntry{fingerprint: *indexed}, nil); err != nil {
+			p.API.LogWarn("[HISTORY] Failed to index alert timeline",
+				"fingerprint", fingerprint,
+				"error", err.Error(),
+			)
+		}
+	}
+}
+
+// getAlertHistoryIndex returns the index entries of the recorded timelines by fingerprint, found is
+// false until the timelines recorded before the index were added to it
+func (p *Plugin) getAlertHistoryIndex() (index map[string]alertHistoryIndexEntry, found bool, err error) {
+	marker, appErr := p.API.KVGet(alertHistoryIndexedKey)
+	if appErr != nil {
+		return nil, false, appErr
+	}
+	if marker == nil {
+		return nil, false, nil
+	}
+
+	index = make(map[string]alertHistoryIndexEntry)
+	for shard := 0; shard < alertHistoryIndexShards; shard++ {
+		data, appErr := p.API.KVGet(fmt.Sprintf("%s%x", alertHistoryIndexKeyPrefix, shard))
+		if appErr != nil {
+			return nil, false, appErr
+		}
+		if data == nil {
+			continue
+		}
+		var entries map[string]alertHistoryIndexEntry
+		if err := json.Unmarshal(data, &entries); err != nil {
+			return nil, false, err
+		}
+		for fingerprint, entry := range entries {
+			index[fingerprint] = entry
+		}
+	}
+	return index, true, nil
+}
+
+// updateAlertHistoryIndex adds and removes timelines of the index atomically. Every shard written
+// drops its expired entries, so that the index does not grow with the fingerprints ever seen.
+func (p *Plugin) updateAlertHistoryIndex(add map[string]alertHistoryIndexEntry, remove []string) error {
+	type shardChanges struct {
+		add    map[string]alertHistoryIndexEntry
+		remove []string
+	}
+	shards := make(map[string]*shardChanges)
+	changes := func(fingerprint string) *shardChanges {
+		key := getAlertHistoryIndexKey(fingerprint)
+		if shards[key] == nil {
+			shards[key] = &shardChanges{add: make(map[string]alertHistoryIndexEntry)}
+		}
+		return shards[key]
+	}
+	for fingerprint, entry := range add {
+		changes(fingerprint).add[fingerprint] = entry
+	}
+	for _, fingerprint := range remove {
+		changes(fingerprint).remove = append(changes(fingerprint).remove, fingerprint)
+	}
+
+	for _, key := range sortedKeys(shards) {
+		shard := shards[key]
+		err := p.updateKVAtomically(key, 0, func(oldValue []byte) ([]byte, error) {
+			entries := make(map[string]alertHistoryIndexEntry)
+			if oldValue != nil {
+				if err := json.Unmarshal(oldValue, &entries); err != nil {
+					return nil, err
+				}
+			}
+			return json.Marshal(applyAlertHistoryIndex(entries, shard.add, shard.remove, time.Now()))
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyAlertHistoryIndex applies the changes to the entries of an index shard and drops the entries
+// that expired
+func applyAlertHistoryIndex(entries, add map[string]alertHistoryIndexEntry, remove []string, now time.Time) map[string]alertHistoryIndexEntry {
+	for fingerprint, entry := range add {
+		entries[fingerprint] = entry
+	}
+	for _, fingerprint := range remove {
+		delete(entries, fingerprint)
+	}
+	expiredBefore := now.Add(-alertHistoryIndexRefresh).UnixMilli()
+	for fingerprint, entry := range entries {
+		if entry.ExpiresAt < expiredBefore {
+			delete(entries, fingerprint)
+		}
+	}
+	return entries
+}
+
+// indexLegacyAlertHistories adds the timelines recorded before the index shards existed to them. It
+// scans the KV store once, later lookups find the marker and read the shards.
+func (p *Plugin) indexLegacyAlertHistories() (map[string]alertHistoryIndexEntry, error) {
+	configuration := p.getConfiguration()
+	index := make(map[string]alertHistoryIndexEntry)
+	for page := 0; ; page++ {
+		keys, appErr := p.API.KVList(page, 200)
+		if appErr != nil {
+			return nil, appErr
+		}
+		for _, key := range keys {
+			if !strings.HasPrefix(key, alertHistoryKeyPrefix) {
+				continue
+			}
+			history, err := p.getAlertHistory(strings.TrimPrefix(key, alertHistoryKeyPrefix))
+			if err != nil || history == nil {
+				continue
+			}
+			index[history.Fingerprint] = alertHistoryIndexEntry{
+				Alertname: history.Labels["alertname"],
+				ExpiresAt: lastEventAt(history) + historyRetention(configuration.AlertConfigs[history.ConfigID]).Milliseconds(),
+			}
+		}
+		if len(keys) < 200 {
+			break
+		}
+	}
+
+	if err := p.updateAlertHistoryIndex(index, nil); err != nil {
+		return nil, err
+	}
+	if appErr := p.API.KVSet(alertHistoryIndexedKey, []byte("1")); appErr != nil {
+		return nil, appErr
+	}
+	if appErr := p.API.KVDelete(legacyAlertHistoryIndexKey); appErr != nil {
+		p.API.LogWarn("[HISTORY] Failed to delete the unsharded history index", "error", appErr.Error())
+	}
+	return index, nil
+}
+
+// recordAlertEventFromAlert is a shortcut for webhook-driven events
+func (p *Plugin) recordAlertEventFromAlert(alertConfig alertConfig, alert template.Alert, eventType, postID string) {
+	p.recordAlertEvent(alertConfig, alert.Fingerprint, alert.Labels, alertEvent{
+		Type:   eventType,
+		PostID: postID,
+	})
+}
+
+func (p *Plugin) getAlertHistory(fingerprint string) (*alertHistory, error) {
+	data, appErr := p.API.KVGet(getAlertHistoryKey(fingerprint))
+	if appErr != nil {
+		return nil, appErr
+	}
+	if data == nil {
+		return nil, nil
+	}
+
+	var history alertHistory
+	if err := json.Unmarshal(data, &history); err != nil {
+		return nil, err
+	}
+	return &history, nil
+}
+
+// saveSilenceAlert remembers which alert a silence was created for, so that
+// expiring the silence can be recorded in the alert timeline.
+func (p *Plugin) saveSilenceAlert(alertConfig alertConfig, silenceID, fingerprint string) {
+	appErr := p.API.KVSetWithExpiry(getSilenceAlertKey(silenceID), []byte(fingerprint), int64(historyRetention(alertConfig).Seconds()))
+	if appErr != nil {
+		p.API.LogWarn("[HISTORY] Failed to save silence to alert mapping",
+			"silence_id", silenceID,
+			"fingerprint", fingerprint,
+			"error", appErr.Error(),
+		)
+	}
+}
+
+func (p *Plugin) getSilenceAlert(silenceID string) string {
+	data, appErr := p.API.KVGet(getSilenceAlertKey(silenceID))
+	if appErr != nil || data == nil {
+		return ""
+	}
+	return string(data)
+}
+
+// historyQuery selects alert timelines by fingerprint, label matchers or alertname
+type historyQuery struct {
+	labels      map[string]string
+	fingerprint string
+	alertname   string
+}
+
+// parseHistoryQuery parses "<fingerprint>", "<alertname>" or "name=value[,name=value...]"
+func parseHistoryQuery(query string) (historyQuery, error) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return historyQuery{}, errors.New("missing query")
+	}
+
+	if !strings.Contains(query, "=") {
+		if fingerprintRegexp.MatchString(query) {
+			return historyQuery{fingerprint: query}, nil
+		}
+		return historyQuery{alertname: query}, nil
+	}
+
+	labels := make(map[string]string)
+	for _, matcher := range strings.FieldsFunc(strings.Trim(query, "{}"), func(r rune) bool { return r == ',' || r == ' ' }) {
+		name, value, ok := strings.Cut(matcher, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return historyQuery{}, fmt.Errorf("invalid label matcher %q", matcher)
+		}
+		labels[name] = strings.Trim(strings.TrimSpace(value), `"'`)
+	}
+	return historyQuery{labels: labels}, nil
+}
+
+func (q historyQuery) matches(history *alertHistory) bool {
+	if q.fingerprint != "" {
+		return history.Fingerprint == q.fingerprint
+	}
+	if q.alertname != "" {
+		return history.Labels["alertname"] == q.alertname
+	}
+	for name, value := range q.labels {
+		if history.Labels[name] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// candidates returns the fingerprints of the index whose timelines may match the query. Timelines
+// indexed without an alertname are always read.
+func (q historyQuery) candidates(index map[string]alertHistoryIndexEntry) []string {
+	fingerprints := make([]string, 0, len(index))
+	for _, fingerprint := range sortedKeys(index) {
+		if alertname := index[fingerprint].Alertname; q.alertname != "" && alertname != "" && alertname != q.alertname {
+			continue
+		}
+		fingerprints = append(fingerprints, fingerprint)
+	}
+	return fingerprints
+}
+
+// findAlertHistories returns the matching timelines, most recently updated first
+func (p *Plugin) findAlertHistories(query historyQuery) ([]*alertHistory, error) {
+	if query.fingerprint != "" {
+		history, err := p.getAlertHistory(query.fingerprint)
+		if err != nil || history == nil {
+			return nil, err
+		}
+		return []*alertHistory{history}, nil
+	}
+
+	index, found, err := p.getAlertHistoryIndex()
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		if index, err = p.indexLegacyAlertHistories(); err != nil {
+			return nil, err
+		}
+	}
+
+	// Label queries read every indexed timeline, alertname queries only the timelines of the alertname
+	var histories []*alertHistory
+	var expired []string
+	for _, fingerprint := range query.candidates(index) {
+		history, err := p.getAlertHistory(fingerprint)
+		if err != nil {
+			continue
+		}
+		if history == nil {
+			expired = append(expired, fingerprint)
+			continue
+		}
+		if len(history.Events) > 0 && query.matches(history) {
+			histories = append(histories, history)
+		}
+	}
+
+	if len(expired) > 0 {
+		if err := p.updateAlertHistoryIndex(nil, expired); err != nil {
+			p.API.LogWarn("[HISTORY] Failed to prune expired timelines from the index", "error", err.Error())
+		}
+	}
+
+	sort.Slice(histories, func(i, j int) bool {
+		return lastEventAt(histories[i]) > lastEventAt(histories[j])
+	})
+	return histories, nil
+}
+
+func lastEventAt(history *alertHistory) int64 {
+	if len(history.Events) == 0 {
+		return 0
+	}
+	return history.Events[len(history.Events)-1].Timestamp
+}
+
+func eventEmoji(eventType string) string {
+	switch eventType {
+	case eventFired:
+		return "🔥"
+	case eventRepeat:
+		return "🔁"
+	case eventAcked:
+		return "👁️"
+	case eventUnacked:
+		return "🔄"
+	case eventSilenced:
+		return "🔕"
+	case eventSilenceExpired:
+		return "🔔"
+	case eventEscalated:
+		return "📣"
+	case eventResolved:
+		return "✅"
+	}
+	return "•"
+}
+
+// buildHistoryAttachment renders the timeline of an alert in the language and location of the
+// reader, linking every event to its post
+func buildHistoryAttachment(history *alertHistory, l localizer, loc *time.Location, permalink func(postID string) string) *model.SlackAttachment {
+	alertname := history.Labels["alertname"]
+	if alertname == "" {
+		alertname = history.Fingerprint
+	}
+
+	var lines []string
+	for _, event := range history.Events {
+		line := fmt.Sprintf("`%s` %s **%s**",
+			time.UnixMilli(event.Timestamp).In(loc).Format("2006-01-02 15:04:05 MST"),
+			eventEmoji(event.Type),
+			l.T("event."+event.Type),
+		)
+		if event.Actor != "" {
+			line += l.T("history.by", event.Actor)
+		}
+		if event.Details != "" {
+			line += fmt.Sprintf(" (%s)", event.Details)
+		}
+		if event.PostID != "" {
+			line += l.T("history.post", permalink(event.PostID))
+		}
+		lines = append(lines, line)
+	}
+
+	var fields []*model.SlackAttachmentField
+	fields = addFields(fields, l.T("history.fingerprint"), fmt.Sprintf("`%s`", history.Fingerprint), true)
+	fields = addFields(fields, l.T("history.config"), history.ConfigID, true)
+	fields = addFields(fields, l.T("history.labels"), formatLabelPairs(history.Labels), false)
+
+	color := colorFiring
+	if len(history.Events) > 0 && history.Events[len(history.Events)-1].Type == eventResolved {
+		color = colorResolved
+	}
+
+	return &model.SlackAttachment{
+		Title:  l.T("history.title", alertname),
+		Text:   strings.Join(lines, "\n"),
+		Fields: fields,
+		Color:  color,
+	}
+}
+
+// getPermalink returns the permalink of a post in the team of the config
+func (p *Plugin) getPermalink(alertConfig alertConfig, postID string) string {
+	siteURL := ""
+	if config := p.API.GetConfig(); config != nil && config.ServiceSettings.SiteURL != nil {
+		siteURL = strings.TrimRight(*config.ServiceSettings.SiteURL, "/")
+	}
+	return fmt.Sprintf("%s/%s/pl/%s", siteURL, alertConfig.Team, postID)
+}
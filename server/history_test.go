@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseHistoryQuery(t *testing.T) {
+	history := &alertHistory{
+		Fingerprint: "3f0c5d2e9a7b1c4d",
+		Labels:      map[string]string{"alertname": "HighLatency", "severity": "critical", "instance": "db1"},
+	}
+
+	for _, tc := range []struct {
+		query   string
+		matches bool
+	}{
+		{query: "3f0c5d2e9a7b1c4d", matches: true},
+		{query: "0000000000000000", matches: false},
+		{query: "HighLatency", matches: true},
+		{query: "DiskFull", matches: false},
+		{query: "severity=critical,instance=db1", matches: true},
+		{query: `{severity="critical", instance="db1"}`, matches: true},
+		{query: "severity=warning", matches: false},
+	} {
+		t.Run(tc.query, func(t *testing.T) {
+			query, err := parseHistoryQuery(tc.query)
+			require.NoError(t, err)
+			assert.Equal(t, tc.matches, query.matches(history))
+		})
+	}
+
+	_, err := parseHistoryQuery("  ")
+	assert.Error(t, err)
+	_, err = parseHistoryQuery("=critical")
+	assert.Error(t, err)
+}
+
+func TestHistoryQueryCandidates(t *testing.T) {
+	index := map[string]alertHistoryIndexEntry{
+		"0000000000000001": {Alertname: "HighLatency"},
+		"0000000000000002": {Alertname: "DiskFull"},
+		"0000000000000003": {},
+	}
+
+	assert.Equal(t, []string{"0000000000000001", "0000000000000003"}, historyQuery{alertname: "HighLatency"}.candidates(index))
+	assert.Len(t, historyQuery{labels: map[string]string{"severity": "critical"}}.candidates(index), 3)
+	assert.Len(t, historyQuery{}.candidates(index), 3)
+}
+
+func TestApplyAlertHistoryIndex(t *testing.T) {
+	now := time.Now()
+	entries := map[string]alertHistoryIndexEntry{
+		"0000000000000001": {Alertname: "HighLatency", ExpiresAt: now.Add(time.Hour).UnixMilli()},
+		"0000000000000002": {Alertname: "DiskFull", ExpiresAt: now.Add(-time.Hour).UnixMilli()},
+		"0000000000000003": {Alertname: "DiskFull", ExpiresAt: now.Add(-alertHistoryIndexRefresh - time.Hour).UnixMilli()},
+	}
+
+	// Expired entries are dropped once timelines extended after their last refresh expired too
+	entries = applyAlertHistoryIndex(entries,
+		map[string]alertHistoryIndexEntry{"0000000000000004": {Alertname: "NodeDown", ExpiresAt: now.Add(time.Hour).UnixMilli()}},
+		[]string{"0000000000000001"},
+		now,
+	)
+	assert.Equal(t, []string{"0000000000000002", "0000000000000004"}, sortedKeys(entries))
+}
+
+func TestAlertHistoryIndexKey(t *testing.T) {
+	shards := make(map[string]struct{})
+	for i := 0; i < 1000; i++ {
+		key := getAlertHistoryIndexKey(fmt.Sprintf("%016x", i))
+		assert.True(t, strings.HasPrefix(key, alertHistoryIndexKeyPrefix), key)
+		shards[key] = struct{}{}
+	}
+	assert.Len(t, shards, alertHistoryIndexShards)
+	assert.Equal(t, getAlertHistoryIndexKey("3f0c5d2e9a7b1c4d"), getAlertHistoryIndexKey("3f0c5d2e9a7b1c4d"))
+}
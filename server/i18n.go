@@ -0,0 +1,139 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hako/durafmt"
+)
+
+// defaultLanguage is the language of the messages missing from a translation
+const defaultLanguage = "en"
+
+// i18nFiles are the translations shipped with the plugin, one <language>.json file of message
+// IDs to fmt formats per language
+//
+//go:embed i18n/*.json
+var i18nFiles embed.FS
+
+// i18nBundle holds the messages of every shipped language, by language and message ID
+var i18nBundle = mustLoadI18nBundle(i18nFiles)
+
+func loadI18nBundle(files fs.FS) (map[string]map[string]string, error) {
+	names, err := fs.Glob(files, "i18n/*.json")
+	if err != nil {
+		return nil, err
+	}
+
+	bundle := make(map[string]map[string]string, len(names))
+	for _, name := range names {
+		data, err := fs.ReadFile(files, name)
+		if err != nil {
+			return nil, err
+		}
+		var messages map[string]string
+		if err := json.Unmarshal(data, &messages); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		bundle[strings.TrimSuffix(path.Base(name), ".json")] = messages
+	}
+	if _, ok := bundle[defaultLanguage]; !ok {
+		return nil, fmt.Errorf("missing the %s translation", defaultLanguage)
+	}
+	return bundle, nil
+}
+
+func mustLoadI18nBundle(files fs.FS) map[string]map[string]string {
+	bundle, err := loadI18nBundle(files)
+	if err != nil {
+		panic(fmt.Sprintf("failed to load translations: %v", err))
+	}
+	return bundle
+}
+
+// supportedLanguages returns the languages of the shipped translations
+func supportedLanguages() []string {
+	languages := make([]string, 0, len(i18nBundle))
+	for language := range i18nBundle {
+		languages = append(languages, language)
+	}
+	sort.Strings(languages)
+	return languages
+}
+
+// matchLanguage returns the shipped language of a locale like "de" or "pt-BR", false when there is none
+func matchLanguage(locale string) (string, bool) {
+	locale = strings.ToLower(strings.ReplaceAll(locale, "_", "-"))
+	if _, ok := i18nBundle[locale]; ok {
+		return locale, true
+	}
+	base, _, _ := strings.Cut(locale, "-")
+	if _, ok := i18nBundle[base]; ok {
+		return base, true
+	}
+	return "", false
+}
+
+// localizer translates the bot messages into a language
+type localizer struct {
+	language string
+}
+
+// newLocalizer returns the localizer of a locale, English when the locale is not shipped
+func newLocalizer(locale string) localizer {
+	language, ok := matchLanguage(locale)
+	if !ok {
+		language = defaultLanguage
+	}
+	return localizer{language: language}
+}
+
+// T formats the message with the arguments like fmt.Sprintf. Messages missing from the
+// language fall back to English, unknown messages to their ID.
+func (l localizer) T(id string, args ...any) string {
+	message, ok := i18nBundle[l.language][id]
+	if !ok {
+		message, ok = i18nBundle[defaultLanguage][id]
+	}
+	if !ok {
+		return id
+	}
+	if len(args) == 0 {
+		return message
+	}
+	return fmt.Sprintf(message, args...)
+}
+
+// Duration formats the two largest units of a duration rounded to the second, e.g.
+// "2 hours 5 minutes", and "n/a" for durations that are not positive
+func (l localizer) Duration(d time.Duration) string {
+	if d <= 0 {
+		return l.T("duration.none")
+	}
+	formatted := durafmt.Parse(d.Round(time.Second)).LimitFirstN(2)
+	units, err := durafmt.DefaultUnitsCoder.Decode(l.T("duration.units"))
+	if err != nil {
+		return formatted.String()
+	}
+	return formatted.Format(units)
+}
+
+// configLocalizer returns the localizer of the channel posts of a config
+func configLocalizer(alertConfig alertConfig) localizer {
+	return newLocalizer(alertConfig.Language)
+}
+
+// userLocalizer returns the localizer of the locale of a user, for the replies only they see
+func (p *Plugin) userLocalizer(userID string) localizer {
+	user, appErr := p.API.GetUser(userID)
+	if appErr != nil {
+		return newLocalizer(defaultLanguage)
+	}
+	return newLocalizer(user.Locale)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var fmtVerbRegexp = regexp.MustCompile(`%(\[\d+\])?[-+# 0]*\d*(\.\d+)?[a-zA-Z%]`)
+
+// sampleArgs returns arguments matching the fmt verbs of an English message
+func sampleArgs(message string) []any {
+	var args []any
+	for _, verb := range fmtVerbRegexp.FindAllString(message, -1) {
+		switch verb[len(verb)-1] {
+		case '%':
+		case 'd':
+			args = append(args, 1)
+		case 'f':
+			args = append(args, 1.5)
+		default:
+			args = append(args, "x")
+		}
+	}
+	return args
+}
+
+func TestTranslationsAreComplete(t *testing.T) {
+	english := i18nBundle[defaultLanguage]
+	require.Contains(t, supportedLanguages(), "de")
+
+	for _, language := range supportedLanguages() {
+		messages := i18nBundle[language]
+		for id, message := range english {
+			translated, ok := messages[id]
+			if !assert.True(t, ok, "%s is missing %s", language, id) {
+				continue
+			}
+			args := sampleArgs(message)
+			l := localizer{language: language}
+			assert.NotContains(t, l.T(id, args...), "%!", "%s %s", language, id)
+			assert.Equal(t, len(fmtVerbRegexp.FindAllString(message, -1)), len(fmtVerbRegexp.FindAllString(translated, -1)), "%s %s", language, id)
+		}
+		for id := range messages {
+			assert.Contains(t, english, id, "%s has an unknown message", language)
+		}
+	}
+}
+
+func TestMatchLanguage(t *testing.T) {
+	language, ok := matchLanguage("de-DE")
+	assert.True(t, ok)
+	assert.Equal(t, "de", language)
+
+	language, ok = matchLanguage("pt_BR")
+	assert.False(t, ok)
+	assert.Empty(t, language)
+
+	assert.Equal(t, defaultLanguage, newLocalizer("").language)
+	assert.Equal(t, defaultLanguage, newLocalizer("fr").language)
+}
+
+func TestLocalizer(t *testing.T) {
+	de := newLocalizer("de")
+
+	assert.Equal(t, "Stummschaltung abc beendet.", de.T("command.expire_silence.done", "abc"))
+	assert.Equal(t, "no.such.message", de.T("no.such.message"))
+	assert.Equal(t, "2 Stunden 5 Minuten", de.Duration(2*time.Hour+5*time.Minute+100*time.Millisecond))
+	assert.Equal(t, "k. A.", de.Duration(0))
+	assert.Equal(t, "2 hours 5 minutes", newLocalizer("en-US").Duration(2*time.Hour+5*time.Minute))
+
+	// Messages missing from a translation fall back to English
+	i18nBundle["xx"] = map[string]string{}
+	defer delete(i18nBundle, "xx")
+	assert.Equal(t, "Started at", localizer{language: "xx"}.T("alert.started_at"))
+}
+
+func TestConfigLanguage(t *testing.T) {
+	var alertCfg alertConfig
+	require.NoError(t, json.Unmarshal([]byte(`{"language": "de"}`), &alertCfg))
+	assert.Equal(t, "de", configLocalizer(alertCfg).language)
+	assert.True(t, strings.HasPrefix(buildStormAttachment(channelStorm{active: true, localizer: configLocalizer(alertCfg)}).Title, "🌩️ ALARMSTURM"))
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/prometheus/alertmanager/pkg/labels"
+	"github.com/prometheus/alertmanager/template"
+)
+
+const (
+	actionLink = "link"
+
+	linkDisplayField  = "field"
+	linkDisplayButton = "button"
+
+	// The UIs of the built-in links, by their URL routes
+	uiLinksAlertmanager = "alertmanager"
+	uiLinksKarma        = "karma"
+)
+
+// alertLink is a link of the alert posts of a config, rendered from a template of the alert
+type alertLink struct {
+	Name     string
+	URL      string // Alert template of the URL, e.g. "{{ .Annotations.runbook_url }}"; links rendering empty are left out
+	Matchers string // Label matchers of the alerts the link is shown on, empty matches every alert
+	Status   string // "firing" or "resolved" shows the link in that state only, empty in both
+	Display  string // "field" lists the link in the Links field of the post, "button" adds a button
+}
+
+// AlertLinks is the ordered list of links of a config
+type AlertLinks []alertLink
+
+// UnmarshalJSON implements custom unmarshaling to handle both string and list
+func (a *AlertLinks) UnmarshalJSON(data []byte) error {
+	// Try to unmarshal as a list first
+	var links []alertLink
+	if err := json.Unmarshal(data, &links); err == nil {
+		*a = AlertLinks(links)
+		return nil
+	}
+
+	// If that fails, try to unmarshal as a string (JSON string)
+	var str string
+	if err := json.Unmarshal(data, &str); err != nil {
+		return err
+	}
+	if str == "" {
+		*a = nil
+		return nil
+	}
+
+	if err := json.Unmarshal([]byte(str), &links); err != nil {
+		return err
+	}
+	*a = AlertLinks(links)
+	return nil
+}
+
+// validate checks the fields of the link, its URL template is trial-rendered with the other templates
+func (l alertLink) validate() error {
+	if l.Name == "" {
+		return errors.New("needs a Name")
+	}
+	if l.URL == "" {
+		return errors.New("needs a URL")
+	}
+	if l.Matchers != "" {
+		if _, err := labels.ParseMatchers(l.Matchers); err != nil {
+			return fmt.Errorf("invalid Matchers: %w", err)
+		}
+	}
+	switch l.Status {
+	case "", alertStatusFiring, alertStatusResolved:
+	default:
+		return fmt.Errorf("invalid Status %q, must be %s or %s", l.Status, alertStatusFiring, alertStatusResolved)
+	}
+	switch l.Display {
+	case "", linkDisplayField, linkDisplayButton:
+	default:
+		return fmt.Errorf("invalid Display %q, must be %s or %s", l.Display, linkDisplayField, linkDisplayButton)
+	}
+	return nil
+}
+
+// shows reports whether the link is shown on the alert, invalid matchers never match
+func (l alertLink) shows(alert template.Alert) bool {
+	if l.Status != "" && l.Status != alert.Status {
+		return false
+	}
+	if l.Matchers == "" {
+		return true
+	}
+
+	matchers, err := labels.ParseMatchers(l.Matchers)
+	if err != nil {
+		return false
+	}
+	for _, matcher := range matchers {
+		if !matcher.Matches(alert.Labels[matcher.Name]) {
+			return false
+		}
+	}
+	return true
+}
+
+// renderedLink is a link of an alert post
+type renderedLink struct {
+	Name   string
+	URL    string
+	Button bool
+}
+
+// renderLinks returns the links of an alert: the built-in UI links when the config has UILinks, then
+// the links of the config shown on the alert. Links whose template fails are returned as errors and
+// left out.
+func (ac alertConfig) renderLinks(l localizer, data alertTemplateData) ([]renderedLink, []error) {
+	var links []renderedLink
+	if ac.UILinks != "" && (ac.Source == "" || ac.Source == sourceAlertmanager) && data.ExternalURL != "" && len(data.Labels) > 0 {
+		links = append(links, uiLinks(l, ac.UILinks, data.ExternalURL, data.Alert)...)
+	}
+
+	var errs []error
+	for _, link := range ac.Links {
+		if !link.shows(data.Alert) {
+			continue
+		}
+		rendered, err := renderAlertTemplate(link.URL, data)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("link %q: %w", link.Name, err))
+			continue
+		}
+		rendered = strings.TrimSpace(rendered)
+		if u, err := url.Parse(rendered); rendered == "" || err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			// An annotation missing on the alert leaves the link out
+			continue
+		}
+		links = append(links, renderedLink{Name: link.Name, URL: rendered, Button: link.Display == linkDisplayButton})
+	}
+	return links, errs
+}
+
+// uiLinks links the alert in the UI at externalURL with the routes of the UI. The Alertmanager UI
+// also gets a silence of the alert prefilled with its labels while it fires, Karma silences are
+// created from the alert.
+func uiLinks(l localizer, ui, externalURL string, alert template.Alert) []renderedLink {
+	externalURL = strings.TrimRight(externalURL, "/")
+
+	if ui == uiLinksKarma {
+		filters := make([]string, 0, len(alert.Labels))
+		for _, name := range sortedKeys(alert.Labels) {
+			filters = append(filters, fmt.Sprintf("%s=%s", name, alert.Labels[name]))
+		}
+		return []renderedLink{{Name: l.T("links.open_karma"), URL: externalURL + "/?" + url.Values{"q": filters}.Encode()}}
+	}
+
+	matchers := make([]string, 0, len(alert.Labels))
+	for _, name := range sortedKeys(alert.Labels) {
+		matchers = append(matchers, fmt.Sprintf("%s=%q", name, alert.Labels[name]))
+	}
+	filter := url.QueryEscape("{" + strings.Join(matchers, ",") + "}")
+	links := []renderedLink{{Name: l.T("links.open_alertmanager"), URL: externalURL + "/#/alerts?filter=" + filter}}
+	if alert.Status != alertStatusResolved {
+		links = append(links, renderedLink{Name: l.T("links.silence_ui"), URL: externalURL + "/#/silences/new?filter=" + filter})
+	}
+	return links
+}
+
+// addAlertLinks adds the links of the alert to its attachment, as a Links field and buttons.
+// Buttons need the SiteURL, without it they are listed in the field.
+func (p *Plugin) addAlertLinks(attachment *model.SlackAttachment, alertConfig alertConfig, alert template.Alert, notification alertNotification) {
+	l := configLocalizer(alertConfig)
+	data := newAlertTemplateData(alert, notification)
+	data.location = mustDisplayLocation(alertConfig)
+	data.localizer = l
+	data.library = p.getState().library
+
+	links, errs := alertConfig.renderLinks(l, data)
+	for _, err := range errs {
+		p.metrics.observeFailure(failureTemplate)
+		p.API.LogError("[WEBHOOK] Failed to render link",
+			"config_id", alertConfig.ID,
+			"fingerprint", alert.Fingerprint,
+			"error", err.Error(),
+		)
+	}
+
+	siteURL := ""
+	if config := p.API.GetConfig(); config != nil && config.ServiceSettings.SiteURL != nil {
+		siteURL = strings.TrimRight(*config.ServiceSettings.SiteURL, "/")
+	}
+
+	var fieldLinks []string
+	for _, link := range links {
+		if !link.Button || siteURL == "" {
+			fieldLinks = append(fieldLinks, fmt.Sprintf("[%s](%s)", link.Name, link.URL))
+			continue
+		}
+		attachment.Actions = append(attachment.Actions, &model.PostAction{
+			Name: link.Name,
+			Type: model.PostActionTypeButton,
+			Integration: &model.PostActionIntegration{
+				URL: fmt.Sprintf("%s/plugins/%s/api/action", siteURL, Manifest.Id),
+				Context: map[string]interface{}{
+					"action":    actionLink,
+					"config_id": alertConfig.ID,
+					"name":      link.Name,
+					"url":       link.URL,
+				},
+			},
+		})
+	}
+	if len(fieldLinks) > 0 {
+		attachment.Fields = addFields(attachment.Fields, l.T("links.title"), strings.Join(fieldLinks, " · "), false)
+	}
+}
+
+// handleLinkAction answers a link button with the link. Buttons of interactive messages cannot
+// open URLs themselves, the user follows the link of the ephemeral reply.
+func (p *Plugin) handleLinkAction(w http.ResponseWriter, action Action) {
+	l := p.userLocalizer(action.UserID)
+	u, err := url.Parse(action.Context.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		encodeEphemeralMessage(w, l.T("action.invalid"))
+		return
+	}
+	encodeEphemeralMessage(w, l.T("links.open", action.Context.Name, action.Context.URL))
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/prometheus/alertmanager/template"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderLinks(t *testing.T) {
+	ac := alertConfig{UILinks: uiLinksAlertmanager, Links: AlertLinks{
+		{Name: "Runbook", URL: "{{ .Annotations.runbook_url }}"},
+		{Name: "Dashboard", URL: "https://grafana.example.com/d/x?var-ns={{ .Labels.namespace | urlquery }}", Matchers: `namespace=~".+"`, Display: linkDisplayButton},
+		{Name: "Postmortem", URL: "https://wiki.example.com/new?title={{ .Labels.alertname }}", Status: alertStatusResolved},
+	}}
+	l := newLocalizer("")
+	alert := template.Alert{
+		Status:      alertStatusFiring,
+		Labels:      template.KV{"alertname": "HighCPU", "namespace": "kube system"},
+		Annotations: template.KV{"runbook_url": "https://runbooks.example.com/high-cpu"},
+	}
+	notification := alertNotification{ExternalURL: "http://alertmanager.example.com/"}
+
+	links, errs := ac.renderLinks(l, newAlertTemplateData(alert, notification))
+	require.Empty(t, errs)
+	assert.Equal(t, []renderedLink{
+		{Name: "Open in Alertmanager", URL: "http://alertmanager.example.com/#/alerts?filter=%7Balertname%3D%22HighCPU%22%2Cnamespace%3D%22kube+system%22%7D"},
+		{Name: "Silence in UI", URL: "http://alertmanager.example.com/#/silences/new?filter=%7Balertname%3D%22HighCPU%22%2Cnamespace%3D%22kube+system%22%7D"},
+		{Name: "Runbook", URL: "https://runbooks.example.com/high-cpu"},
+		{Name: "Dashboard", URL: "https://grafana.example.com/d/x?var-ns=kube+system", Button: true},
+	}, links)
+
+	// Links rendering empty and links not matching are left out, silences are not offered once resolved
+	alert.Status = alertStatusResolved
+	alert.Labels = template.KV{"alertname": "HighCPU"}
+	alert.Annotations = nil
+	links, errs = ac.renderLinks(l, newAlertTemplateData(alert, notification))
+	require.Empty(t, errs)
+	require.Len(t, links, 2)
+	assert.Equal(t, "Open in Alertmanager", links[0].Name)
+	assert.Equal(t, renderedLink{Name: "Postmortem", URL: "https://wiki.example.com/new?title=HighCPU"}, links[1])
+
+	// The built-in links are off by default, Karma has its own routes and no silence link
+	ac.UILinks = ""
+	links, errs = ac.renderLinks(l, newAlertTemplateData(alert, notification))
+	require.Empty(t, errs)
+	assert.Equal(t, []renderedLink{{Name: "Postmortem", URL: "https://wiki.example.com/new?title=HighCPU"}}, links)
+
+	ac.UILinks = uiLinksKarma
+	alert.Status = alertStatusFiring
+	alert.Labels = template.KV{"alertname": "HighCPU", "namespace": "kube system"}
+	links, errs = ac.renderLinks(l, newAlertTemplateData(alert, alertNotification{ExternalURL: "https://karma.example.com"}))
+	require.Empty(t, errs)
+	assert.Equal(t, []renderedLink{
+		{Name: "Open in Karma", URL: "https://karma.example.com/?q=alertname%3DHighCPU&q=namespace%3Dkube+system"},
+		{Name: "Dashboard", URL: "https://grafana.example.com/d/x?var-ns=kube+system", Button: true},
+	}, links)
+
+	// The other sources have no Alertmanager UI
+	ac.Source = sourceGrafana
+	ac.Links = AlertLinks{{Name: "Broken", URL: "{{ .Labels.alertname | nosuchfunc }}"}}
+	links, errs = ac.renderLinks(l, newAlertTemplateData(alert, notification))
+	assert.Empty(t, links)
+	assert.Len(t, errs, 1)
+}
+
+func TestAlertLinksConfig(t *testing.T) {
+	var alertCfg alertConfig
+	require.NoError(t, json.Unmarshal([]byte(`{"links": "[{\"name\": \"Runbook\", \"url\": \"{{ .Annotations.runbook_url }}\", \"display\": \"button\"}]", "externalurl": "https://karma.example.com"}`), &alertCfg))
+	require.Len(t, alertCfg.Links, 1)
+	assert.Equal(t, linkDisplayButton, alertCfg.Links[0].Display)
+	assert.Equal(t, "https://karma.example.com", alertCfg.ExternalURL)
+	assert.NoError(t, alertCfg.Links[0].validate())
+
+	assert.Error(t, alertLink{URL: "https://example.com"}.validate())
+	assert.Error(t, alertLink{Name: "Runbook"}.validate())
+	assert.Error(t, alertLink{Name: "Runbook", URL: "https://example.com", Matchers: "a=~\"(\""}.validate())
+	assert.Error(t, alertLink{Name: "Runbook", URL: "https://example.com", Status: "pending"}.validate())
+	assert.Error(t, alertLink{Name: "Runbook", URL: "https://example.com", Display: "menu"}.validate())
+
+	alertCfg = alertConfig{UILinks: "grafana"}
+	assert.ErrorContains(t, alertCfg.validate(nil), "UILinks")
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	metricsNamespace = "mattermost_plugin_alertmanager"
+
+	failureDecode     = "decode"
+	failureTemplate   = "template"
+	failureCreatePost = "create_post"
+	failureUpdatePost = "update_post"
+	failureKV         = "kv"
+
+	postCreated = "created"
+	postUpdated = "updated"
+)
+
+// metrics holds the Prometheus collectors of the plugin. All methods are safe to
+// call on a nil receiver, so that code paths do not depend on the plugin being activated.
+type metrics struct {
+	registry *prometheus.Registry
+
+	webhooksReceived  *prometheus.CounterVec
+	webhookDuplicates *prometheus.CounterVec
+	alertsProcessed   *prometheus.CounterVec
+	posts             *prometheus.CounterVec
+	failures          *prometheus.CounterVec
+	actions           *prometheus.CounterVec
+	amRequestDuration *prometheus.HistogramVec
+	amRequestErrors   *prometheus.CounterVec
+}
+
+func newMetrics(queueDepth func() float64) *metrics {
+	m := &metrics{
+		registry: prometheus.NewRegistry(),
+		webhooksReceived: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "webhooks_received_total",
+			Help:      "Webhook notifications received, by config and notification status.",
+		}, []string{"config_id", "status"}),
+		webhookDuplicates: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "webhooks_duplicates_total",
+			Help:      "Duplicate webhook notifications ignored by this node since its activation, by config.",
+		}, []string{"config_id"}),
+		alertsProcessed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "alerts_processed_total",
+			Help:      "Alerts processed, by state.",
+		}, []string{"state"}),
+		posts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "posts_total",
+			Help:      "Alert posts created or updated.",
+		}, []string{"operation"}),
+		failures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "failures_total",
+			Help:      "Failures while processing webhooks, by type.",
+		}, []string{"type"}),
+		actions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "actions_total",
+			Help:      "Action button clicks, by action.",
+		}, []string{"action"}),
+		amRequestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "alertmanager_request_duration_seconds",
+			Help:      "Duration of the requests to the Alertmanager API, retries included.",
+			Buckets:   []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+		}, []string{"url"}),
+		amRequestErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "alertmanager_request_errors_total",
+			Help:      "Failed requests to the Alertmanager API.",
+		}, []string{"url"}),
+	}
+
+	m.registry.MustRegister(
+		m.webhooksReceived,
+		m.webhookDuplicates,
+		m.alertsProcessed,
+		m.posts,
+		m.failures,
+		m.actions,
+		m.amRequestDuration,
+		m.amRequestErrors,
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "queue_depth",
+			Help:      "Webhooks waiting in the processing queue of this node.",
+		}, queueDepth),
+		collectors.NewGoCollector(),
+	)
+
+	return m
+}
+
+func (m *metrics) observeWebhookReceived(configID, status string) {
+	if m == nil {
+		return
+	}
+	m.webhooksReceived.WithLabelValues(configID, status).Inc()
+}
+
+func (m *metrics) observeWebhookDuplicate(configID string) {
+	if m == nil {
+		return
+	}
+	m.webhookDuplicates.WithLabelValues(configID).Inc()
+}
+
+func (m *metrics) observeAlertProcessed(state string) {
+	if m == nil {
+		return
+	}
+	m.alertsProcessed.WithLabelValues(state).Inc()
+}
+
+func (m *metrics) observePost(operation string) {
+	if m == nil {
+		return
+	}
+	m.posts.WithLabelValues(operation).Inc()
+}
+
+func (m *metrics) observeFailure(failureType string) {
+	if m == nil {
+		return
+	}
+	m.failures.WithLabelValues(failureType).Inc()
+}
+
+func (m *metrics) observeAction(action string) {
+	if m == nil {
+		return
+	}
+	m.actions.WithLabelValues(action).Inc()
+}
+
+func (m *metrics) observeAlertmanagerRequest(url string, duration time.Duration, err error) {
+	if m == nil {
+		return
+	}
+	m.amRequestDuration.WithLabelValues(url).Observe(duration.Seconds())
+	if err != nil {
+		m.amRequestErrors.WithLabelValues(url).Inc()
+	}
+}
+
+// handleMetrics serves the metrics in the Prometheus exposition format to system admins.
+// Prometheus authenticates with a personal access token as bearer token.
+func (p *Plugin) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if !p.isSystemAdmin(w, r) {
+		return
+	}
+	if p.metrics == nil {
+		http.Error(w, "Metrics are not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	promhttp.HandlerFor(p.metrics.registry, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+}
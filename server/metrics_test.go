@@ -0,0 +1,38 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetrics(t *testing.T) {
+	var disabled *metrics
+	assert.NotPanics(t, func() {
+		disabled.observeFailure(failureKV)
+		disabled.observeAlertmanagerRequest("http://am:9093", time.Second, nil)
+	})
+
+	m := newMetrics(func() float64 { return 3 })
+	m.observeWebhookReceived("1", "firing")
+	m.observeWebhookReceived("1", "firing")
+	m.observeFailure(failureTemplate)
+	m.observeAlertmanagerRequest("http://am:9093", 100*time.Millisecond, nil)
+	m.observeAlertmanagerRequest("http://am:9093", time.Second, errors.New("timeout"))
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.webhooksReceived.WithLabelValues("1", "firing")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.failures.WithLabelValues(failureTemplate)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.amRequestErrors.WithLabelValues("http://am:9093")))
+
+	err := testutil.GatherAndCompare(m.registry, strings.NewReader(`
+# HELP mattermost_plugin_alertmanager_queue_depth Webhooks waiting in the processing queue of this node.
+# TYPE mattermost_plugin_alertmanager_queue_depth gauge
+mattermost_plugin_alertmanager_queue_depth 3
+`), "mattermost_plugin_alertmanager_queue_depth")
+	require.NoError(t, err)
+}
@@ -6,13 +6,16 @@ import (
 	"fmt"
 	"net/http"
 	"path/filepath"
-	"sync"
+	"strings"
+	"sync/atomic"
 
 	"github.com/mattermost/mattermost/server/public/model"
 	"github.com/mattermost/mattermost/server/public/plugin"
 	"github.com/mattermost/mattermost/server/public/pluginapi"
+	"github.com/mattermost/mattermost/server/public/pluginapi/cluster"
 
 	root "github.com/Kuzyashin/mattermost-plugin-alertmanager"
+	"github.com/Kuzyashin/mattermost-plugin-alertmanager/server/alertmanager"
 )
 
 var (
@@ -23,16 +26,33 @@ type Plugin struct {
 	plugin.MattermostPlugin
 	client *pluginapi.Client
 
-	// configuration is the active plugin configuration. Consult getConfiguration and
-	// setConfiguration for usage.
-	configuration *configuration
-
-	// key - alert config id, value - existing or created channel id received from api
-	AlertConfigIDChannelID map[string]string
-	BotUserID              string
-
-	// configurationLock synchronizes access to the configuration.
-	configurationLock sync.RWMutex
+	// state is the active configuration and channel mappings snapshot. Consult getState,
+	// getConfiguration and getChannelID for usage.
+	state atomic.Pointer[runtimeState]
+
+	BotUserID string
+
+	// storms tracks the per-channel alert rate and the alert storms in progress
+	storms *stormTracker
+
+	// queue holds the webhooks waiting to be processed by the worker pool
+	queue *webhookQueue
+	// alertLocks serializes the processing of alerts sharing a fingerprint
+	alertLocks alertLocks
+	// ingest counts received and duplicate webhooks per config
+	ingest *ingestStats
+	// metrics exposes the plugin metrics to Prometheus
+	metrics *metrics
+	// amClient sends the requests to the Alertmanager API, observed by metrics
+	amClient *alertmanager.Client
+	// digestJob posts the scheduled digests, on one node of the cluster at a time
+	digestJob *cluster.Job
+	// heartbeatJob checks the heartbeats of the configs, on one node of the cluster at a time
+	heartbeatJob *cluster.Job
+	// healthJob checks the AlertManagers of the configs, on one node of the cluster at a time
+	healthJob *cluster.Job
+	// testFireStop stops watching the test alerts of /alertmanager test fire
+	testFireStop chan struct{}
 }
 
 // Helper functions for alert fingerprint -> post ID mapping
@@ -109,6 +129,16 @@ func (p *Plugin) unackAlert(fingerprint string) error {
 }
 
 func (p *Plugin) OnDeactivate() error {
+	p.stopDigestJob()
+	p.stopHeartbeatJob()
+	p.stopHealthJob()
+	p.stopWebhookQueue()
+	if p.testFireStop != nil {
+		close(p.testFireStop)
+	}
+	if p.storms != nil {
+		p.storms.stop()
+	}
 	return nil
 }
 
@@ -123,19 +153,27 @@ func (p *Plugin) OnActivate() error {
 		return fmt.Errorf("failed to ensure bot account: %w", err)
 	}
 	p.BotUserID = botID
-
-	configuration := p.getConfiguration()
-	p.AlertConfigIDChannelID = make(map[string]string)
-	for k, alertConfig := range configuration.AlertConfigs {
-		var channelID string
-		channelID, err = p.ensureAlertChannelExists(alertConfig)
-		if err != nil {
-			p.API.LogWarn(fmt.Sprintf("Failed to ensure alert channel %v", k), "error", err.Error())
-		} else {
-			p.AlertConfigIDChannelID[alertConfig.ID] = channelID
+	p.storms = newStormTracker()
+	p.ingest = newIngestStats()
+	p.testFireStop = make(chan struct{})
+	p.metrics = newMetrics(func() float64 {
+		if p.queue == nil {
+			return 0
 		}
+		return float64(p.queue.size())
+	})
+	p.amClient = alertmanager.NewClient(p.metrics.observeAlertmanagerRequest)
+
+	// The channels are resolved again now that the bot exists to create them
+	if err = p.reloadChannelMappings(); err != nil {
+		p.API.LogWarn("Failed to reload channel mappings", "error", err.Error())
 	}
 
+	p.startWebhookQueue()
+	p.startDigestJob()
+	p.startHeartbeatJob()
+	p.startHealthJob()
+
 	command, err := p.getCommand()
 	if err != nil {
 		return fmt.Errorf("failed to get command: %w", err)
@@ -183,32 +221,6 @@ func (p *Plugin) ensureAlertChannelExists(alertConfig alertConfig) (string, erro
 	return channel.Id, nil
 }
 
-func (p *Plugin) reloadChannelMappings() error {
-	p.API.LogInfo("Starting channel mappings reload")
-
-	configuration := p.getConfiguration()
-	newMapping := make(map[string]string)
-
-	for k, alertConfig := range configuration.AlertConfigs {
-		var channelID string
-		var err error
-
-		channelID, err = p.ensureAlertChannelExists(alertConfig)
-		if err != nil {
-			p.API.LogWarn(fmt.Sprintf("Failed to ensure alert channel %v during reload", k), "error", err.Error())
-			continue
-		}
-
-		newMapping[alertConfig.ID] = channelID
-		p.API.LogInfo(fmt.Sprintf("Mapped config %s to channel %s", alertConfig.ID, channelID))
-	}
-
-	p.AlertConfigIDChannelID = newMapping
-	p.API.LogInfo("Channel mappings reload completed", "mappings", fmt.Sprintf("%+v", newMapping))
-
-	return nil
-}
-
 func (p *Plugin) ServeHTTP(_ *plugin.Context, w http.ResponseWriter, r *http.Request) {
 	p.API.LogInfo("[HTTP] Incoming request",
 		"method", r.Method,
@@ -216,6 +228,26 @@ func (p *Plugin) ServeHTTP(_ *plugin.Context, w http.ResponseWriter, r *http.Req
 		"remote_addr", r.RemoteAddr,
 	)
 
+	if r.URL.Path == "/metrics" {
+		p.handleMetrics(w, r)
+		return
+	}
+
+	if r.URL.Path == "/api/diagnostics" {
+		p.handleDiagnostics(w, r)
+		return
+	}
+
+	if r.URL.Path == "/api/template/preview" {
+		p.handleTemplatePreview(w, r)
+		return
+	}
+
+	if r.URL.Path == "/api/templates" || strings.HasPrefix(r.URL.Path, "/api/templates/") {
+		p.handleTemplateLibrary(w, r)
+		return
+	}
+
 	if r.Method == http.MethodGet {
 		w.WriteHeader(http.StatusOK)
 		_, _ = w.Write([]byte("Mattermost AlertManager Plugin"))
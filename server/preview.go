@@ -0,0 +1,303 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/alertmanager/notify/webhook"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+const (
+	webhookSampleKeyPrefix = "webhook_sample_"
+
+	// previewMaxBodyBytes bounds the template preview requests
+	previewMaxBodyBytes = 1 << 20
+
+	colorPreview = "#1E90FF"
+)
+
+// templateErrorRegexp extracts the template and position of text/template parse and execution
+// errors, e.g. `template: alert:3:14: executing "alert" at <.Foo>: can't evaluate field Foo`. The
+// template is the config template "alert", a thread reply or a library template.
+var templateErrorRegexp = regexp.MustCompile(`template: ([^:\s]+):(\d+)(?::(\d+))?: (.*)$`)
+
+// templatePreviewRequest is the body of POST /api/template/preview. Without a payload, the
+// template is rendered against the last webhook of the config, or the built-in sample alert.
+type templatePreviewRequest struct {
+	Template string           `json:"template"`
+	Payload  *webhook.Message `json:"payload,omitempty"`
+	ConfigID string           `json:"config_id,omitempty"`
+	// Resolved previews a resolved template, a firing sample alert is resolved first
+	Resolved bool `json:"resolved,omitempty"`
+	// Event previews the thread reply template of an event: acked, unacked, silenced or resolved
+	Event string `json:"event,omitempty"`
+}
+
+type templatePreviewResponse struct {
+	Rendered string `json:"rendered"`
+	Error    string `json:"error,omitempty"`
+	Line     int    `json:"line,omitempty"`
+	Column   int    `json:"column,omitempty"`
+	// Template names the template of the error position, "alert" for the previewed template
+	Template string `json:"template,omitempty"`
+	// Sample describes the alert the template was rendered against
+	Sample string `json:"sample"`
+}
+
+func getWebhookSampleKey(configID string) string {
+	return webhookSampleKeyPrefix + configID
+}
+
+// saveWebhookSample keeps the first alert of the last webhook of the config for template previews
+func (p *Plugin) saveWebhookSample(configID string, message webhook.Message) {
+	if message.Data == nil || len(message.Alerts) == 0 {
+		return
+	}
+
+	sample := message
+	data := *message.Data
+	data.Alerts = data.Alerts[:1]
+	sample.Data = &data
+
+	encoded, err := json.Marshal(sample)
+	if err != nil {
+		return
+	}
+	if appErr := p.API.KVSet(getWebhookSampleKey(configID), encoded); appErr != nil {
+		p.API.LogWarn("[WEBHOOK] Failed to save webhook sample",
+			"config_id", configID,
+			"error", appErr.Error(),
+		)
+	}
+}
+
+func (p *Plugin) getWebhookSample(configID string) (*webhook.Message, error) {
+	data, appErr := p.API.KVGet(getWebhookSampleKey(configID))
+	if appErr != nil {
+		return nil, appErr
+	}
+	if data == nil {
+		return nil, nil
+	}
+
+	var message webhook.Message
+	if err := json.Unmarshal(data, &message); err != nil {
+		return nil, err
+	}
+	return &message, nil
+}
+
+// templateErrorPosition returns the template, line and column of a template error, 0 when unknown
+func templateErrorPosition(err error) (string, int, int) {
+	matches := templateErrorRegexp.FindStringSubmatch(err.Error())
+	if matches == nil {
+		return "", 0, 0
+	}
+	line, _ := strconv.Atoi(matches[2])
+	column, _ := strconv.Atoi(matches[3])
+	return matches[1], line, column
+}
+
+// previewData returns the data a template preview is rendered against and its description in the language of l
+func (p *Plugin) previewData(alertConfig *alertConfig, payload *webhook.Message, l localizer) (alertTemplateData, string, error) {
+	sample := l.T("preview.sample.builtin")
+	if payload == nil && alertConfig != nil {
+		lastWebhook, err := p.getWebhookSample(alertConfig.ID)
+		if err != nil {
+			p.API.LogWarn("[HTTP] Failed to get webhook sample", "config_id", alertConfig.ID, "error", err.Error())
+		}
+		if lastWebhook != nil {
+			payload = lastWebhook
+			sample = l.T("preview.sample.last", alertConfig.ID)
+		}
+	} else if payload != nil {
+		sample = l.T("preview.sample.payload")
+	}
+
+	if payload == nil {
+		data := sampleTemplateData()
+		if alertConfig != nil {
+			data.ConfigID = alertConfig.ID
+			data.team = alertConfig.Team
+			data.location = mustDisplayLocation(*alertConfig)
+			data.localizer = configLocalizer(*alertConfig)
+		}
+		data.library = p.getState().library
+		return data, sample, nil
+	}
+
+	if payload.Data == nil || len(payload.Alerts) == 0 {
+		return alertTemplateData{}, "", errors.New("the payload has no alerts")
+	}
+	alert := payload.Alerts[0]
+	notification := newAlertNotification(*payload)
+	if alertConfig == nil {
+		data := newAlertTemplateData(alert, notification)
+		data.library = p.getState().library
+		return data, sample, nil
+	}
+	if alertConfig.ExternalURL != "" {
+		notification.ExternalURL = alertConfig.ExternalURL
+	}
+	return p.alertTemplateData(*alertConfig, alert, notification, ""), sample, nil
+}
+
+// renderPreview renders a template, the response carries the error and its position on failure
+func renderPreview(tmpl string, data alertTemplateData, sample string) templatePreviewResponse {
+	rendered, err := renderAlertTemplate(tmpl, data)
+	return newPreviewResponse(rendered, err, sample)
+}
+
+// renderThreadPreview renders a thread reply template for an event of the alert
+func renderThreadPreview(tmpl string, data alertTemplateData, event, sample string) templatePreviewResponse {
+	rendered, err := renderThreadTemplate(tmpl, newSampleThreadTemplateData(data, event))
+	return newPreviewResponse(rendered, err, sample)
+}
+
+func newPreviewResponse(rendered string, err error, sample string) templatePreviewResponse {
+	response := templatePreviewResponse{Sample: sample}
+	if err != nil {
+		response.Error = err.Error()
+		response.Template, response.Line, response.Column = templateErrorPosition(err)
+		return response
+	}
+	response.Rendered = rendered
+	return response
+}
+
+// asResolved turns the data of a firing sample alert into a resolved one, to preview resolved templates
+func asResolved(data alertTemplateData) alertTemplateData {
+	if data.Status == alertStatusResolved {
+		return data
+	}
+	data.Status = alertStatusResolved
+	data.GroupStatus = alertStatusResolved
+	if !data.EndsAt.After(data.StartsAt) {
+		data.EndsAt = time.Now()
+	}
+	return data
+}
+
+// handleTemplatePreview renders a template for the template editor of system admins
+func (p *Plugin) handleTemplatePreview(w http.ResponseWriter, r *http.Request) {
+	if !p.isSystemAdmin(w, r) {
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var request templatePreviewRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, previewMaxBodyBytes)).Decode(&request); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	// A config not saved yet has no sample, the built-in one is used instead
+	var alertConfig *alertConfig
+	if config, ok := p.getConfiguration().AlertConfigs[request.ConfigID]; ok {
+		alertConfig = &config
+	}
+
+	data, sample, err := p.previewData(alertConfig, request.Payload, p.userLocalizer(r.Header.Get("Mattermost-User-Id")))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid payload: %v", err), http.StatusBadRequest)
+		return
+	}
+	if request.Resolved {
+		data = asResolved(data)
+	}
+
+	var response templatePreviewResponse
+	if request.Event != "" {
+		if _, ok := threadEvents[request.Event]; !ok {
+			http.Error(w, fmt.Sprintf("Unknown event %q", request.Event), http.StatusBadRequest)
+			return
+		}
+		response = renderThreadPreview(request.Template, data, request.Event, sample)
+	} else {
+		response = renderPreview(request.Template, data, sample)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		p.API.LogError("[HTTP] Failed to encode template preview", "error", err.Error())
+	}
+}
+
+// buildPreviewAttachment renders the templates of a config as they would be posted, described in the language of l
+func (p *Plugin) buildPreviewAttachment(alertConfig alertConfig, l localizer) *model.SlackAttachment {
+	data, sample, err := p.previewData(&alertConfig, nil, l)
+	if err != nil {
+		return &model.SlackAttachment{
+			Title: l.T("preview.title", alertConfig.ID),
+			Text:  l.T("preview.sample_failed", err),
+			Color: colorPreview,
+		}
+	}
+
+	templates := alertConfig.selectTemplates(p.getConfigMatchers(alertConfig), data)
+	acked := data
+	acked.Acked, acked.AckedBy = true, "username"
+
+	var fields []*model.SlackAttachmentField
+	for _, tmpl := range []struct {
+		name  string
+		value string
+		data  alertTemplateData
+	}{
+		{name: l.T("preview.firing"), value: templates.Firing, data: data},
+		{name: l.T("preview.resolved"), value: templates.Resolved, data: asResolved(data)},
+		{name: l.T("preview.acked"), value: templates.Acked, data: acked},
+	} {
+		if tmpl.value == "" && tmpl.data.Acked {
+			continue
+		}
+		if tmpl.value == "" {
+			fields = addFields(fields, tmpl.name, l.T("preview.not_set"), false)
+			continue
+		}
+		preview := renderPreview(tmpl.value, tmpl.data, sample)
+		if preview.Error != "" {
+			fields = addFields(fields, tmpl.name, fmt.Sprintf("❌ %s", preview.Error), false)
+			continue
+		}
+		fields = addFields(fields, tmpl.name, preview.Rendered, false)
+	}
+
+	for _, event := range []string{threadEventAcked, threadEventUnacked, threadEventSilenced, threadEventResolved} {
+		name := l.T("preview.thread_reply", event)
+		reply := alertConfig.ThreadReplies[event]
+		switch {
+		case reply.Disabled:
+			fields = addFields(fields, name, l.T("preview.disabled"), true)
+		case reply.Template != "":
+			preview := renderThreadPreview(reply.Template, data, event, sample)
+			if preview.Error != "" {
+				fields = addFields(fields, name, fmt.Sprintf("❌ %s", preview.Error), true)
+				continue
+			}
+			fields = addFields(fields, name, preview.Rendered, true)
+		}
+	}
+
+	text := l.T("preview.text", sample)
+	if templates.Rule != "" {
+		text = l.T("preview.text_rule", sample, templates.Rule)
+	}
+
+	return &model.SlackAttachment{
+		Title:  l.T("preview.title", alertConfig.ID),
+		Text:   text,
+		Fields: fields,
+		Color:  colorPreview,
+	}
+}
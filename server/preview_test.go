@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderPreview(t *testing.T) {
+	data := sampleTemplateData()
+
+	preview := renderPreview("**{{ .Labels.alertname }}** is {{ .Status }}", data, "built-in sample alert")
+	assert.Empty(t, preview.Error)
+	assert.Equal(t, "**SampleAlert** is firing", preview.Rendered)
+	assert.Equal(t, "built-in sample alert", preview.Sample)
+
+	preview = renderPreview("line one\n{{ .Labels.alertname | nope }}", data, "")
+	assert.Contains(t, preview.Error, `function "nope" not defined`)
+	assert.Equal(t, 2, preview.Line)
+	assert.Zero(t, preview.Column)
+
+	preview = renderPreview("line one\n  {{ .Missing }}", data, "")
+	assert.Contains(t, preview.Error, "can't evaluate field Missing")
+	assert.Equal(t, 2, preview.Line)
+	assert.Equal(t, 5, preview.Column)
+	assert.Equal(t, "alert", preview.Template)
+	assert.Empty(t, preview.Rendered)
+
+	// Errors in library templates point into the library template
+	data.library = parseLibrary(map[string]string{"summary": "{{ .Labels.alertname }}\n{{ .Missing }}"})
+	preview = renderPreview(`{{ template "summary" . }}`, data, "")
+	assert.Contains(t, preview.Error, "can't evaluate field Missing")
+	assert.Equal(t, "summary", preview.Template)
+	assert.Equal(t, 2, preview.Line)
+	assert.Equal(t, 3, preview.Column)
+}
+
+func TestAsResolved(t *testing.T) {
+	data := sampleTemplateData()
+	data.EndsAt = data.StartsAt
+
+	resolved := asResolved(data)
+	assert.Equal(t, alertStatusResolved, resolved.Status)
+	assert.True(t, resolved.EndsAt.After(resolved.StartsAt))
+	assert.Equal(t, "firing", data.Status)
+}
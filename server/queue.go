@@ -0,0 +1,716 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/alertmanager/notify/webhook"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+const (
+	queueKeyPrefix = "webhook_queue_"
+	// queueIndexKey lists the IDs of the queued webhooks of every node, so that stale webhooks
+	// are found without scanning the KV store
+	queueIndexKey = "webhook_index"
+
+	// queueWorkers is the number of goroutines processing queued webhooks
+	queueWorkers = 4
+	// queueMaxSize is the number of pending webhooks above which new ones are rejected with 429
+	queueMaxSize = 1000
+	// queueMaxAttempts is the number of processing attempts before a webhook is dropped
+	queueMaxAttempts = 5
+	// queueRetryInitialInterval and queueRetryMaxInterval bound the exponential retry backoff
+	queueRetryInitialInterval = 2 * time.Second
+	queueRetryMaxInterval     = 2 * time.Minute
+	// queueStaleAfter is the age after which a webhook persisted by another node is taken over.
+	// The owner refreshes its webhooks every queueRecoveryInterval while they are pending or in flight.
+	queueStaleAfter = 10 * time.Minute
+	// queueRecoveryInterval is how often owned webhooks are refreshed and the queue index is
+	// checked for stale webhooks
+	queueRecoveryInterval = time.Minute
+	// queueDrainTimeout bounds how long OnDeactivate waits for in-flight webhooks
+	queueDrainTimeout = 10 * time.Second
+	// queueRetryAfterSeconds is sent to Alertmanager with 429 responses
+	queueRetryAfterSeconds = "30"
+
+	queuePriorityCritical = 0
+	queuePriorityNormal   = 1
+
+	alertLockStripes = 64
+)
+
+// queuedWebhook is a webhook notification persisted in the KV store until it is processed
+type queuedWebhook struct {
+	Message webhook.Message `json:"message"`
+	// Grafana holds the Grafana fields of the alerts by fingerprint, for Grafana payloads
+	Grafana       map[string]grafanaAlert `json:"grafana,omitempty"`
+	ID            string                  `json:"id"`
+	ConfigID      string                  `json:"config_id"`
+	Owner         string                  `json:"owner"`
+	ReceivedAt    int64                   `json:"received_at"`
+	UpdatedAt     int64                   `json:"updated_at"`
+	NextAttemptAt int64                   `json:"next_attempt_at"`
+	Attempts      int                     `json:"attempts"`
+	Priority      int                     `json:"priority"`
+}
+
+// errQueuedWebhookNotOwned is returned when a queued webhook is gone or owned by another node
+var errQueuedWebhookNotOwned = errors.New("queued webhook not owned by this node")
+
+func getQueueKey(id string) string {
+	return queueKeyPrefix + id
+}
+
+// webhookPriority returns queuePriorityCritical when the message carries a firing critical alert
+func webhookPriority(message webhook.Message) int {
+	if message.Data == nil {
+		return queuePriorityNormal
+	}
+	for _, alert := range message.Alerts {
+		if alert.Status != alertStatusResolved && alert.Labels["severity"] == "critical" {
+			return queuePriorityCritical
+		}
+	}
+	return queuePriorityNormal
+}
+
+// before reports whether item a must be processed before item b
+func (a *queuedWebhook) before(b *queuedWebhook) bool {
+	if a.Priority != b.Priority {
+		return a.Priority < b.Priority
+	}
+	if a.NextAttemptAt != b.NextAttemptAt {
+		return a.NextAttemptAt < b.NextAttemptAt
+	}
+	return a.ReceivedAt < b.ReceivedAt
+}
+
+// webhookQueue is the in-memory view of the webhooks owned by this node.
+// Every item is also persisted in the KV store so it survives restarts.
+type webhookQueue struct {
+	items    map[string]*queuedWebhook
+	inFlight map[string]struct{}
+	wake     chan struct{}
+	stop     chan struct{}
+	// owner identifies this node in the persisted items
+	owner  string
+	wg     sync.WaitGroup
+	mu     sync.Mutex
+	closed bool
+}
+
+func newWebhookQueue() *webhookQueue {
+	owner, err := os.Hostname()
+	if err != nil || owner == "" {
+		owner = model.NewId()
+	}
+
+	return &webhookQueue{
+		items:    make(map[string]*queuedWebhook),
+		inFlight: make(map[string]struct{}),
+		wake:     make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		owner:    owner,
+	}
+}
+
+// size returns the number of pending and in-flight webhooks
+func (q *webhookQueue) size() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return len(q.items) + len(q.inFlight)
+}
+
+// push adds an item to the in-memory queue and wakes up a worker
+func (q *webhookQueue) push(item *queuedWebhook) {
+	q.mu.Lock()
+	q.items[item.ID] = item
+	q.mu.Unlock()
+
+	q.signal()
+}
+
+// signal wakes up an idle worker if there is pending work
+func (q *webhookQueue) signal() {
+	q.mu.Lock()
+	pending := len(q.items)
+	q.mu.Unlock()
+
+	if pending == 0 {
+		return
+	}
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// has reports whether the item is pending or in flight on this instance
+func (q *webhookQueue) has(id string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	_, pending := q.items[id]
+	_, inFlight := q.inFlight[id]
+	return pending || inFlight
+}
+
+// ids returns the IDs of the pending and in-flight webhooks
+func (q *webhookQueue) ids() []string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	ids := make([]string, 0, len(q.items)+len(q.inFlight))
+	for id := range q.items {
+		ids = append(ids, id)
+	}
+	for id := range q.inFlight {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// forget drops a pending item another node took over, an in-flight item notices it itself
+func (q *webhookQueue) forget(id string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	delete(q.items, id)
+}
+
+// pop removes and returns the next item ready to be processed, or the time to
+// wait for the next one to become ready.
+func (q *webhookQueue) pop(now int64) (*queuedWebhook, time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var next *queuedWebhook
+	var wait int64 = -1
+	for _, item := range q.items {
+		if item.NextAttemptAt > now {
+			if wait < 0 || item.NextAttemptAt-now < wait {
+				wait = item.NextAttemptAt - now
+			}
+			continue
+		}
+		if next == nil || item.before(next) {
+			next = item
+		}
+	}
+
+	if next == nil {
+		if wait < 0 {
+			return nil, queueRecoveryInterval
+		}
+		return nil, time.Duration(wait) * time.Millisecond
+	}
+
+	delete(q.items, next.ID)
+	q.inFlight[next.ID] = struct{}{}
+	return next, 0
+}
+
+// done marks an in-flight item as finished
+func (q *webhookQueue) done(id string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	delete(q.inFlight, id)
+}
+
+// next blocks until an item is ready or the queue is stopped, in which case it returns nil
+func (q *webhookQueue) next() *queuedWebhook {
+	for {
+		select {
+		case <-q.stop:
+			return nil
+		default:
+		}
+
+		item, wait := q.pop(model.GetMillis())
+		if item != nil {
+			// Hand the remaining items to another idle worker
+			q.signal()
+			return item
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-q.stop:
+			timer.Stop()
+			return nil
+		case <-q.wake:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// close stops the workers and waits up to queueDrainTimeout for in-flight items.
+// Pending items stay in the KV store and are recovered on the next activation.
+func (q *webhookQueue) close() bool {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return true
+	}
+	q.closed = true
+	close(q.stop)
+	q.mu.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		return true
+	case <-time.After(queueDrainTimeout):
+		return false
+	}
+}
+
+// startWebhookQueue recovers persisted webhooks and starts the worker pool
+func (p *Plugin) startWebhookQueue() {
+	p.queue = newWebhookQueue()
+	p.recoverQueuedWebhooks(true)
+
+	for i := 0; i < queueWorkers; i++ {
+		p.queue.wg.Add(1)
+		go func() {
+			defer p.queue.wg.Done()
+			for {
+				item := p.queue.next()
+				if item == nil {
+					return
+				}
+				p.processQueuedWebhook(item)
+				p.queue.done(item.ID)
+			}
+		}()
+	}
+
+	p.queue.wg.Add(1)
+	go func() {
+		defer p.queue.wg.Done()
+		ticker := time.NewTicker(queueRecoveryInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-p.queue.stop:
+				return
+			case <-ticker.C:
+				p.recoverQueuedWebhooks(false)
+			}
+		}
+	}()
+}
+
+// stopWebhookQueue drains in-flight webhooks before the plugin is deactivated
+func (p *Plugin) stopWebhookQueue() {
+	if p.queue == nil {
+		return
+	}
+
+	if !p.queue.close() {
+		p.API.LogWarn("[QUEUE] Timed out waiting for in-flight webhooks, they will be retried on next activation")
+	}
+}
+
+// enqueueWebhook persists the message and hands it to the worker pool.
+// It returns false when the queue is full.
+func (p *Plugin) enqueueWebhook(alertConfig alertConfig, message webhook.Message, grafana map[string]grafanaAlert) (bool, error) {
+	if p.queue.size() >= queueMaxSize {
+		return false, nil
+	}
+
+	now := model.GetMillis()
+	item := &queuedWebhook{
+		ID:            model.NewId(),
+		ConfigID:      alertConfig.ID,
+		Owner:         p.queue.owner,
+		Message:       message,
+		Grafana:       grafana,
+		ReceivedAt:    now,
+		UpdatedAt:     now,
+		NextAttemptAt: now,
+		Priority:      webhookPriority(message),
+	}
+
+	data, err := json.Marshal(item)
+	if err != nil {
+		return false, err
+	}
+	if appErr := p.API.KVSet(getQueueKey(item.ID), data); appErr != nil {
+		p.metrics.observeFailure(failureKV)
+		return false, appErr
+	}
+	if err := p.updateQueueIndex([]string{item.ID}, nil); err != nil {
+		_ = p.API.KVDelete(getQueueKey(item.ID))
+		return false, err
+	}
+
+	p.queue.push(item)
+	return true, nil
+}
+
+// getQueueIndex returns the IDs of the queued webhooks of every node, found is false before the
+// index was first written
+func (p *Plugin) getQueueIndex() (ids []string, found bool, err error) {
+	data, appErr := p.API.KVGet(queueIndexKey)
+	if appErr != nil {
+		return nil, false, appErr
+	}
+	if data == nil {
+		return nil, false, nil
+	}
+	if err := json.Unmarshal(data, &ids); err != nil {
+		return nil, false, err
+	}
+	return ids, true, nil
+}
+
+// updateQueueIndex adds and removes IDs of the index of queued webhooks atomically
+func (p *Plugin) updateQueueIndex(add, remove []string) error {
+	err := p.updateKVAtomically(queueIndexKey, 0, func(oldValue []byte) ([]byte, error) {
+		var ids []string
+		if oldValue != nil {
+			if err := json.Unmarshal(oldValue, &ids); err != nil {
+				return nil, err
+			}
+		}
+		return json.Marshal(applyQueueIndex(ids, add, remove))
+	})
+	if err != nil {
+		p.metrics.observeFailure(failureKV)
+	}
+	return err
+}
+
+// applyQueueIndex returns the sorted IDs of the index with the changes applied
+func applyQueueIndex(ids, add, remove []string) []string {
+	set := make(map[string]struct{}, len(ids)+len(add))
+	for _, id := range ids {
+		set[id] = struct{}{}
+	}
+	for _, id := range add {
+		set[id] = struct{}{}
+	}
+	for _, id := range remove {
+		delete(set, id)
+	}
+	return sortedKeys(set)
+}
+
+// indexLegacyQueuedWebhooks adds the webhooks queued before the index existed to it. It scans
+// the KV store once, later activations find the index and skip the scan.
+func (p *Plugin) indexLegacyQueuedWebhooks() error {
+	if _, found, err := p.getQueueIndex(); err != nil || found {
+		return err
+	}
+
+	ids := []string{}
+	for page := 0; ; page++ {
+		keys, appErr := p.API.KVList(page, 200)
+		if appErr != nil {
+			return appErr
+		}
+		for _, key := range keys {
+			if strings.HasPrefix(key, queueKeyPrefix) {
+				ids = append(ids, strings.TrimPrefix(key, queueKeyPrefix))
+			}
+		}
+		if len(keys) < 200 {
+			break
+		}
+	}
+	return p.updateQueueIndex(ids, nil)
+}
+
+// updateOwnedWebhook re-reads a queued webhook and applies change to it while this node still owns
+// it. The write is a compare-and-set, a takeover by another node is never overwritten. It returns
+// false when the webhook is gone or owned by another node.
+func (p *Plugin) updateOwnedWebhook(id string, change func(item *queuedWebhook)) (bool, error) {
+	err := p.updateKVAtomically(getQueueKey(id), 0, func(oldValue []byte) ([]byte, error) {
+		if oldValue == nil {
+			return nil, errQueuedWebhookNotOwned
+		}
+		var stored queuedWebhook
+		if err := json.Unmarshal(oldValue, &stored); err != nil {
+			return nil, err
+		}
+		if stored.Owner != p.queue.owner {
+			return nil, errQueuedWebhookNotOwned
+		}
+		change(&stored)
+		return json.Marshal(stored)
+	})
+	if errors.Is(err, errQueuedWebhookNotOwned) {
+		return false, nil
+	}
+	if err != nil {
+		p.metrics.observeFailure(failureKV)
+		return false, err
+	}
+	return true, nil
+}
+
+// deleteQueuedWebhook deletes a processed webhook while this node still owns it, a webhook taken
+// over by another node is left to it
+func (p *Plugin) deleteQueuedWebhook(id string) {
+	key := getQueueKey(id)
+	for i := 0; i < kvAtomicRetries; i++ {
+		data, appErr := p.API.KVGet(key)
+		if appErr != nil {
+			p.metrics.observeFailure(failureKV)
+			p.API.LogWarn("[QUEUE] Failed to delete processed webhook",
+				"queue_id", id,
+				"error", appErr.Error(),
+			)
+			return
+		}
+		if data != nil {
+			var stored queuedWebhook
+			if err := json.Unmarshal(data, &stored); err == nil && stored.Owner != p.queue.owner {
+				p.API.LogWarn("[QUEUE] Processed webhook was taken over by another node",
+					"queue_id", id,
+					"owner", stored.Owner,
+				)
+				return
+			}
+			deleted, appErr := p.API.KVCompareAndDelete(key, data)
+			if appErr != nil {
+				p.metrics.observeFailure(failureKV)
+				p.API.LogWarn("[QUEUE] Failed to delete processed webhook",
+					"queue_id", id,
+					"error", appErr.Error(),
+				)
+				return
+			}
+			if !deleted {
+				// Changed concurrently, e.g. by the refresh of the owned webhooks
+				continue
+			}
+		}
+
+		if err := p.updateQueueIndex(nil, []string{id}); err != nil {
+			p.API.LogWarn("[QUEUE] Failed to remove processed webhook from the queue index",
+				"queue_id", id,
+				"error", err.Error(),
+			)
+		}
+		return
+	}
+
+	p.API.LogWarn("[QUEUE] Failed to delete processed webhook: too many concurrent updates", "queue_id", id)
+}
+
+// processQueuedWebhook handles every alert of the item and schedules a retry
+// with the alerts that failed.
+func (p *Plugin) processQueuedWebhook(item *queuedWebhook) {
+	// Another node takes over webhooks it considers stale, the item is only processed
+	// while this node still owns it
+	owned, err := p.updateOwnedWebhook(item.ID, func(stored *queuedWebhook) {
+		stored.UpdatedAt = model.GetMillis()
+	})
+	if err != nil {
+		p.API.LogWarn("[QUEUE] Failed to check the owner of the webhook, retrying",
+			"queue_id", item.ID,
+			"error", err.Error(),
+		)
+		item.NextAttemptAt = model.GetMillis() + queueRetryInitialInterval.Milliseconds()
+		p.queue.push(item)
+		return
+	}
+	if !owned {
+		p.API.LogInfo("[QUEUE] Skipping webhook taken over by another node", "queue_id", item.ID)
+		return
+	}
+
+	configuration := p.getConfiguration()
+	alertConfig, ok := configuration.AlertConfigs[item.ConfigID]
+	if !ok {
+		p.API.LogWarn("[QUEUE] Dropping webhook for removed config",
+			"queue_id", item.ID,
+			"config_id", item.ConfigID,
+		)
+		p.deleteQueuedWebhook(item.ID)
+		return
+	}
+
+	failed, err := p.processWebhookMessage(alertConfig, item.Message, item.Grafana)
+	if err == nil && len(failed) == 0 {
+		p.deleteQueuedWebhook(item.ID)
+		return
+	}
+
+	item.Attempts++
+	if err == nil {
+		err = fmt.Errorf("%d alerts failed", len(failed))
+		item.Message.Alerts = failed
+		// The missing alerts were fetched already, the failed ones are retried
+		item.Message.TruncatedAlerts = 0
+	}
+
+	if item.Attempts >= queueMaxAttempts {
+		p.API.LogError("[QUEUE] Dropping webhook after too many attempts",
+			"queue_id", item.ID,
+			"config_id", item.ConfigID,
+			"attempts", item.Attempts,
+			"num_alerts", len(item.Message.Alerts),
+			"error", err.Error(),
+		)
+		p.deleteQueuedWebhook(item.ID)
+		return
+	}
+
+	delay := queueRetryInitialInterval << (item.Attempts - 1)
+	if delay > queueRetryMaxInterval {
+		delay = queueRetryMaxInterval
+	}
+	now := model.GetMillis()
+	item.UpdatedAt = now
+	item.NextAttemptAt = now + delay.Milliseconds()
+
+	p.API.LogWarn("[QUEUE] Webhook processing failed, retrying",
+		"queue_id", item.ID,
+		"config_id", item.ConfigID,
+		"attempts", item.Attempts,
+		"retry_in", delay.String(),
+		"error", err.Error(),
+	)
+
+	owned, saveErr := p.updateOwnedWebhook(item.ID, func(stored *queuedWebhook) {
+		*stored = *item
+	})
+	if saveErr != nil {
+		p.API.LogError("[QUEUE] Failed to persist webhook retry",
+			"queue_id", item.ID,
+			"error", saveErr.Error(),
+		)
+	} else if !owned {
+		p.API.LogInfo("[QUEUE] Webhook was taken over by another node, not retrying", "queue_id", item.ID)
+		return
+	}
+	p.queue.push(item)
+}
+
+// refreshOwnedWebhooks refreshes UpdatedAt of the webhooks pending or in flight on this node, so
+// that other nodes never consider them stale. Pending webhooks another node took over anyway are
+// dropped from the in-memory queue.
+func (p *Plugin) refreshOwnedWebhooks() {
+	now := model.GetMillis()
+	for _, id := range p.queue.ids() {
+		owned, err := p.updateOwnedWebhook(id, func(stored *queuedWebhook) {
+			stored.UpdatedAt = now
+		})
+		if err != nil {
+			p.API.LogWarn("[QUEUE] Failed to refresh queued webhook", "queue_id", id, "error", err.Error())
+			continue
+		}
+		if !owned {
+			p.queue.forget(id)
+		}
+	}
+}
+
+// recoverQueuedWebhooks takes over webhooks left in the KV store by a previous
+// activation on this node (at startup) or by a node that stopped processing them.
+// The webhooks are found through the queue index, the KV store is not scanned.
+func (p *Plugin) recoverQueuedWebhooks(startup bool) {
+	if startup {
+		if err := p.indexLegacyQueuedWebhooks(); err != nil {
+			p.API.LogError("[QUEUE] Failed to index queued webhooks", "error", err.Error())
+		}
+	} else {
+		p.refreshOwnedWebhooks()
+	}
+
+	ids, _, err := p.getQueueIndex()
+	if err != nil {
+		p.metrics.observeFailure(failureKV)
+		p.API.LogError("[QUEUE] Failed to get the queue index", "error", err.Error())
+		return
+	}
+
+	staleBefore := model.GetMillis() - queueStaleAfter.Milliseconds()
+	recovered := 0
+	var gone []string
+	for _, id := range ids {
+		if p.queue.has(id) {
+			continue
+		}
+
+		key := getQueueKey(id)
+		data, appErr := p.API.KVGet(key)
+		if appErr != nil {
+			continue
+		}
+		if data == nil {
+			gone = append(gone, id)
+			continue
+		}
+
+		var item queuedWebhook
+		if err := json.Unmarshal(data, &item); err != nil {
+			p.API.LogWarn("[QUEUE] Dropping undecodable queued webhook", "key", key, "error", err.Error())
+			_ = p.API.KVDelete(key)
+			gone = append(gone, id)
+			continue
+		}
+
+		ownItem := item.Owner == p.queue.owner
+		if ownItem && !startup {
+			continue
+		}
+		if !ownItem && item.UpdatedAt > staleBefore {
+			continue
+		}
+
+		item.Owner = p.queue.owner
+		item.UpdatedAt = model.GetMillis()
+		claimed, err := json.Marshal(item)
+		if err != nil {
+			continue
+		}
+		ok, appErr := p.API.KVCompareAndSet(key, data, claimed)
+		if appErr != nil || !ok {
+			continue
+		}
+
+		p.queue.push(&item)
+		recovered++
+	}
+
+	if len(gone) > 0 {
+		if err := p.updateQueueIndex(nil, gone); err != nil {
+			p.API.LogWarn("[QUEUE] Failed to prune the queue index", "error", err.Error())
+		}
+	}
+	if recovered > 0 {
+		p.API.LogInfo("[QUEUE] Recovered queued webhooks", "count", recovered)
+	}
+}
+
+// alertLocks serializes the processing of alerts sharing a fingerprint
+type alertLocks [alertLockStripes]sync.Mutex
+
+func (l *alertLocks) lock(fingerprint string) func() {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(fingerprint))
+	m := &l[h.Sum32()%alertLockStripes]
+	m.Lock()
+	return m.Unlock
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/alertmanager/notify/webhook"
+	"github.com/prometheus/alertmanager/template"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebhookPriority(t *testing.T) {
+	assert.Equal(t, queuePriorityNormal, webhookPriority(webhook.Message{}))
+
+	message := webhook.Message{Data: &template.Data{Alerts: template.Alerts{
+		{Status: "firing", Labels: template.KV{"severity": "warning"}},
+		{Status: "resolved", Labels: template.KV{"severity": "critical"}},
+	}}}
+	assert.Equal(t, queuePriorityNormal, webhookPriority(message))
+
+	message.Alerts = append(message.Alerts, template.Alert{Status: "firing", Labels: template.KV{"severity": "critical"}})
+	assert.Equal(t, queuePriorityCritical, webhookPriority(message))
+}
+
+func TestWebhookQueuePop(t *testing.T) {
+	q := newWebhookQueue()
+	q.push(&queuedWebhook{ID: "normal", Priority: queuePriorityNormal, ReceivedAt: 1, NextAttemptAt: 1})
+	q.push(&queuedWebhook{ID: "critical", Priority: queuePriorityCritical, ReceivedAt: 2, NextAttemptAt: 2})
+	q.push(&queuedWebhook{ID: "retry", Priority: queuePriorityCritical, ReceivedAt: 0, NextAttemptAt: 5000})
+
+	item, _ := q.pop(1000)
+	assert.Equal(t, "critical", item.ID)
+	assert.True(t, q.has("critical"), "in-flight items are still owned by the queue")
+	assert.Equal(t, 3, q.size())
+
+	item, _ = q.pop(1000)
+	assert.Equal(t, "normal", item.ID)
+
+	item, wait := q.pop(1000)
+	assert.Nil(t, item)
+	assert.Equal(t, 4*time.Second, wait)
+
+	q.done("critical")
+	q.done("normal")
+	assert.False(t, q.has("critical"))
+	assert.Equal(t, 1, q.size())
+}
+
+func TestApplyQueueIndex(t *testing.T) {
+	assert.Equal(t, []string{"a", "b"}, applyQueueIndex(nil, []string{"b", "a", "b"}, nil))
+	assert.Equal(t, []string{"a", "c"}, applyQueueIndex([]string{"a", "b"}, []string{"c"}, []string{"b", "missing"}))
+	assert.Empty(t, applyQueueIndex([]string{"a"}, nil, []string{"a"}))
+}
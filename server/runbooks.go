@@ -0,0 +1,397 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/prometheus/alertmanager/pkg/labels"
+	"github.com/prometheus/alertmanager/template"
+)
+
+const (
+	actionRunbook = "runbook"
+
+	runbookLibraryKey = "runbook_library"
+	// runbookMaxRunes keeps a runbook with its heading within a post
+	runbookMaxRunes = model.PostMessageMaxRunesV2 - 200
+)
+
+// runbook is the markdown posted in the threads of the alerts its key selects
+type runbook struct {
+	Body      string `json:"body"`
+	Author    string `json:"author"`
+	UpdatedAt int64  `json:"updated_at"`
+}
+
+// runbookLibrary holds the runbooks by key, an alertname or label matchers like
+// `severity="critical",team=~"db.*"`. It is stored under a single KV key.
+type runbookLibrary struct {
+	Runbooks map[string]runbook `json:"runbooks"`
+}
+
+// runbookMatchers returns the matchers of a runbook key, a key without a matcher is an alertname
+func runbookMatchers(key string) (labels.Matchers, error) {
+	if key == "" {
+		return nil, errors.New("missing runbook key")
+	}
+	if !strings.ContainsAny(key, "{}=~!") {
+		matcher, err := labels.NewMatcher(labels.MatchEqual, "alertname", key)
+		if err != nil {
+			return nil, err
+		}
+		return labels.Matchers{matcher}, nil
+	}
+
+	matchers, err := labels.ParseMatchers(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(matchers) == 0 {
+		return nil, fmt.Errorf("runbook key %q selects every alert", key)
+	}
+	return matchers, nil
+}
+
+// canonicalRunbookKey returns the key of the runbooks selecting the same alerts as key: matchers
+// without braces and spaces, in the quoting of their String method, or the alertname
+func canonicalRunbookKey(key string) (string, error) {
+	matchers, err := runbookMatchers(key)
+	if err != nil {
+		return "", err
+	}
+	if !strings.ContainsAny(key, "{}=~!") {
+		return key, nil
+	}
+	parts := make([]string, 0, len(matchers))
+	for _, matcher := range matchers {
+		parts = append(parts, matcher.String())
+	}
+	return strings.Join(parts, ","), nil
+}
+
+// splitRunbookKey splits the arguments of "/alertmanager runbook show|set|delete" into the key and
+// the rest. The key is one word, or matchers wrapped in braces that may contain spaces, e.g.
+// {severity="critical", team="db"}.
+func splitRunbookKey(args string) (key, rest string, err error) {
+	args = strings.TrimSpace(args)
+	if args == "" {
+		return "", "", errors.New("missing runbook key")
+	}
+
+	if strings.HasPrefix(args, "{") {
+		quoted, escaped := false, false
+		for i, r := range args {
+			switch {
+			case escaped:
+				escaped = false
+			case r == '\\':
+				escaped = true
+			case r == '"':
+				quoted = !quoted
+			case r == '}' && !quoted:
+				return args[:i+1], strings.TrimSpace(args[i+1:]), nil
+			}
+		}
+		return "", "", errors.New("the matchers of the runbook key miss their closing brace")
+	}
+
+	end := strings.IndexFunc(args, unicode.IsSpace)
+	if end < 0 {
+		return args, "", nil
+	}
+	return args[:end], strings.TrimSpace(args[end:]), nil
+}
+
+// keys returns the sorted keys of the runbooks
+func (lib *runbookLibrary) keys() []string {
+	keys := make([]string, 0, len(lib.Runbooks))
+	for key := range lib.Runbooks {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// lookup returns the stored key and the runbook of a key, keys selecting the same alerts find the
+// same runbook whatever their spacing and quoting
+func (lib *runbookLibrary) lookup(key string) (string, runbook, bool) {
+	if rb, ok := lib.Runbooks[key]; ok {
+		return key, rb, true
+	}
+	canonical, err := canonicalRunbookKey(key)
+	if err != nil {
+		return "", runbook{}, false
+	}
+	for _, stored := range lib.keys() {
+		if storedCanonical, err := canonicalRunbookKey(stored); err == nil && storedCanonical == canonical {
+			return stored, lib.Runbooks[stored], true
+		}
+	}
+	return "", runbook{}, false
+}
+
+// match returns the runbook of an alert, the matching runbook with the most matchers wins so that
+// a runbook of a team or severity refines the runbook of its alertname
+func (lib *runbookLibrary) match(alertLabels template.KV) (string, runbook, bool) {
+	best, bestMatchers := "", 0
+	for _, key := range lib.keys() {
+		matchers, err := runbookMatchers(key)
+		if err != nil || len(matchers) <= bestMatchers {
+			continue
+		}
+		matches := true
+		for _, matcher := range matchers {
+			if !matcher.Matches(alertLabels[matcher.Name]) {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			best, bestMatchers = key, len(matchers)
+		}
+	}
+	if best == "" {
+		return "", runbook{}, false
+	}
+	return best, lib.Runbooks[best], true
+}
+
+func (p *Plugin) getRunbookLibrary() (*runbookLibrary, error) {
+	data, appErr := p.API.KVGet(runbookLibraryKey)
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	var lib runbookLibrary
+	if data == nil {
+		return &lib, nil
+	}
+	if err := json.Unmarshal(data, &lib); err != nil {
+		return nil, err
+	}
+	return &lib, nil
+}
+
+// matchRunbook returns the runbook of an alert, none when the library cannot be read
+func (p *Plugin) matchRunbook(alert template.Alert) (string, runbook, bool) {
+	lib, err := p.getRunbookLibrary()
+	if err != nil {
+		p.API.LogWarn("Failed to get the runbook library", "error", err.Error())
+		return "", runbook{}, false
+	}
+	return lib.match(alert.Labels)
+}
+
+// updateRunbook changes the runbook of a key atomically, a nil runbook deletes it. It returns the
+// stored key, the key of an existing runbook selecting the same alerts or the canonical key.
+func (p *Plugin) updateRunbook(key string, change func(current runbook, ok bool) (*runbook, error)) (string, error) {
+	canonical, err := canonicalRunbookKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	var stored string
+	err = p.updateKVAtomically(runbookLibraryKey, 0, func(oldValue []byte) ([]byte, error) {
+		var lib runbookLibrary
+		if oldValue != nil {
+			if err := json.Unmarshal(oldValue, &lib); err != nil {
+				return nil, err
+			}
+		}
+
+		var current runbook
+		var ok bool
+		stored, current, ok = lib.lookup(key)
+		if !ok {
+			stored = canonical
+		}
+		updated, err := change(current, ok)
+		if err != nil {
+			return nil, err
+		}
+		if updated == nil {
+			delete(lib.Runbooks, stored)
+		} else {
+			if lib.Runbooks == nil {
+				lib.Runbooks = make(map[string]runbook)
+			}
+			lib.Runbooks[stored] = *updated
+		}
+		return json.Marshal(lib)
+	})
+	return stored, err
+}
+
+// postRunbookReply posts the runbook of an alert as a reply in the thread of its post
+func (p *Plugin) postRunbookReply(alertConfig alertConfig, channelID, postID, key string, rb runbook) {
+	l := configLocalizer(alertConfig)
+	reply := &model.Post{
+		ChannelId: channelID,
+		UserId:    p.BotUserID,
+		RootId:    postID,
+		Message:   l.T("runbook.thread", key, rb.Body),
+	}
+	if _, appErr := p.API.CreatePost(reply); appErr != nil {
+		p.metrics.observeFailure(failureCreatePost)
+		p.API.LogError("[WEBHOOK] Failed to post the runbook of the alert",
+			"post_id", postID,
+			"runbook", key,
+			"error", appErr.Error(),
+		)
+	}
+}
+
+// addRunbookButton adds the button showing the runbook of the alert, it needs the SiteURL
+func (p *Plugin) addRunbookButton(attachment *model.SlackAttachment, alertConfig alertConfig, key string) {
+	config := p.API.GetConfig()
+	if config == nil || config.ServiceSettings.SiteURL == nil || *config.ServiceSettings.SiteURL == "" {
+		return
+	}
+	siteURL := strings.TrimRight(*config.ServiceSettings.SiteURL, "/")
+
+	attachment.Actions = append(attachment.Actions, &model.PostAction{
+		Name: configLocalizer(alertConfig).T("button.runbook"),
+		Type: model.PostActionTypeButton,
+		Integration: &model.PostActionIntegration{
+			URL: fmt.Sprintf("%s/plugins/%s/api/action", siteURL, Manifest.Id),
+			Context: map[string]interface{}{
+				"action":    actionRunbook,
+				"config_id": alertConfig.ID,
+				"runbook":   key,
+			},
+		},
+	})
+}
+
+// handleRunbookAction shows the current runbook of a button to the user who clicked it
+func (p *Plugin) handleRunbookAction(w http.ResponseWriter, action Action) {
+	l := p.userLocalizer(action.UserID)
+	lib, err := p.getRunbookLibrary()
+	if err != nil {
+		p.API.LogError("[ACTION] Failed to get the runbook library", "error", err.Error())
+		encodeEphemeralMessage(w, l.T("runbook.unavailable"))
+		return
+	}
+
+	_, rb, ok := lib.lookup(action.Context.Runbook)
+	if !ok {
+		encodeEphemeralMessage(w, l.T("runbook.not_found", action.Context.Runbook))
+		return
+	}
+	encodeEphemeralMessage(w, l.T("runbook.thread", action.Context.Runbook, rb.Body))
+}
+
+// handleRunbook handles "/alertmanager runbook list|show|set|delete"
+func (p *Plugin) handleRunbook(args *model.CommandArgs, l localizer) (string, error) {
+	split := strings.Fields(args.Command)
+	if len(split) < 3 {
+		return l.T("command.runbook.usage"), nil
+	}
+
+	switch split[2] {
+	case "list":
+		return p.handleRunbookList(args, l)
+	case "show", "set", "delete":
+	default:
+		return l.T("command.runbook.usage"), nil
+	}
+
+	// The key is taken from the raw arguments, matchers in braces may contain spaces
+	key, rest, err := splitRunbookKey(skipCommandFields(args.Command, 3))
+	if err != nil {
+		return l.T("command.runbook.invalid", err), nil
+	}
+	if split[2] != "set" && rest != "" {
+		return l.T("command.runbook.invalid", fmt.Errorf("%q is followed by %q, wrap matchers with spaces in braces, e.g. {severity=\"critical\", team=\"db\"}", key, rest)), nil
+	}
+
+	if split[2] == "show" {
+		lib, err := p.getRunbookLibrary()
+		if err != nil {
+			return "", err
+		}
+		stored, rb, ok := lib.lookup(key)
+		if !ok {
+			return l.T("command.runbook.not_found", key), nil
+		}
+		return l.T("command.runbook.show", stored, formatRunbookVersion(rb, l, p.userLocation(args.UserId)), rb.Body), nil
+	}
+
+	if !p.API.HasPermissionTo(args.UserId, model.PermissionManageSystem) {
+		return l.T("command.runbook.forbidden"), nil
+	}
+	return p.handleRunbookChange(args, l, split[2], key, rest)
+}
+
+func (p *Plugin) handleRunbookList(args *model.CommandArgs, l localizer) (string, error) {
+	lib, err := p.getRunbookLibrary()
+	if err != nil {
+		return "", err
+	}
+	keys := lib.keys()
+	if len(keys) == 0 {
+		return l.T("command.runbook.empty"), nil
+	}
+
+	loc := p.userLocation(args.UserId)
+	lines := []string{l.T("command.runbook.list_title")}
+	for _, key := range keys {
+		lines = append(lines, l.T("command.runbook.list_entry", key, formatRunbookVersion(lib.Runbooks[key], l, loc)))
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// handleRunbookChange sets or deletes a runbook, body is the markdown following the key of set
+func (p *Plugin) handleRunbookChange(args *model.CommandArgs, l localizer, subcommand, key, body string) (string, error) {
+	if _, err := runbookMatchers(key); err != nil {
+		return l.T("command.runbook.invalid", err), nil
+	}
+	author := args.UserId
+	if user, appErr := p.API.GetUser(args.UserId); appErr == nil {
+		author = user.Username
+	}
+
+	if subcommand == "delete" {
+		stored, err := p.updateRunbook(key, func(_ runbook, ok bool) (*runbook, error) {
+			if !ok {
+				return nil, fmt.Errorf("runbook %q not found", key)
+			}
+			return nil, nil
+		})
+		if err != nil {
+			return "", err
+		}
+		p.API.LogInfo("[RUNBOOK] Runbook deleted", "runbook", stored, "author", author)
+		return l.T("command.runbook.deleted", stored), nil
+	}
+
+	// The markdown keeps its line breaks, a code block wrapping all of it is removed
+	body = commandBody(body)
+	if body == "" {
+		return l.T("command.runbook.usage"), nil
+	}
+	if utf8.RuneCountInString(body) > runbookMaxRunes {
+		return l.T("command.runbook.too_long", runbookMaxRunes), nil
+	}
+	stored, err := p.updateRunbook(key, func(runbook, bool) (*runbook, error) {
+		return &runbook{Body: body, Author: author, UpdatedAt: model.GetMillis()}, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	p.API.LogInfo("[RUNBOOK] Runbook saved", "runbook", stored, "author", author)
+	return l.T("command.runbook.saved", stored), nil
+}
+
+// formatRunbookVersion describes who last changed a runbook and when, e.g. "by @alice, 2024-11-21 10:00:00 UTC"
+func formatRunbookVersion(rb runbook, l localizer, loc *time.Location) string {
+	return l.T("command.runbook.version", rb.Author, time.UnixMilli(rb.UpdatedAt).In(loc).Format("2006-01-02 15:04:05 MST"))
+}
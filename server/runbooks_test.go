@@ -0,0 +1,109 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/prometheus/alertmanager/template"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunbookMatchers(t *testing.T) {
+	matchers, err := runbookMatchers("HighCPU")
+	require.NoError(t, err)
+	require.Len(t, matchers, 1)
+	assert.Equal(t, `alertname="HighCPU"`, matchers[0].String())
+
+	matchers, err = runbookMatchers(`alertname="HighCPU",team=~"db.*"`)
+	require.NoError(t, err)
+	assert.Len(t, matchers, 2)
+
+	for _, invalid := range []string{"", "{}", `team=~"("`} {
+		_, err := runbookMatchers(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestRunbookLibraryMatch(t *testing.T) {
+	lib := runbookLibrary{Runbooks: map[string]runbook{
+		"HighCPU":                          {Body: "Check the top processes."},
+		`alertname="HighCPU",team=~"db.*"`: {Body: "Check the slow queries."},
+		`severity="critical"`:              {Body: "Page the on-call."},
+	}}
+
+	key, rb, ok := lib.match(template.KV{"alertname": "HighCPU", "team": "web"})
+	require.True(t, ok)
+	assert.Equal(t, "HighCPU", key)
+	assert.Equal(t, "Check the top processes.", rb.Body)
+
+	// The runbook with the most matchers wins
+	key, _, ok = lib.match(template.KV{"alertname": "HighCPU", "team": "dba", "severity": "critical"})
+	require.True(t, ok)
+	assert.Equal(t, `alertname="HighCPU",team=~"db.*"`, key)
+
+	key, _, ok = lib.match(template.KV{"alertname": "DiskFull", "severity": "critical"})
+	require.True(t, ok)
+	assert.Equal(t, `severity="critical"`, key)
+
+	_, _, ok = lib.match(template.KV{"alertname": "DiskFull"})
+	assert.False(t, ok)
+}
+
+func TestRunbookCommandBody(t *testing.T) {
+	key, rest, err := splitRunbookKey(skipCommandFields("/alertmanager runbook set HighCPU ## Steps\n1. Check `top`\n2. Restart the service", 3))
+	require.NoError(t, err)
+	assert.Equal(t, "HighCPU", key)
+	assert.Equal(t, "## Steps\n1. Check `top`\n2. Restart the service", commandBody(rest))
+}
+
+func TestSplitRunbookKey(t *testing.T) {
+	key, rest, err := splitRunbookKey(`{severity="critical", team="db"} Page the DBA.`)
+	require.NoError(t, err)
+	assert.Equal(t, `{severity="critical", team="db"}`, key)
+	assert.Equal(t, "Page the DBA.", rest)
+
+	// Braces in quoted values do not end the matchers
+	key, rest, err = splitRunbookKey(`{team="}{ \"db\""}`)
+	require.NoError(t, err)
+	assert.Equal(t, `{team="}{ \"db\""}`, key)
+	assert.Empty(t, rest)
+
+	key, rest, err = splitRunbookKey(`severity="critical", team="db"`)
+	require.NoError(t, err)
+	assert.Equal(t, `severity="critical",`, key)
+	assert.Equal(t, `team="db"`, rest)
+
+	for _, invalid := range []string{"", `{severity="critical", team="db"`} {
+		_, _, err := splitRunbookKey(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestRunbookLibraryLookup(t *testing.T) {
+	canonical, err := canonicalRunbookKey(`{severity="critical", team="db"}`)
+	require.NoError(t, err)
+	assert.Equal(t, `severity="critical",team="db"`, canonical)
+
+	canonical, err = canonicalRunbookKey("HighCPU")
+	require.NoError(t, err)
+	assert.Equal(t, "HighCPU", canonical)
+
+	lib := runbookLibrary{Runbooks: map[string]runbook{
+		"HighCPU":                 {Body: "Check the top processes."},
+		`{severity="critical"}`:   {Body: "Page the on-call."},
+		`team="db",env=~"prod.*"`: {Body: "Check the slow queries."},
+	}}
+	for key, stored := range map[string]string{
+		"HighCPU":                       "HighCPU",
+		`severity="critical"`:           `{severity="critical"}`,
+		`{team="db", env=~"prod.*"}`:    `team="db",env=~"prod.*"`,
+		`{ team = "db", env=~"prod.*"}`: `team="db",env=~"prod.*"`,
+	} {
+		found, _, ok := lib.lookup(key)
+		require.True(t, ok, key)
+		assert.Equal(t, stored, found, key)
+	}
+
+	_, _, ok := lib.lookup(`team="web"`)
+	assert.False(t, ok)
+}
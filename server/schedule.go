@@ -0,0 +1,160 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSchedule is a standard 5 field cron expression: minute hour day-of-month month day-of-week
+type cronSchedule struct {
+	minutes  uint64
+	hours    uint64
+	days     uint64
+	months   uint64
+	weekdays uint64
+	// daysAny and weekdaysAny record an unrestricted field, when both day fields are
+	// restricted a time matches if either of them matches, like cron does
+	daysAny     bool
+	weekdaysAny bool
+}
+
+var cronAliases = map[string]string{
+	"@hourly":  "0 * * * *",
+	"@daily":   "0 0 * * *",
+	"@weekly":  "0 0 * * 0",
+	"@monthly": "0 0 1 * *",
+}
+
+// parseCronSchedule parses "*", "*/n", "a", "a-b", "a-b/n" and comma separated lists of them,
+// plus the @hourly, @daily, @weekly and @monthly aliases
+func parseCronSchedule(expr string) (*cronSchedule, error) {
+	expr = strings.TrimSpace(expr)
+	if alias, ok := cronAliases[expr]; ok {
+		expr = alias
+	}
+
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid schedule %q: expected 5 fields (minute hour day-of-month month day-of-week)", expr)
+	}
+
+	var schedule cronSchedule
+	var err error
+	if schedule.minutes, err = parseCronField(fields[0], 0, 59); err != nil {
+		return nil, fmt.Errorf("invalid minute field: %w", err)
+	}
+	if schedule.hours, err = parseCronField(fields[1], 0, 23); err != nil {
+		return nil, fmt.Errorf("invalid hour field: %w", err)
+	}
+	if schedule.days, err = parseCronField(fields[2], 1, 31); err != nil {
+		return nil, fmt.Errorf("invalid day-of-month field: %w", err)
+	}
+	if schedule.months, err = parseCronField(fields[3], 1, 12); err != nil {
+		return nil, fmt.Errorf("invalid month field: %w", err)
+	}
+	if schedule.weekdays, err = parseCronField(fields[4], 0, 7); err != nil {
+		return nil, fmt.Errorf("invalid day-of-week field: %w", err)
+	}
+	// 7 is an alias of Sunday
+	if schedule.weekdays&(1<<7) != 0 {
+		schedule.weekdays |= 1
+	}
+	schedule.daysAny = fields[2] == "*"
+	schedule.weekdaysAny = fields[4] == "*"
+
+	return &schedule, nil
+}
+
+func parseCronField(field string, minValue, maxValue int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+
+		step := 1
+		if hasStep {
+			var err error
+			step, err = strconv.Atoi(stepPart)
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step %q", stepPart)
+			}
+		}
+
+		low, high := minValue, maxValue
+		if rangePart != "*" {
+			from, to, isRange := strings.Cut(rangePart, "-")
+			var err error
+			if low, err = strconv.Atoi(from); err != nil {
+				return 0, fmt.Errorf("invalid value %q", from)
+			}
+			high = low
+			if isRange {
+				if high, err = strconv.Atoi(to); err != nil {
+					return 0, fmt.Errorf("invalid value %q", to)
+				}
+			} else if hasStep {
+				high = maxValue
+			}
+		}
+
+		if low < minValue || high > maxValue || low > high {
+			return 0, fmt.Errorf("%q is out of range %d-%d", part, minValue, maxValue)
+		}
+		for v := low; v <= high; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+
+	if bits == 0 {
+		return 0, errors.New("empty field")
+	}
+	return bits, nil
+}
+
+func (s *cronSchedule) matchesDay(t time.Time) bool {
+	day := s.days&(1<<uint(t.Day())) != 0
+	weekday := s.weekdays&(1<<uint(t.Weekday())) != 0
+	switch {
+	case s.daysAny && s.weekdaysAny:
+		return true
+	case s.daysAny:
+		return weekday
+	case s.weekdaysAny:
+		return day
+	default:
+		return day || weekday
+	}
+}
+
+// next returns the first time strictly after the given time matching the schedule,
+// evaluated in the location of the given time. It returns the zero time when nothing
+// matches within five years, e.g. for February 30th.
+func (s *cronSchedule) next(after time.Time) time.Time {
+	loc := after.Location()
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if s.months&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !s.matchesDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if s.hours&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+			continue
+		}
+		if s.minutes&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+
+	return time.Time{}
+}
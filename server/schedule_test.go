@@ -0,0 +1,62 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCronScheduleNext(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		expr     string
+		after    time.Time
+		expected time.Time
+	}{
+		{
+			expr:     "0 9 * * 1-5",
+			after:    time.Date(2024, 11, 22, 9, 0, 0, 0, berlin), // Friday
+			expected: time.Date(2024, 11, 25, 9, 0, 0, 0, berlin),
+		},
+		{
+			expr:     "*/15 * * * *",
+			after:    time.Date(2024, 11, 22, 9, 7, 30, 0, time.UTC),
+			expected: time.Date(2024, 11, 22, 9, 15, 0, 0, time.UTC),
+		},
+		{
+			expr:     "@weekly",
+			after:    time.Date(2024, 11, 22, 9, 0, 0, 0, time.UTC),
+			expected: time.Date(2024, 11, 24, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			expr:     "30 8 1,15 * 7",
+			after:    time.Date(2024, 11, 2, 0, 0, 0, 0, time.UTC),
+			expected: time.Date(2024, 11, 3, 8, 30, 0, 0, time.UTC),
+		},
+		{
+			// 02:30 does not exist on the DST switch day in Berlin
+			expr:     "30 2 * * *",
+			after:    time.Date(2024, 3, 30, 12, 0, 0, 0, berlin),
+			expected: time.Date(2024, 4, 1, 2, 30, 0, 0, berlin),
+		},
+	} {
+		t.Run(tc.expr, func(t *testing.T) {
+			schedule, err := parseCronSchedule(tc.expr)
+			require.NoError(t, err)
+			assert.True(t, tc.expected.Equal(schedule.next(tc.after)), "got %s", schedule.next(tc.after))
+		})
+	}
+
+	schedule, err := parseCronSchedule("0 0 30 2 *")
+	require.NoError(t, err)
+	assert.True(t, schedule.next(time.Now()).IsZero())
+
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "a * * * *"} {
+		_, err := parseCronSchedule(expr)
+		assert.Error(t, err, expr)
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin"
+)
+
+const (
+	// clusterEventReload asks every node of the cluster to reload its channel mappings
+	clusterEventReload = "reload_channel_mappings"
+
+	// reloadAttempts bounds the reloads racing with configuration changes
+	reloadAttempts = 3
+)
+
+// runtimeState is an immutable snapshot of the configuration and of the channel of each
+// alert config. It is replaced as a whole and never modified, so readers need no lock.
+type runtimeState struct {
+	configuration *configuration
+	// key - alert config id, value - existing or created channel id received from api
+	channelIDs map[string]string
+	// library is the parsed template library, reloaded when it changes on any node
+	library *parsedLibrary
+	// matchers are the parsed label matchers of each alert config
+	matchers map[string]*configMatchers
+}
+
+var emptyState = &runtimeState{
+	configuration: &configuration{AlertConfigs: make(map[string]alertConfig)},
+	channelIDs:    make(map[string]string),
+}
+
+// getState returns the current snapshot, the empty state before the configuration is loaded
+func (p *Plugin) getState() *runtimeState {
+	if state := p.state.Load(); state != nil {
+		return state
+	}
+	return emptyState
+}
+
+// getChannelID returns the channel of the alert config, empty when it is not mapped
+func (p *Plugin) getChannelID(configID string) string {
+	return p.getState().channelIDs[configID]
+}
+
+// ensureAlertChannels resolves the channel of every alert config, creating missing channels
+func (p *Plugin) ensureAlertChannels(configuration *configuration) map[string]string {
+	channelIDs := make(map[string]string, len(configuration.AlertConfigs))
+	for k, alertConfig := range configuration.AlertConfigs {
+		channelID, err := p.ensureAlertChannelExists(alertConfig)
+		if err != nil {
+			p.API.LogWarn(fmt.Sprintf("Failed to ensure alert channel %v", k), "error", err.Error())
+			continue
+		}
+
+		channelIDs[alertConfig.ID] = channelID
+		p.API.LogInfo(fmt.Sprintf("Mapped config %s to channel %s", alertConfig.ID, channelID))
+	}
+	return channelIDs
+}
+
+// parseMatchers parses the label matchers of every alert config
+func parseMatchers(configuration *configuration) map[string]*configMatchers {
+	matchers := make(map[string]*configMatchers, len(configuration.AlertConfigs))
+	for id, alertConfig := range configuration.AlertConfigs {
+		matchers[id] = parseConfigMatchers(alertConfig)
+	}
+	return matchers
+}
+
+// swapState replaces the snapshot with the one build returns for the current snapshot. The swap is
+// a compare-and-swap, when another swap wins meanwhile the snapshot is built again on top of it.
+func (p *Plugin) swapState(build func(current *runtimeState) *runtimeState) (*runtimeState, bool) {
+	for i := 0; i < reloadAttempts; i++ {
+		current := p.state.Load()
+		base := current
+		if base == nil {
+			base = emptyState
+		}
+
+		next := build(base)
+		if p.state.CompareAndSwap(current, next) {
+			return next, true
+		}
+	}
+	return nil, false
+}
+
+// applyConfiguration resolves the channels of a new configuration and swaps in the new snapshot
+func (p *Plugin) applyConfiguration(configuration *configuration) error {
+	next, ok := p.swapState(func(current *runtimeState) *runtimeState {
+		return &runtimeState{
+			configuration: configuration,
+			channelIDs:    p.ensureAlertChannels(configuration),
+			library:       p.loadLibrary(current.library),
+			matchers:      parseMatchers(configuration),
+		}
+	})
+	if !ok {
+		return errors.New("the channel mappings kept changing while applying the configuration")
+	}
+
+	p.API.LogInfo("Channel mappings reload completed", "mappings", fmt.Sprintf("%+v", next.channelIDs))
+	return nil
+}
+
+// reloadChannelMappings resolves the channels of the current configuration again. When the
+// configuration changes meanwhile, the reload starts over with the new configuration.
+func (p *Plugin) reloadChannelMappings() error {
+	p.API.LogInfo("Starting channel mappings reload")
+
+	next, ok := p.swapState(func(current *runtimeState) *runtimeState {
+		return &runtimeState{
+			configuration: current.configuration,
+			channelIDs:    p.ensureAlertChannels(current.configuration),
+			library:       p.loadLibrary(current.library),
+			matchers:      current.matchers,
+		}
+	})
+	if !ok {
+		return errors.New("the configuration kept changing during the reload")
+	}
+
+	p.API.LogInfo("Channel mappings reload completed", "mappings", fmt.Sprintf("%+v", next.channelIDs))
+	return nil
+}
+
+// publishReload asks the other nodes of the cluster to reload their channel mappings and template library
+func (p *Plugin) publishReload() error {
+	return p.API.PublishPluginClusterEvent(
+		model.PluginClusterEvent{Id: clusterEventReload},
+		model.PluginClusterEventSendOptions{SendType: model.PluginClusterEventSendTypeReliable},
+	)
+}
+
+// OnPluginClusterEvent handles the events published by the other nodes of the cluster.
+func (p *Plugin) OnPluginClusterEvent(_ *plugin.Context, ev model.PluginClusterEvent) {
+	switch ev.Id {
+	case clusterEventReload:
+		p.API.LogInfo("Reloading channel mappings requested by another node")
+		if err := p.reloadChannelMappings(); err != nil {
+			p.API.LogError("Failed to reload channel mappings", "error", err.Error())
+		}
+	default:
+		p.API.LogWarn("Unknown cluster event", "id", ev.Id)
+	}
+}
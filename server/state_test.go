@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/prometheus/alertmanager/notify/webhook"
+	"github.com/prometheus/alertmanager/template"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func newStateTestPlugin(t *testing.T) *Plugin {
+	api := &plugintest.API{}
+	for _, level := range []string{"LogDebug", "LogInfo", "LogWarn", "LogError"} {
+		api.On(level, mock.Anything).Maybe()
+		api.On(level, mock.Anything, mock.Anything, mock.Anything).Maybe()
+		api.On(level, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Maybe()
+		api.On(level, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Maybe()
+		api.On(level, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Maybe()
+		api.On(level, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Maybe()
+	}
+	api.On("GetTeamByName", mock.Anything).Return(&model.Team{Id: "team"}, nil).Maybe()
+	api.On("GetChannelByName", "team", mock.Anything, false).Return(
+		func(_, name string, _ bool) *model.Channel { return &model.Channel{Id: "channel-" + name} },
+		nil,
+	).Maybe()
+	api.On("KVGet", queueIndexKey).Return(nil, nil).Maybe()
+	api.On("KVGet", templateLibraryKey).Return(nil, nil).Maybe()
+	api.On("KVSet", mock.Anything, mock.Anything).Return(nil).Maybe()
+	api.On("KVSetWithOptions", mock.Anything, mock.Anything, mock.Anything).Return(true, nil).Maybe()
+	t.Cleanup(func() { api.AssertExpectations(t) })
+
+	p := &Plugin{}
+	p.SetAPI(api)
+	p.ingest = newIngestStats()
+	p.queue = newWebhookQueue()
+	return p
+}
+
+func stateTestConfiguration(channel string) *configuration {
+	return &configuration{AlertConfigs: map[string]alertConfig{
+		"0": {
+			ID:              "0",
+			Team:            "ops",
+			Channel:         channel,
+			Token:           "Qw8eR5tY2uI9oP3aS6dF1gH4jK7lZ0xC",
+			AlertManagerURL: "http://alertmanager:9093",
+		},
+	}}
+}
+
+func TestWebhookDuringReload(t *testing.T) {
+	p := newStateTestPlugin(t)
+	require.NoError(t, p.applyConfiguration(stateTestConfiguration("alerts")))
+	require.Equal(t, "channel-alerts", p.getChannelID("0"))
+
+	const webhooks = 50
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < webhooks; i++ {
+			message := webhook.Message{
+				Data: &template.Data{
+					Status: "firing",
+					Alerts: template.Alerts{{Status: "firing", Fingerprint: fmt.Sprintf("%016x", i)}},
+				},
+				GroupKey: fmt.Sprintf("group-%d", i),
+			}
+			body, err := json.Marshal(message)
+			require.NoError(t, err)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/api/webhook?token=Qw8eR5tY2uI9oP3aS6dF1gH4jK7lZ0xC", bytes.NewReader(body))
+			p.ServeHTTP(nil, w, r)
+			assert.Equal(t, http.StatusOK, w.Code)
+		}
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < webhooks; i++ {
+			assert.NoError(t, p.reloadChannelMappings())
+		}
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < webhooks; i++ {
+			assert.NoError(t, p.applyConfiguration(stateTestConfiguration(fmt.Sprintf("alerts-%d", i%2))))
+		}
+	}()
+
+	wg.Wait()
+	assert.Equal(t, webhooks, p.queue.size())
+
+	// The snapshot stays consistent: the channel always belongs to the configuration it is stored with
+	state := p.getState()
+	assert.Equal(t, "channel-"+state.configuration.AlertConfigs["0"].Channel, state.channelIDs["0"])
+}
+
+func TestConfigurationClone(t *testing.T) {
+	original := stateTestConfiguration("alerts")
+	alertCfg := original.AlertConfigs["0"]
+	alertCfg.SeverityMentions = SeverityMentionsMap{"critical": "@oncall"}
+	original.AlertConfigs["0"] = alertCfg
+
+	clone := original.Clone()
+	clone.AlertConfigs["0"].SeverityMentions["critical"] = "@here"
+	clone.AlertConfigs["1"] = alertConfig{ID: "1"}
+
+	assert.Equal(t, "@oncall", original.AlertConfigs["0"].SeverityMentions["critical"])
+	assert.Len(t, original.AlertConfigs, 1)
+}
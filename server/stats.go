@@ -0,0 +1,356 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+const (
+	defaultStatsPeriod = 7 * 24 * time.Hour
+	// statsTopN is the number of entries shown in each ranking of the stats report
+	statsTopN = 5
+)
+
+// alertIncident is one firing episode of an alert, from fire to resolution
+type alertIncident struct {
+	FiredAt     time.Time
+	AckedAt     time.Time
+	ResolvedAt  time.Time
+	Fingerprint string
+	Alertname   string
+	Severity    string
+	ConfigID    string
+	AckedBy     string
+}
+
+func (i alertIncident) acked() bool {
+	return !i.AckedAt.IsZero()
+}
+
+func (i alertIncident) resolved() bool {
+	return !i.ResolvedAt.IsZero()
+}
+
+// alertStats summarizes the incidents that fired within a period
+type alertStats struct {
+	Since         time.Time
+	Until         time.Time
+	Incidents     []alertIncident
+	ByAlertname   map[string]int
+	BySeverity    map[string]int
+	Flapping      map[string]int // fires per fingerprint
+	NeverAcked    map[string]int // unacknowledged incidents per alertname
+	ByHour        [24]int
+	TimeToAck     []time.Duration
+	TimeToResolve []time.Duration
+	Acked         int
+	// Location is the timezone of ByHour, nil when the configs of the incidents have different ones
+	Location *time.Location
+}
+
+// extractIncidents splits the timelines of the configs into incidents fired within [since, until),
+// their times are in the display timezone of their config
+func extractIncidents(histories []*alertHistory, configs map[string]alertConfig, since, until time.Time) []alertIncident {
+	var incidents []alertIncident
+	for _, history := range histories {
+		alertConfig, ok := configs[history.ConfigID]
+		if !ok {
+			continue
+		}
+		loc := mustDisplayLocation(alertConfig)
+
+		events := make([]alertEvent, len(history.Events))
+		copy(events, history.Events)
+		sort.SliceStable(events, func(i, j int) bool {
+			return events[i].Timestamp < events[j].Timestamp
+		})
+
+		var current *alertIncident
+		for _, event := range events {
+			at := time.UnixMilli(event.Timestamp).In(loc)
+			switch event.Type {
+			case eventFired:
+				if current != nil {
+					incidents = append(incidents, *current)
+					current = nil
+				}
+				if at.Before(since) || !at.Before(until) {
+					continue
+				}
+				current = &alertIncident{
+					FiredAt:     at,
+					Fingerprint: history.Fingerprint,
+					Alertname:   history.Labels["alertname"],
+					Severity:    history.Labels["severity"],
+					ConfigID:    history.ConfigID,
+				}
+			case eventAcked:
+				if current != nil && !current.acked() {
+					current.AckedAt = at
+					current.AckedBy = event.Actor
+				}
+			case eventResolved:
+				if current != nil {
+					current.ResolvedAt = at
+					incidents = append(incidents, *current)
+					current = nil
+				}
+			}
+		}
+		if current != nil {
+			incidents = append(incidents, *current)
+		}
+	}
+
+	sort.Slice(incidents, func(i, j int) bool {
+		return incidents[i].FiredAt.Before(incidents[j].FiredAt)
+	})
+	return incidents
+}
+
+// statsLocation returns the display timezone shared by the configs, nil when they have different ones
+func statsLocation(configs map[string]alertConfig) *time.Location {
+	var loc *time.Location
+	for _, id := range sortedKeys(configs) {
+		configLoc := mustDisplayLocation(configs[id])
+		if loc != nil && loc.String() != configLoc.String() {
+			return nil
+		}
+		loc = configLoc
+	}
+	return loc
+}
+
+func computeAlertStats(incidents []alertIncident, since, until time.Time) alertStats {
+	stats := alertStats{
+		Since:       since,
+		Until:       until,
+		Incidents:   incidents,
+		ByAlertname: make(map[string]int),
+		BySeverity:  make(map[string]int),
+		Flapping:    make(map[string]int),
+		NeverAcked:  make(map[string]int),
+	}
+
+	for _, incident := range incidents {
+		stats.ByAlertname[orUnknown(incident.Alertname)]++
+		stats.BySeverity[orUnknown(incident.Severity)]++
+		stats.Flapping[incident.Fingerprint]++
+		stats.ByHour[incident.FiredAt.Hour()]++
+
+		if incident.acked() {
+			stats.Acked++
+			stats.TimeToAck = append(stats.TimeToAck, incident.AckedAt.Sub(incident.FiredAt))
+		} else {
+			stats.NeverAcked[orUnknown(incident.Alertname)]++
+		}
+		if incident.resolved() {
+			stats.TimeToResolve = append(stats.TimeToResolve, incident.ResolvedAt.Sub(incident.FiredAt))
+		}
+	}
+
+	for fingerprint, fires := range stats.Flapping {
+		if fires < 2 {
+			delete(stats.Flapping, fingerprint)
+		}
+	}
+
+	return stats
+}
+
+func orUnknown(value string) string {
+	if value == "" {
+		return "unknown"
+	}
+	return value
+}
+
+func meanDuration(durations []time.Duration) time.Duration {
+	if len(durations) == 0 {
+		return 0
+	}
+	var total time.Duration
+	for _, d := range durations {
+		total += d
+	}
+	return total / time.Duration(len(durations))
+}
+
+// percentileDuration returns the nearest-rank percentile of the durations
+func percentileDuration(durations []time.Duration, percentile float64) time.Duration {
+	if len(durations) == 0 {
+		return 0
+	}
+	sorted := make([]time.Duration, len(durations))
+	copy(sorted, durations)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	rank := int(math.Ceil(percentile/100*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return sorted[rank]
+}
+
+// parseStatsPeriod accepts Go durations plus days and weeks, e.g. "12h", "7d", "4w"
+func parseStatsPeriod(value string) (time.Duration, error) {
+	if len(value) > 1 {
+		unit := value[len(value)-1]
+		if unit == 'd' || unit == 'w' {
+			n, err := strconv.Atoi(value[:len(value)-1])
+			if err == nil && n > 0 {
+				if unit == 'w' {
+					n *= 7
+				}
+				return time.Duration(n) * 24 * time.Hour, nil
+			}
+		}
+	}
+
+	period, err := time.ParseDuration(value)
+	if err != nil || period <= 0 {
+		return 0, fmt.Errorf("invalid period %q, use e.g. 24h, 7d or 4w", value)
+	}
+	return period, nil
+}
+
+type rankedEntry struct {
+	key   string
+	count int
+}
+
+// rankCounts sorts the counts descending, ties by key, and keeps the first limit entries
+func rankCounts(counts map[string]int, limit int) []rankedEntry {
+	entries := make([]rankedEntry, 0, len(counts))
+	for key, count := range counts {
+		entries = append(entries, rankedEntry{key: key, count: count})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].count != entries[j].count {
+			return entries[i].count > entries[j].count
+		}
+		return entries[i].key < entries[j].key
+	})
+	if limit > 0 && len(entries) > limit {
+		entries = entries[:limit]
+	}
+	return entries
+}
+
+func formatRanking(entries []rankedEntry, l localizer, label func(key string) string) string {
+	if len(entries) == 0 {
+		return l.T("list.none")
+	}
+	lines := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		lines = append(lines, fmt.Sprintf("%s: %d", label(entry.key), entry.count))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func busiestHours(byHour [24]int, limit int) []rankedEntry {
+	counts := make(map[string]int)
+	for hour, count := range byHour {
+		if count > 0 {
+			counts[fmt.Sprintf("%02d:00-%02d:00", hour, (hour+1)%24)] = count
+		}
+	}
+	return rankCounts(counts, limit)
+}
+
+// buildStatsAttachment renders the stats report
+func buildStatsAttachment(stats alertStats, l localizer, scope string) *model.SlackAttachment {
+	total := len(stats.Incidents)
+
+	ackedPercent := 0.0
+	if total > 0 {
+		ackedPercent = float64(stats.Acked) * 100 / float64(total)
+	}
+
+	alertnames := make(map[string]string)
+	for _, incident := range stats.Incidents {
+		alertnames[incident.Fingerprint] = orUnknown(incident.Alertname)
+	}
+	identity := func(key string) string { return fmt.Sprintf("`%s`", key) }
+
+	var fields []*model.SlackAttachmentField
+	fields = addFields(fields, l.T("stats.fired"), strconv.Itoa(total), true)
+	fields = addFields(fields, l.T("stats.acked"), fmt.Sprintf("%d (%.1f%%)", stats.Acked, ackedPercent), true)
+	fields = addFields(fields, l.T("stats.time_to_ack"), l.T("stats.mean_p90",
+		l.Duration(meanDuration(stats.TimeToAck)),
+		l.Duration(percentileDuration(stats.TimeToAck, 90)),
+	), true)
+	fields = addFields(fields, l.T("stats.time_to_resolve"), l.T("stats.mean_p90",
+		l.Duration(meanDuration(stats.TimeToResolve)),
+		l.Duration(percentileDuration(stats.TimeToResolve, 90)),
+	), true)
+	fields = addFields(fields, l.T("stats.by_alertname"), formatRanking(rankCounts(stats.ByAlertname, statsTopN), l, identity), true)
+	fields = addFields(fields, l.T("stats.by_severity"), formatRanking(rankCounts(stats.BySeverity, 0), l, identity), true)
+	fields = addFields(fields, l.T("stats.flapping"), formatRanking(rankCounts(stats.Flapping, statsTopN), l, func(fingerprint string) string {
+		return fmt.Sprintf("`%s` (`%s`)", alertnames[fingerprint], fingerprint)
+	}), true)
+	fields = addFields(fields, l.T("stats.never_acked"), formatRanking(rankCounts(stats.NeverAcked, statsTopN), l, identity), true)
+	hoursTitle := l.T("stats.busiest_hours_local")
+	if stats.Location != nil {
+		hoursTitle = l.T("stats.busiest_hours", stats.Location.String())
+	}
+	fields = addFields(fields, hoursTitle, formatRanking(busiestHours(stats.ByHour, 3), l, identity), false)
+
+	return &model.SlackAttachment{
+		Title: l.T("stats.title", scope),
+		Text: l.T("stats.period",
+			stats.Since.Format("2006-01-02 15:04 MST"),
+			stats.Until.Format("2006-01-02 15:04 MST"),
+		),
+		Fields: fields,
+		Color:  "#0066cc",
+	}
+}
+
+// statsCSV exports one row per incident
+func statsCSV(stats alertStats) ([]byte, error) {
+	formatTime := func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return t.Format(time.RFC3339)
+	}
+	formatSeconds := func(from, to time.Time) string {
+		if to.IsZero() {
+			return ""
+		}
+		return strconv.FormatInt(int64(to.Sub(from).Seconds()), 10)
+	}
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	_ = w.Write([]string{
+		"config_id", "fingerprint", "alertname", "severity",
+		"fired_at", "acked_at", "acked_by", "resolved_at",
+		"time_to_ack_seconds", "time_to_resolve_seconds",
+	})
+	for _, incident := range stats.Incidents {
+		_ = w.Write([]string{
+			incident.ConfigID,
+			incident.Fingerprint,
+			incident.Alertname,
+			incident.Severity,
+			formatTime(incident.FiredAt),
+			formatTime(incident.AckedAt),
+			incident.AckedBy,
+			formatTime(incident.ResolvedAt),
+			formatSeconds(incident.FiredAt, incident.AckedAt),
+			formatSeconds(incident.FiredAt, incident.ResolvedAt),
+		})
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestComputeAlertStats(t *testing.T) {
+	base := time.Date(2024, 11, 21, 10, 0, 0, 0, time.UTC)
+	at := func(minutes int) int64 { return base.Add(time.Duration(minutes) * time.Minute).UnixMilli() }
+
+	histories := []*alertHistory{
+		{
+			Fingerprint: "aaaaaaaaaaaaaaaa",
+			ConfigID:    "1",
+			Labels:      map[string]string{"alertname": "HighLatency", "severity": "critical"},
+			Events: []alertEvent{
+				{Type: eventFired, Timestamp: at(0)},
+				{Type: eventAcked, Actor: "alice", Timestamp: at(5)},
+				{Type: eventRepeat, Timestamp: at(10)},
+				{Type: eventResolved, Timestamp: at(30)},
+				{Type: eventFired, Timestamp: at(60)},
+				{Type: eventResolved, Timestamp: at(70)},
+			},
+		},
+		{
+			Fingerprint: "bbbbbbbbbbbbbbbb",
+			ConfigID:    "2",
+			Labels:      map[string]string{"alertname": "DiskFull", "severity": "warning"},
+			Events: []alertEvent{
+				{Type: eventFired, Timestamp: at(-120)},
+				{Type: eventResolved, Timestamp: at(15)},
+			},
+		},
+	}
+
+	since, until := base, base.Add(24*time.Hour)
+	configs := map[string]alertConfig{"1": {ID: "1"}, "2": {ID: "2"}}
+	incidents := extractIncidents(histories, configs, since, until)
+	require.Len(t, incidents, 2, "the incident fired before the period is ignored")
+
+	stats := computeAlertStats(incidents, since, until)
+	assert.Equal(t, 1, stats.Acked)
+	assert.Equal(t, map[string]int{"HighLatency": 2}, stats.ByAlertname)
+	assert.Equal(t, map[string]int{"aaaaaaaaaaaaaaaa": 2}, stats.Flapping)
+	assert.Equal(t, map[string]int{"HighLatency": 1}, stats.NeverAcked)
+	assert.Equal(t, 5*time.Minute, meanDuration(stats.TimeToAck))
+	assert.Equal(t, 20*time.Minute, meanDuration(stats.TimeToResolve))
+	assert.Equal(t, 30*time.Minute, percentileDuration(stats.TimeToResolve, 90))
+	assert.Equal(t, 1, stats.ByHour[10])
+	assert.Equal(t, 1, stats.ByHour[11])
+
+	assert.Empty(t, extractIncidents(histories, map[string]alertConfig{"2": configs["2"]}, since, until))
+
+	// The hours are bucketed in the timezone of the config
+	tokyo := map[string]alertConfig{"1": {ID: "1", Timezone: "Asia/Tokyo"}}
+	local := computeAlertStats(extractIncidents(histories, tokyo, since, until), since, until)
+	assert.Equal(t, 1, local.ByHour[19])
+	assert.Equal(t, 1, local.ByHour[20])
+	assert.Equal(t, "Asia/Tokyo", statsLocation(tokyo).String())
+	assert.Nil(t, statsLocation(map[string]alertConfig{"1": tokyo["1"], "2": configs["2"]}))
+
+	data, err := statsCSV(stats)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Len(t, lines, 3)
+	assert.Equal(t, "1,aaaaaaaaaaaaaaaa,HighLatency,critical,2024-11-21T10:00:00Z,2024-11-21T10:05:00Z,alice,2024-11-21T10:30:00Z,300,1800", lines[1])
+}
+
+func TestParseStatsPeriod(t *testing.T) {
+	for value, expected := range map[string]time.Duration{
+		"12h": 12 * time.Hour,
+		"7d":  7 * 24 * time.Hour,
+		"2w":  14 * 24 * time.Hour,
+	} {
+		period, err := parseStatsPeriod(value)
+		require.NoError(t, err, value)
+		assert.Equal(t, expected, period, value)
+	}
+
+	for _, value := range []string{"d", "0d", "-1h", "week"} {
+		_, err := parseStatsPeriod(value)
+		assert.Error(t, err, value)
+	}
+}
@@ -0,0 +1,469 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/alertmanager/template"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+const (
+	// stormWindow is the sliding window used to measure the alert rate of a channel
+	stormWindow = time.Minute
+	// stormFlushInterval limits how often the storm summary post is updated
+	stormFlushInterval = 5 * time.Second
+	// stormTopAlertnames is the number of alertnames listed in the storm summary
+	stormTopAlertnames = 10
+	// stormAlertKeyPrefix maps the fingerprint of an absorbed alert to the storm summary post, its
+	// repeats and resolution are handled on that thread instead of with a post of their own
+	stormAlertKeyPrefix = "storm_alert_"
+
+	colorStorm = "#8B0000" // dark red
+)
+
+// channelStorm holds the rate window and the storm summary of a single channel
+type channelStorm struct {
+	startedAt   time.Time
+	endedAt     time.Time
+	events      []time.Time
+	byAlertname map[string]int
+	bySeverity  map[string]int
+	flushTimer  *time.Timer
+	postID      string
+	threshold   int
+	location    *time.Location // display timezone of the config that started the storm
+	localizer   localizer      // language of the config that started the storm
+	firing      int
+	resolved    int
+	active      bool
+	dirty       bool
+}
+
+// stormTracker tracks alert rates per channel and the alert storms currently in progress. The rates
+// are kept in memory and counted per node: in a cluster, each node only sees the webhooks it receives.
+type stormTracker struct {
+	channels map[string]*channelStorm
+	// postLock serializes summary post creation and updates
+	postLock sync.Mutex
+	mu       sync.Mutex
+}
+
+func newStormTracker() *stormTracker {
+	return &stormTracker{
+		channels: make(map[string]*channelStorm),
+	}
+}
+
+// prune drops the rate events that fell out of the storm window
+func (s *channelStorm) prune(now time.Time) {
+	cutoff := now.Add(-stormWindow)
+	i := 0
+	for i < len(s.events) && !s.events[i].After(cutoff) {
+		i++
+	}
+	s.events = s.events[i:]
+}
+
+// record registers a new alert for the channel and reports whether the alert
+// belongs to a storm and whether this alert started it. The summary is written with l and its
+// times are displayed in loc.
+func (t *stormTracker) record(channelID string, threshold int, loc *time.Location, l localizer, now time.Time) (inStorm, started bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	storm, ok := t.channels[channelID]
+	if !ok {
+		storm = &channelStorm{}
+		t.channels[channelID] = storm
+	}
+
+	storm.prune(now)
+	storm.events = append(storm.events, now)
+
+	if storm.active {
+		return true, false
+	}
+
+	if len(storm.events) <= threshold {
+		return false, false
+	}
+
+	storm.active = true
+	storm.dirty = true
+	storm.startedAt = now
+	storm.endedAt = time.Time{}
+	storm.postID = ""
+	storm.threshold = threshold
+	storm.location = loc
+	storm.localizer = l
+	storm.firing = 0
+	storm.resolved = 0
+	storm.byAlertname = make(map[string]int)
+	storm.bySeverity = make(map[string]int)
+
+	return true, true
+}
+
+// active reports whether a storm is in progress for the channel
+func (t *stormTracker) active(channelID string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	storm, ok := t.channels[channelID]
+	return ok && storm.active
+}
+
+// count adds an alert to the summary of the storm in progress
+func (t *stormTracker) count(channelID string, alert template.Alert) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	storm, ok := t.channels[channelID]
+	if !ok || !storm.active {
+		return
+	}
+
+	alertname := alert.Labels["alertname"]
+	if alertname == "" {
+		alertname = "unknown"
+	}
+	severity := alert.Labels["severity"]
+	if severity == "" {
+		severity = "none"
+	}
+
+	if alert.Status == alertStatusResolved {
+		storm.resolved++
+	} else {
+		storm.firing++
+		storm.byAlertname[alertname]++
+		storm.bySeverity[severity]++
+	}
+	storm.dirty = true
+}
+
+// settle ends the storm when the alert rate dropped back to the threshold and
+// returns a copy of the storm state to be rendered. ok is false when there is
+// nothing to publish.
+func (t *stormTracker) settle(channelID string, now time.Time) (snapshot channelStorm, ok bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	storm, found := t.channels[channelID]
+	if !found || !storm.active {
+		return channelStorm{}, false
+	}
+
+	storm.prune(now)
+	if len(storm.events) <= storm.threshold {
+		storm.active = false
+		storm.endedAt = now
+		storm.dirty = true
+	}
+
+	if !storm.dirty {
+		return channelStorm{}, false
+	}
+	storm.dirty = false
+
+	snapshot = *storm
+	snapshot.byAlertname = make(map[string]int, len(storm.byAlertname))
+	for k, v := range storm.byAlertname {
+		snapshot.byAlertname[k] = v
+	}
+	snapshot.bySeverity = make(map[string]int, len(storm.bySeverity))
+	for k, v := range storm.bySeverity {
+		snapshot.bySeverity[k] = v
+	}
+	snapshot.events = nil
+	snapshot.flushTimer = nil
+
+	return snapshot, true
+}
+
+// setPostID remembers the summary post of the storm in progress
+func (t *stormTracker) setPostID(channelID, postID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if storm, ok := t.channels[channelID]; ok {
+		storm.postID = postID
+	}
+}
+
+// summaryPostID returns the summary post of the last storm of the channel, empty until it is created
+func (t *stormTracker) summaryPostID(channelID string) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if storm, ok := t.channels[channelID]; ok {
+		return storm.postID
+	}
+	return ""
+}
+
+// scheduleFlush arms the flush timer of the channel unless it is already armed
+func (t *stormTracker) scheduleFlush(channelID string, flush func()) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	storm, ok := t.channels[channelID]
+	if !ok || storm.flushTimer != nil {
+		return
+	}
+
+	storm.flushTimer = time.AfterFunc(stormFlushInterval, func() {
+		t.mu.Lock()
+		storm.flushTimer = nil
+		t.mu.Unlock()
+		flush()
+	})
+}
+
+// stop cancels all pending flushes
+func (t *stormTracker) stop() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, storm := range t.channels {
+		if storm.flushTimer != nil {
+			storm.flushTimer.Stop()
+			storm.flushTimer = nil
+		}
+	}
+}
+
+// absorbIntoStorm records the alert in the channel rate window and reports
+// whether it was absorbed into an alert storm summary instead of getting its
+// own post.
+func (p *Plugin) absorbIntoStorm(alertConfig alertConfig, alert template.Alert, channelID string) bool {
+	if alertConfig.StormThreshold <= 0 || p.storms == nil {
+		return false
+	}
+
+	inStorm, started := p.storms.record(channelID, alertConfig.StormThreshold, mustDisplayLocation(alertConfig), configLocalizer(alertConfig), time.Now())
+	if !inStorm {
+		return false
+	}
+
+	if started {
+		p.API.LogWarn("[STORM] Alert storm detected, switching to summary post",
+			"config_id", alertConfig.ID,
+			"channel_id", channelID,
+			"threshold", alertConfig.StormThreshold,
+		)
+	}
+
+	p.storms.count(channelID, alert)
+
+	if started {
+		p.flushStormSummary(channelID)
+	} else {
+		p.storms.scheduleFlush(channelID, func() { p.flushStormSummary(channelID) })
+	}
+
+	if postID := p.storms.summaryPostID(channelID); postID != "" {
+		// Alerts that never resolve, e.g. without send_resolved, must not leave their mapping forever
+		if appErr := p.API.KVSetWithExpiry(getStormAlertKey(alert.Fingerprint), []byte(postID), int64(historyRetention(alertConfig).Seconds())); appErr != nil {
+			p.metrics.observeFailure(failureKV)
+			p.API.LogWarn("[STORM] Failed to map the alert to the storm summary",
+				"fingerprint", alert.Fingerprint,
+				"error", appErr.Error(),
+			)
+		}
+	}
+
+	return true
+}
+
+func getStormAlertKey(fingerprint string) string {
+	return stormAlertKeyPrefix + fingerprint
+}
+
+// getStormAlertPost returns the storm summary post an alert was absorbed into, empty when it was not
+func (p *Plugin) getStormAlertPost(fingerprint string) (string, error) {
+	data, appErr := p.API.KVGet(getStormAlertKey(fingerprint))
+	if appErr != nil {
+		return "", appErr
+	}
+	return string(data), nil
+}
+
+// resolveStormAlert replies in the thread of the storm summary an alert was absorbed into that
+// the alert resolved, so that it does not get a post of its own once the storm is over
+func (p *Plugin) resolveStormAlert(alertConfig alertConfig, alert template.Alert, channelID, summaryPostID string) error {
+	l := configLocalizer(alertConfig)
+	reply := &model.Post{
+		ChannelId: channelID,
+		UserId:    p.BotUserID,
+		RootId:    summaryPostID,
+		Message: l.T("storm.alert_resolved", alert.Labels["alertname"], l.Duration(alert.EndsAt.Sub(alert.StartsAt)),
+			formatLabelPairs(alert.Labels)),
+	}
+	createdPost, appErr := p.API.CreatePost(reply)
+	if appErr != nil {
+		p.metrics.observeFailure(failureCreatePost)
+		p.API.LogError("[STORM] Failed to reply to the storm summary for a resolved alert",
+			"post_id", summaryPostID,
+			"fingerprint", alert.Fingerprint,
+			"error", appErr.Error(),
+		)
+		return fmt.Errorf("failed to create storm thread post: %w", appErr)
+	}
+
+	p.recordAlertEventFromAlert(alertConfig, alert, eventResolved, createdPost.Id)
+	if appErr := p.API.KVDelete(getStormAlertKey(alert.Fingerprint)); appErr != nil {
+		p.metrics.observeFailure(failureKV)
+		p.API.LogWarn("[STORM] Failed to delete the storm mapping of the alert",
+			"fingerprint", alert.Fingerprint,
+			"error", appErr.Error(),
+		)
+	}
+	return nil
+}
+
+// absorbResolvedIntoStorm counts a resolved alert without a post in the storm
+// summary when a storm is in progress for the channel.
+func (p *Plugin) absorbResolvedIntoStorm(alert template.Alert, channelID string) bool {
+	if p.storms == nil || !p.storms.active(channelID) {
+		return false
+	}
+
+	p.storms.count(channelID, alert)
+	p.storms.scheduleFlush(channelID, func() { p.flushStormSummary(channelID) })
+
+	return true
+}
+
+// flushStormSummary creates or updates the storm summary post of the channel
+// and keeps re-checking the alert rate until the storm is over.
+func (p *Plugin) flushStormSummary(channelID string) {
+	p.storms.postLock.Lock()
+	defer p.storms.postLock.Unlock()
+
+	storm, ok := p.storms.settle(channelID, time.Now())
+	if !ok {
+		if p.storms.active(channelID) {
+			p.storms.scheduleFlush(channelID, func() { p.flushStormSummary(channelID) })
+		}
+		return
+	}
+
+	post := &model.Post{
+		ChannelId: channelID,
+		UserId:    p.BotUserID,
+	}
+	model.ParseSlackAttachment(post, []*model.SlackAttachment{buildStormAttachment(storm)})
+
+	if storm.postID == "" {
+		createdPost, appErr := p.API.CreatePost(post)
+		if appErr != nil {
+			p.API.LogError("[STORM] Failed to create storm summary post",
+				"channel_id", channelID,
+				"error", appErr.Error(),
+			)
+		} else {
+			p.storms.setPostID(channelID, createdPost.Id)
+		}
+	} else {
+		post.Id = storm.postID
+		if _, appErr := p.API.UpdatePost(post); appErr != nil {
+			p.API.LogError("[STORM] Failed to update storm summary post",
+				"channel_id", channelID,
+				"post_id", storm.postID,
+				"error", appErr.Error(),
+			)
+		}
+	}
+
+	if storm.active {
+		p.storms.scheduleFlush(channelID, func() { p.flushStormSummary(channelID) })
+		return
+	}
+
+	p.API.LogInfo("[STORM] Alert storm ended, switching back to individual posts",
+		"channel_id", channelID,
+		"firing", storm.firing,
+		"resolved", storm.resolved,
+	)
+}
+
+func buildStormAttachment(storm channelStorm) *model.SlackAttachment {
+	l := storm.localizer
+	if l.language == "" {
+		l = newLocalizer(defaultLanguage)
+	}
+
+	title := l.T("storm.title")
+	color := colorStorm
+	text := l.T("storm.text", storm.threshold)
+	if !storm.active {
+		title = l.T("storm.ended_title")
+		color = colorResolved
+		text = l.T("storm.ended_text", storm.threshold)
+	}
+
+	var fields []*model.SlackAttachmentField
+	fields = addFields(fields, l.T("storm.firing"), fmt.Sprintf("%d", storm.firing), true)
+	fields = addFields(fields, l.T("storm.resolved"), fmt.Sprintf("%d", storm.resolved), true)
+
+	loc := storm.location
+	if loc == nil {
+		loc = time.UTC
+	}
+	started := formatAlertTime(storm.startedAt, loc)
+	if storm.active {
+		fields = addFields(fields, l.T("alert.started_at"), started, true)
+	} else {
+		fields = addFields(fields, l.T("alert.duration"), l.T("storm.duration", l.Duration(storm.endedAt.Sub(storm.startedAt)), started), true)
+	}
+
+	fields = addFields(fields, l.T("storm.by_severity"), formatStormCounts(storm.bySeverity, 0, l), true)
+	fields = addFields(fields, l.T("storm.by_alertname"), formatStormCounts(storm.byAlertname, stormTopAlertnames, l), false)
+
+	return &model.SlackAttachment{
+		Title:  title,
+		Text:   text,
+		Fields: fields,
+		Color:  color,
+	}
+}
+
+// formatStormCounts renders the counts sorted by descending count, keeping at
+// most limit entries (0 keeps all of them)
+func formatStormCounts(counts map[string]int, limit int, l localizer) string {
+	if len(counts) == 0 {
+		return "-"
+	}
+
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+
+	var lines []string
+	others := 0
+	for i, k := range keys {
+		if limit > 0 && i >= limit {
+			others += counts[k]
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("**%s:** %d", k, counts[k]))
+	}
+	if others > 0 {
+		lines = append(lines, l.T("storm.others", others))
+	}
+
+	return strings.Join(lines, "\n")
+}
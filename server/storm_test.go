@@ -0,0 +1,64 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/alertmanager/template"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStormTrackerLifecycle(t *testing.T) {
+	tracker := newStormTracker()
+	now := time.Now()
+	alert := template.Alert{
+		Status: "firing",
+		Labels: template.KV{"alertname": "HighLatency", "severity": "critical"},
+	}
+
+	for i := 0; i < 3; i++ {
+		inStorm, started := tracker.record("channel", 3, time.UTC, newLocalizer(defaultLanguage), now)
+		assert.False(t, inStorm)
+		assert.False(t, started)
+	}
+
+	inStorm, started := tracker.record("channel", 3, time.UTC, newLocalizer(defaultLanguage), now)
+	assert.True(t, inStorm)
+	assert.True(t, started)
+	tracker.count("channel", alert)
+
+	inStorm, started = tracker.record("channel", 3, time.UTC, newLocalizer(defaultLanguage), now)
+	assert.True(t, inStorm)
+	assert.False(t, started)
+	tracker.count("channel", alert)
+
+	snapshot, ok := tracker.settle("channel", now)
+	assert.True(t, ok)
+	assert.True(t, snapshot.active)
+	assert.Equal(t, 2, snapshot.firing)
+	assert.Equal(t, 2, snapshot.byAlertname["HighLatency"])
+	assert.Equal(t, 2, snapshot.bySeverity["critical"])
+
+	_, ok = tracker.settle("channel", now)
+	assert.False(t, ok, "nothing changed since the last flush")
+
+	assert.Empty(t, tracker.summaryPostID("channel"))
+	tracker.setPostID("channel", "summary")
+	assert.Equal(t, "summary", tracker.summaryPostID("channel"))
+
+	snapshot, ok = tracker.settle("channel", now.Add(stormWindow+time.Second))
+	assert.True(t, ok)
+	assert.False(t, snapshot.active)
+	assert.False(t, tracker.active("channel"))
+
+	inStorm, _ = tracker.record("other", 3, time.UTC, newLocalizer(defaultLanguage), now)
+	assert.False(t, inStorm, "storms are tracked per channel")
+}
+
+func TestFormatStormCounts(t *testing.T) {
+	assert.Equal(t, "-", formatStormCounts(nil, 0, newLocalizer(defaultLanguage)))
+	assert.Equal(t,
+		"**b:** 3\n**a:** 1\n_others:_ 1",
+		formatStormCounts(map[string]int{"a": 1, "b": 3, "c": 1}, 2, newLocalizer(defaultLanguage)),
+	)
+}
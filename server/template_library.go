@@ -0,0 +1,410 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+const (
+	templateLibraryKey = "template_library"
+	// templateLibraryMaxVersions bounds the versions kept per library template
+	templateLibraryMaxVersions = 20
+)
+
+var templateNameRegexp = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// templateVersion is a version of a library template, its deletion when Deleted is set
+type templateVersion struct {
+	Version   int    `json:"version"`
+	Body      string `json:"body,omitempty"`
+	Deleted   bool   `json:"deleted,omitempty"`
+	Author    string `json:"author"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// templateLibrary holds the shared named templates with their versions, oldest first. It is
+// stored under a single KV key.
+type templateLibrary struct {
+	Templates map[string][]templateVersion `json:"templates"`
+}
+
+// current returns the latest version of a template, false when it does not exist or was deleted
+func (lib *templateLibrary) current(name string) (templateVersion, bool) {
+	versions := lib.Templates[name]
+	if len(versions) == 0 || versions[len(versions)-1].Deleted {
+		return templateVersion{}, false
+	}
+	return versions[len(versions)-1], true
+}
+
+// version returns a version of a template, false when it is not kept
+func (lib *templateLibrary) version(name string, version int) (templateVersion, bool) {
+	for _, v := range lib.Templates[name] {
+		if v.Version == version {
+			return v, true
+		}
+	}
+	return templateVersion{}, false
+}
+
+// names returns the sorted names of the templates that exist
+func (lib *templateLibrary) names() []string {
+	names := make([]string, 0, len(lib.Templates))
+	for name := range lib.Templates {
+		if _, ok := lib.current(name); ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// bodies returns the current body of every template, by name
+func (lib *templateLibrary) bodies() map[string]string {
+	bodies := make(map[string]string, len(lib.Templates))
+	for _, name := range lib.names() {
+		current, _ := lib.current(name)
+		bodies[name] = current.Body
+	}
+	return bodies
+}
+
+// add appends a version to a template, numbering it after the latest one and dropping the
+// versions beyond templateLibraryMaxVersions
+func (lib *templateLibrary) add(name string, version templateVersion) templateVersion {
+	if lib.Templates == nil {
+		lib.Templates = make(map[string][]templateVersion)
+	}
+	versions := lib.Templates[name]
+	version.Version = 1
+	if len(versions) > 0 {
+		version.Version = versions[len(versions)-1].Version + 1
+	}
+	versions = append(versions, version)
+	if len(versions) > templateLibraryMaxVersions {
+		versions = versions[len(versions)-templateLibraryMaxVersions:]
+	}
+	lib.Templates[name] = versions
+	return version
+}
+
+// validateTemplateName checks that a name can be used with the template action
+func validateTemplateName(name string) error {
+	if !templateNameRegexp.MatchString(name) {
+		return fmt.Errorf("invalid template name %q, use letters, digits, '.', '_' and '-'", name)
+	}
+	if name == "alert" {
+		return errors.New(`the template name "alert" is reserved`)
+	}
+	return nil
+}
+
+// validateTemplateLibrary trial-renders every template of the library, and rejects the library when
+// a config whose templates rendered with the old library fails with the new one. Library templates
+// are rendered against a thread event, which has the fields of both alert and thread templates.
+func validateTemplateLibrary(oldLibrary, newLibrary map[string]string, configs map[string]alertConfig) error {
+	var errs []error
+
+	data := sampleThreadTemplateData(threadEventSilenced)
+	data.library = parseLibrary(newLibrary)
+	for _, name := range sortedKeys(newLibrary) {
+		if _, err := renderThreadTemplate(fmt.Sprintf("{{ template %q . }}", name), data); err != nil {
+			errs = append(errs, fmt.Errorf("template %q: %w", name, err))
+		}
+	}
+
+	ids := make([]string, 0, len(configs))
+	for id := range configs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		alertConfig := configs[id]
+		if len(alertConfig.validateTemplates(oldLibrary)) > 0 {
+			continue
+		}
+		errs = append(errs, alertConfig.validateTemplates(newLibrary)...)
+	}
+
+	return errors.Join(errs...)
+}
+
+func (p *Plugin) getTemplateLibrary() (*templateLibrary, error) {
+	data, appErr := p.API.KVGet(templateLibraryKey)
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	var lib templateLibrary
+	if data == nil {
+		return &lib, nil
+	}
+	if err := json.Unmarshal(data, &lib); err != nil {
+		return nil, err
+	}
+	return &lib, nil
+}
+
+// templateLibraryBodies returns the current templates of the library, none when it cannot be read
+func (p *Plugin) templateLibraryBodies() map[string]string {
+	lib, err := p.getTemplateLibrary()
+	if err != nil {
+		p.API.LogWarn("Failed to get the template library", "error", err.Error())
+		return nil
+	}
+	return lib.bodies()
+}
+
+// parsedLibrary is the template library of the runtime snapshot, parsed once per change
+type parsedLibrary struct {
+	bodies map[string]string
+	// templates holds the library templates next to an empty "alert" template, the functions
+	// of an alert are bound to a clone of it
+	templates *template.Template
+	// err is the first parse error, a library saved with the commands always parses
+	err error
+}
+
+// parseLibrary parses the templates of a library
+func parseLibrary(bodies map[string]string) *parsedLibrary {
+	lib := &parsedLibrary{
+		bodies:    bodies,
+		templates: template.New("alert").Funcs(alertTemplateFuncs(alertTemplateData{})),
+	}
+	for _, name := range sortedKeys(bodies) {
+		if _, err := lib.templates.New(name).Parse(bodies[name]); err != nil {
+			lib.err = fmt.Errorf("failed to parse library template %q: %w", name, err)
+			break
+		}
+	}
+	return lib
+}
+
+// loadLibrary reads and parses the template library for a new snapshot, the library of the
+// current snapshot is kept when it cannot be read
+func (p *Plugin) loadLibrary(current *parsedLibrary) *parsedLibrary {
+	lib, err := p.getTemplateLibrary()
+	if err != nil {
+		p.API.LogWarn("Failed to get the template library", "error", err.Error())
+		return current
+	}
+	return parseLibrary(lib.bodies())
+}
+
+// reloadTemplateLibrary swaps in the changed template library, and asks the other nodes of the
+// cluster to reload theirs
+func (p *Plugin) reloadTemplateLibrary() {
+	_, ok := p.swapState(func(current *runtimeState) *runtimeState {
+		return &runtimeState{
+			configuration: current.configuration,
+			channelIDs:    current.channelIDs,
+			library:       p.loadLibrary(current.library),
+		}
+	})
+	if !ok {
+		p.API.LogError("Failed to reload the template library: the configuration kept changing")
+	}
+
+	if err := p.publishReload(); err != nil {
+		p.API.LogError("Failed to ask the other nodes to reload the template library", "error", err.Error())
+	}
+}
+
+// updateTemplate adds a version to a library template once the library with it is validated
+func (p *Plugin) updateTemplate(name string, change func(lib *templateLibrary) (templateVersion, error)) (templateVersion, error) {
+	if err := validateTemplateName(name); err != nil {
+		return templateVersion{}, err
+	}
+
+	var added templateVersion
+	err := p.updateKVAtomically(templateLibraryKey, 0, func(oldValue []byte) ([]byte, error) {
+		var lib templateLibrary
+		if oldValue != nil {
+			if err := json.Unmarshal(oldValue, &lib); err != nil {
+				return nil, err
+			}
+		}
+
+		oldBodies := lib.bodies()
+		version, err := change(&lib)
+		if err != nil {
+			return nil, err
+		}
+		version.CreatedAt = model.GetMillis()
+		added = lib.add(name, version)
+
+		if err := validateTemplateLibrary(oldBodies, lib.bodies(), p.getConfiguration().AlertConfigs); err != nil {
+			return nil, err
+		}
+		return json.Marshal(lib)
+	})
+	if err != nil {
+		return templateVersion{}, err
+	}
+
+	p.API.LogInfo("[TEMPLATE] Template library changed",
+		"name", name,
+		"version", added.Version,
+		"deleted", added.Deleted,
+		"author", added.Author,
+	)
+	p.reloadTemplateLibrary()
+	return added, nil
+}
+
+// setTemplate creates or changes a library template
+func (p *Plugin) setTemplate(name, body, author string) (templateVersion, error) {
+	return p.updateTemplate(name, func(lib *templateLibrary) (templateVersion, error) {
+		if body == "" {
+			return templateVersion{}, errors.New("the template is empty")
+		}
+		if _, err := parseAlertTemplate(body); err != nil {
+			return templateVersion{}, err
+		}
+		return templateVersion{Body: body, Author: author}, nil
+	})
+}
+
+// deleteTemplate deletes a library template, its versions are kept for a rollback
+func (p *Plugin) deleteTemplate(name, author string) (templateVersion, error) {
+	return p.updateTemplate(name, func(lib *templateLibrary) (templateVersion, error) {
+		if _, ok := lib.current(name); !ok {
+			return templateVersion{}, fmt.Errorf("template %q not found", name)
+		}
+		return templateVersion{Deleted: true, Author: author}, nil
+	})
+}
+
+// rollbackTemplate restores a previous version of a library template as its latest version
+func (p *Plugin) rollbackTemplate(name string, version int, author string) (templateVersion, error) {
+	return p.updateTemplate(name, func(lib *templateLibrary) (templateVersion, error) {
+		previous, ok := lib.version(name, version)
+		if !ok {
+			return templateVersion{}, fmt.Errorf("version %d of template %q not found", version, name)
+		}
+		if previous.Deleted {
+			return templateVersion{}, fmt.Errorf("version %d of template %q is a deletion", version, name)
+		}
+		return templateVersion{Body: previous.Body, Author: author}, nil
+	})
+}
+
+// formatTemplateVersion describes a version of a library template, e.g. "v3 by @alice, 2024-11-21 10:00:00 UTC"
+func formatTemplateVersion(version templateVersion, l localizer, loc *time.Location) string {
+	id := "command.template.version"
+	if version.Deleted {
+		id = "command.template.version_deleted"
+	}
+	return l.T(id, version.Version, version.Author, time.UnixMilli(version.CreatedAt).In(loc).Format("2006-01-02 15:04:05 MST"))
+}
+
+// libraryTemplateResponse is a library template of the admin API, with its versions when requested
+type libraryTemplateResponse struct {
+	Name     string            `json:"name"`
+	Current  templateVersion   `json:"current"`
+	Versions []templateVersion `json:"versions,omitempty"`
+}
+
+// handleTemplateLibrary serves the template library to system admins:
+//
+//	GET    /api/templates                      list the templates
+//	GET    /api/templates/<name>               get a template with its versions
+//	PUT    /api/templates/<name>               set a template, body {"body": "..."}
+//	DELETE /api/templates/<name>               delete a template
+//	POST   /api/templates/<name>/rollback      restore a version, body {"version": 3}
+func (p *Plugin) handleTemplateLibrary(w http.ResponseWriter, r *http.Request) {
+	if !p.isSystemAdmin(w, r) {
+		return
+	}
+
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/templates"), "/")
+	if path == "" {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		lib, err := p.getTemplateLibrary()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		templates := make([]libraryTemplateResponse, 0, len(lib.Templates))
+		for _, name := range lib.names() {
+			current, _ := lib.current(name)
+			templates = append(templates, libraryTemplateResponse{Name: name, Current: current})
+		}
+		p.writeTemplateLibraryResponse(w, map[string]any{"templates": templates})
+		return
+	}
+
+	name, action, _ := strings.Cut(path, "/")
+	author := r.Header.Get("Mattermost-User-Id")
+	if user, appErr := p.API.GetUser(author); appErr == nil {
+		author = user.Username
+	}
+
+	var version templateVersion
+	var err error
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		lib, err := p.getTemplateLibrary()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		current, ok := lib.current(name)
+		if !ok && len(lib.Templates[name]) == 0 {
+			http.NotFound(w, r)
+			return
+		}
+		p.writeTemplateLibraryResponse(w, libraryTemplateResponse{Name: name, Current: current, Versions: lib.Templates[name]})
+		return
+	case action == "" && r.Method == http.MethodPut:
+		var request struct {
+			Body string `json:"body"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, previewMaxBodyBytes)).Decode(&request); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
+			return
+		}
+		version, err = p.setTemplate(name, request.Body, author)
+	case action == "" && r.Method == http.MethodDelete:
+		version, err = p.deleteTemplate(name, author)
+	case action == "rollback" && r.Method == http.MethodPost:
+		var request struct {
+			Version int `json:"version"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, previewMaxBodyBytes)).Decode(&request); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
+			return
+		}
+		version, err = p.rollbackTemplate(name, request.Version, author)
+	case action == "" || action == "rollback":
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	p.writeTemplateLibraryResponse(w, libraryTemplateResponse{Name: name, Current: version})
+}
+
+func (p *Plugin) writeTemplateLibraryResponse(w http.ResponseWriter, response any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		p.API.LogError("[HTTP] Failed to encode template library response", "error", err.Error())
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemplateLibraryVersions(t *testing.T) {
+	var lib templateLibrary
+	assert.Equal(t, 1, lib.add("header", templateVersion{Body: "v1"}).Version)
+	assert.Equal(t, 2, lib.add("header", templateVersion{Body: "v2"}).Version)
+	lib.add("footer", templateVersion{Body: "f"})
+
+	current, ok := lib.current("header")
+	require.True(t, ok)
+	assert.Equal(t, "v2", current.Body)
+	assert.Equal(t, []string{"footer", "header"}, lib.names())
+
+	lib.add("footer", templateVersion{Deleted: true})
+	_, ok = lib.current("footer")
+	assert.False(t, ok)
+	assert.Equal(t, map[string]string{"header": "v2"}, lib.bodies())
+
+	// The oldest versions are dropped, the numbering goes on
+	for i := 0; i < templateLibraryMaxVersions; i++ {
+		lib.add("header", templateVersion{Body: fmt.Sprintf("v%d", i+3)})
+	}
+	assert.Len(t, lib.Templates["header"], templateLibraryMaxVersions)
+	_, ok = lib.version("header", 2)
+	assert.False(t, ok)
+	version, ok := lib.version("header", 3)
+	require.True(t, ok)
+	assert.Equal(t, "v3", version.Body)
+}
+
+func TestLibraryTemplateAction(t *testing.T) {
+	data := sampleTemplateData()
+	data.library = parseLibrary(map[string]string{
+		"title":  `{{ severityEmoji .Labels.severity }} {{ .Labels.alertname }}`,
+		"firing": `{{ template "title" . }} is firing`,
+	})
+
+	out, err := renderAlertTemplate(`{{ template "firing" . }}!`, data)
+	require.NoError(t, err)
+	assert.Equal(t, "🔴 SampleAlert is firing!", out)
+
+	// The definitions of a config template take precedence
+	out, err = renderAlertTemplate(`{{ define "title" }}custom{{ end }}{{ template "firing" . }}`, data)
+	require.NoError(t, err)
+	assert.Equal(t, "custom is firing", out)
+
+	// The override stays in the template, the parsed library is shared by every render
+	out, err = renderAlertTemplate(`{{ template "firing" . }}`, data)
+	require.NoError(t, err)
+	assert.Equal(t, "🔴 SampleAlert is firing", out)
+
+	data.library = parseLibrary(map[string]string{"broken": "{{ .Labels.alertname"})
+	_, err = renderAlertTemplate(`{{ .Labels.alertname }}`, data)
+	assert.ErrorContains(t, err, `library template "broken"`)
+
+	_, err = renderAlertTemplate(`{{ template "missing" . }}`, data)
+	assert.Error(t, err)
+}
+
+func TestValidateTemplateLibrary(t *testing.T) {
+	oldLibrary := map[string]string{"title": "{{ .Labels.alertname }}"}
+	configs := map[string]alertConfig{
+		"0": {ID: "0", FiringTemplate: `{{ template "title" . }}`},
+		"1": {ID: "1", FiringTemplate: `{{ template "gone" . }}`},
+	}
+
+	assert.NoError(t, validateTemplateLibrary(oldLibrary, map[string]string{"title": "{{ .Labels.instance }}"}, configs))
+
+	err := validateTemplateLibrary(oldLibrary, map[string]string{}, configs)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "config #0: FiringTemplate")
+	assert.NotContains(t, err.Error(), "config #1", "configs broken before the change are not blamed on it")
+
+	err = validateTemplateLibrary(oldLibrary, map[string]string{"title": `{{ template "nope" . }}`}, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `template "title"`)
+
+	assert.NoError(t, validateTemplateName("team.header-v2"))
+	assert.Error(t, validateTemplateName("alert"))
+	assert.Error(t, validateTemplateName("bad name"))
+}
+
+func TestTemplateCommandBody(t *testing.T) {
+	assert.Equal(t, "{{ .Labels.alertname }}\n{{ .Status }}",
+		templateCommandBody("/alertmanager template set title {{ .Labels.alertname }}\n{{ .Status }}"))
+	assert.Equal(t, "line 1\n  line 2",
+		templateCommandBody("/alertmanager template set title ```go\nline 1\n  line 2\n```"))
+	assert.Empty(t, templateCommandBody("/alertmanager template set title"))
+}
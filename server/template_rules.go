@@ -0,0 +1,302 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/prometheus/alertmanager/pkg/labels"
+	"github.com/prometheus/alertmanager/template"
+)
+
+// templateRule selects the templates of the alerts matching all its label matchers and
+// its receiver. Empty templates of a rule fall back to the templates of the config.
+type templateRule struct {
+	Name             string
+	Matchers         string // Label matchers, e.g. `severity="critical", namespace=~"kube-.*"`
+	Receiver         string // AlertManager receiver name, empty matches any receiver
+	FiringTemplate   string
+	ResolvedTemplate string
+	AckedTemplate    string // Replaces the post message while the alert is acknowledged
+}
+
+// TemplateRules is the ordered list of template rules of a config, the first match wins
+type TemplateRules []templateRule
+
+// UnmarshalJSON implements custom unmarshaling to handle both string and list
+func (t *TemplateRules) UnmarshalJSON(data []byte) error {
+	// Try to unmarshal as a list first
+	var rules []templateRule
+	if err := json.Unmarshal(data, &rules); err == nil {
+		*t = TemplateRules(rules)
+		return nil
+	}
+
+	// If that fails, try to unmarshal as a string (JSON string)
+	var str string
+	if err := json.Unmarshal(data, &str); err != nil {
+		return err
+	}
+	if str == "" {
+		*t = nil
+		return nil
+	}
+
+	if err := json.Unmarshal([]byte(str), &rules); err != nil {
+		return err
+	}
+	*t = TemplateRules(rules)
+	return nil
+}
+
+// name identifies the rule in logs and errors
+func (r templateRule) name(index int) string {
+	if r.Name != "" {
+		return fmt.Sprintf("%q", r.Name)
+	}
+	return fmt.Sprintf("#%d", index+1)
+}
+
+// validate checks that the rule selects alerts and that its matchers parse
+func (r templateRule) validate() error {
+	if r.Matchers == "" && r.Receiver == "" {
+		return fmt.Errorf("needs Matchers or a Receiver")
+	}
+	if r.Matchers != "" {
+		if _, err := labels.ParseMatchers(r.Matchers); err != nil {
+			return fmt.Errorf("invalid Matchers: %w", err)
+		}
+	}
+	return nil
+}
+
+// matches reports whether the rule with the parsed matchers selects the alert
+func (r templateRule) matches(matchers labels.Matchers, data alertTemplateData) bool {
+	if r.Receiver != "" && r.Receiver != data.Receiver {
+		return false
+	}
+	for _, matcher := range matchers {
+		if !matcher.Matches(data.Labels[matcher.Name]) {
+			return false
+		}
+	}
+	return true
+}
+
+// configMatchers are the label matchers of an alert config, parsed once when the configuration is
+// applied instead of for every alert
+type configMatchers struct {
+	// rules are the matchers of each template rule, nil when they are invalid
+	rules []labels.Matchers
+	// ruleSources are the Matchers of the rules the matchers were parsed from
+	ruleSources []string
+	// heartbeat selects the heartbeat alert, nil when the heartbeat is not monitored or invalid
+	heartbeat       labels.Matchers
+	heartbeatSource [3]string
+}
+
+// parseConfigMatchers parses the matchers of the template rules and of the heartbeat of the config
+func parseConfigMatchers(ac alertConfig) *configMatchers {
+	m := &configMatchers{
+		rules:           make([]labels.Matchers, len(ac.TemplateRules)),
+		ruleSources:     make([]string, len(ac.TemplateRules)),
+		heartbeatSource: [3]string{ac.HeartbeatMatchers, ac.HeartbeatInterval, ac.HeartbeatGrace},
+	}
+	for i, rule := range ac.TemplateRules {
+		m.ruleSources[i] = rule.Matchers
+		if rule.Matchers == "" {
+			m.rules[i] = labels.Matchers{}
+			continue
+		}
+		if matchers, err := labels.ParseMatchers(rule.Matchers); err == nil {
+			m.rules[i] = matchers
+		}
+	}
+	if matchers, _, _, err := ac.heartbeatSettings(); err == nil {
+		m.heartbeat = matchers
+	}
+	return m
+}
+
+// parsedFrom reports whether the matchers were parsed from the settings of the config
+func (m *configMatchers) parsedFrom(ac alertConfig) bool {
+	if len(m.ruleSources) != len(ac.TemplateRules) || m.heartbeatSource != [3]string{ac.HeartbeatMatchers, ac.HeartbeatInterval, ac.HeartbeatGrace} {
+		return false
+	}
+	for i, rule := range ac.TemplateRules {
+		if m.ruleSources[i] != rule.Matchers {
+			return false
+		}
+	}
+	return true
+}
+
+// getConfigMatchers returns the matchers of the config from the runtime snapshot. A config of
+// another snapshot, e.g. changed meanwhile, gets its matchers parsed.
+func (p *Plugin) getConfigMatchers(ac alertConfig) *configMatchers {
+	if m, ok := p.getState().matchers[ac.ID]; ok && m.parsedFrom(ac) {
+		return m
+	}
+	return parseConfigMatchers(ac)
+}
+
+// alertTemplates are the templates selected for an alert
+type alertTemplates struct {
+	// Rule names the matching rule, empty when the templates of the config apply
+	Rule     string
+	Firing   string
+	Resolved string
+	Acked    string
+}
+
+// selectTemplates returns the templates of the first rule matching the alert, falling
+// back to the templates of the config. Rules with invalid matchers never match.
+func (ac alertConfig) selectTemplates(matchers *configMatchers, data alertTemplateData) alertTemplates {
+	templates := alertTemplates{
+		Firing:   ac.FiringTemplate,
+		Resolved: ac.ResolvedTemplate,
+	}
+
+	for i, rule := range ac.TemplateRules {
+		if i >= len(matchers.rules) || matchers.rules[i] == nil || !rule.matches(matchers.rules[i], data) {
+			continue
+		}
+		templates.Rule = rule.name(i)
+		if rule.FiringTemplate != "" {
+			templates.Firing = rule.FiringTemplate
+		}
+		if rule.ResolvedTemplate != "" {
+			templates.Resolved = rule.ResolvedTemplate
+		}
+		templates.Acked = rule.AckedTemplate
+		break
+	}
+	return templates
+}
+
+// ackTemplate returns the template of the post message once acknowledged, or once unacknowledged
+// again. A rule with only an acked template leaves the firing template to the config, and to the
+// default template when the config has none either, so that the message never goes empty.
+func (t alertTemplates) ackTemplate(acked bool) string {
+	switch {
+	case acked:
+		return t.Acked
+	case t.Firing != "":
+		return t.Firing
+	default:
+		return DefaultFiringTemplate
+	}
+}
+
+const alertSnapshotKeyPrefix = "alert_snapshot_"
+
+// alertSnapshot is the alert of a post, kept to render the acked template of the alert
+type alertSnapshot struct {
+	Alert        template.Alert    `json:"alert"`
+	Notification alertNotification `json:"notification"`
+}
+
+func getAlertSnapshotKey(fingerprint string) string {
+	return alertSnapshotKeyPrefix + fingerprint
+}
+
+// hasAckedTemplates reports whether some template rule of the config has an acked template
+func (ac alertConfig) hasAckedTemplates() bool {
+	for _, rule := range ac.TemplateRules {
+		if rule.AckedTemplate != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// needsAlertSnapshot reports whether templates rendered on actions need the whole alert
+func (ac alertConfig) needsAlertSnapshot() bool {
+	return ac.hasAckedTemplates() || ac.hasThreadTemplates()
+}
+
+func (p *Plugin) saveAlertSnapshot(alertConfig alertConfig, alert template.Alert, notification alertNotification) {
+	// The other alerts of the notification are dropped, they would be stored once per alert
+	notification.Alerts = template.Alerts{alert}
+	data, err := json.Marshal(alertSnapshot{Alert: alert, Notification: notification})
+	if err != nil {
+		return
+	}
+	appErr := p.API.KVSetWithExpiry(getAlertSnapshotKey(alert.Fingerprint), data, int64(historyRetention(alertConfig).Seconds()))
+	if appErr != nil {
+		p.API.LogWarn("[WEBHOOK] Failed to save alert snapshot",
+			"fingerprint", alert.Fingerprint,
+			"error", appErr.Error(),
+		)
+	}
+}
+
+func (p *Plugin) getAlertSnapshot(fingerprint string) (*alertSnapshot, error) {
+	data, appErr := p.API.KVGet(getAlertSnapshotKey(fingerprint))
+	if appErr != nil {
+		return nil, appErr
+	}
+	if data == nil {
+		return nil, nil
+	}
+
+	var snapshot alertSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+func (p *Plugin) deleteAlertSnapshot(fingerprint string) {
+	if appErr := p.API.KVDelete(getAlertSnapshotKey(fingerprint)); appErr != nil {
+		p.API.LogWarn("[WEBHOOK] Failed to delete alert snapshot",
+			"fingerprint", fingerprint,
+			"error", appErr.Error(),
+		)
+	}
+}
+
+// renderAckMessage renders the post message of an alert that was acknowledged or
+// unacknowledged. The message changes only when a template rule with an acked template
+// matches the alert: acknowledging renders the acked template, unacknowledging renders the
+// firing template again, see ackTemplate.
+func (p *Plugin) renderAckMessage(alertConfig alertConfig, fingerprint, postID string, acked bool) (string, bool) {
+	if !alertConfig.hasAckedTemplates() {
+		return "", false
+	}
+
+	snapshot, err := p.getAlertSnapshot(fingerprint)
+	if err != nil {
+		p.API.LogWarn("[ACTION] Failed to get alert snapshot", "fingerprint", fingerprint, "error", err.Error())
+		return "", false
+	}
+	if snapshot == nil {
+		return "", false
+	}
+
+	data := p.alertTemplateData(alertConfig, snapshot.Alert, snapshot.Notification, postID)
+	templates := alertConfig.selectTemplates(p.getConfigMatchers(alertConfig), data)
+	if templates.Acked == "" {
+		return "", false
+	}
+
+	message, err := renderAlertTemplate(templates.ackTemplate(acked), data)
+	if err != nil {
+		p.metrics.observeFailure(failureTemplate)
+		p.API.LogError("[ACTION] Failed to render custom template",
+			"error", err.Error(),
+			"fingerprint", fingerprint,
+			"rule", templates.Rule,
+		)
+		return "", false
+	}
+
+	mentions := severityMentions(alertConfig, data.Labels["severity"])
+	switch {
+	case mentions == "":
+		return message, true
+	case message == "":
+		return mentions, true
+	default:
+		return mentions + "\n\n" + message, true
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/prometheus/alertmanager/template"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelectTemplates(t *testing.T) {
+	alertCfg := alertConfig{
+		FiringTemplate:   "default firing",
+		ResolvedTemplate: "default resolved",
+		TemplateRules: TemplateRules{
+			{Name: "kubernetes", Matchers: `namespace=~"kube-.*"`, FiringTemplate: "kube firing", AckedTemplate: "kube acked"},
+			{Matchers: `severity="critical", team="db"`, FiringTemplate: "db firing", ResolvedTemplate: "db resolved"},
+			{Receiver: "pager", FiringTemplate: "pager firing"},
+		},
+	}
+	data := func(receiver string, labels template.KV) alertTemplateData {
+		return newAlertTemplateData(template.Alert{Labels: labels}, alertNotification{Receiver: receiver})
+	}
+
+	templates := alertCfg.selectTemplates(parseConfigMatchers(alertCfg), data("mattermost", template.KV{"namespace": "kube-system", "team": "db", "severity": "critical"}))
+	assert.Equal(t, alertTemplates{Rule: `"kubernetes"`, Firing: "kube firing", Resolved: "default resolved", Acked: "kube acked"}, templates)
+
+	templates = alertCfg.selectTemplates(parseConfigMatchers(alertCfg), data("pager", template.KV{"team": "db", "severity": "critical"}))
+	assert.Equal(t, alertTemplates{Rule: "#2", Firing: "db firing", Resolved: "db resolved"}, templates)
+
+	templates = alertCfg.selectTemplates(parseConfigMatchers(alertCfg), data("pager", template.KV{"team": "db", "severity": "warning"}))
+	assert.Equal(t, alertTemplates{Rule: "#3", Firing: "pager firing", Resolved: "default resolved"}, templates)
+
+	templates = alertCfg.selectTemplates(parseConfigMatchers(alertCfg), data("mattermost", template.KV{"team": "web"}))
+	assert.Equal(t, alertTemplates{Firing: "default firing", Resolved: "default resolved"}, templates)
+
+	// Rules with invalid matchers never match
+	invalid := alertConfig{FiringTemplate: "default firing", TemplateRules: TemplateRules{{Matchers: `team=~"("`, FiringTemplate: "broken"}}}
+	templates = invalid.selectTemplates(parseConfigMatchers(invalid), data("mattermost", template.KV{"team": "web"}))
+	assert.Equal(t, "default firing", templates.Firing)
+}
+
+func TestConfigMatchersParsedFrom(t *testing.T) {
+	alertCfg := alertConfig{
+		TemplateRules:     TemplateRules{{Matchers: `team="db"`, FiringTemplate: "db firing"}},
+		HeartbeatMatchers: `alertname="Watchdog"`,
+		HeartbeatInterval: "5m",
+	}
+	matchers := parseConfigMatchers(alertCfg)
+	assert.True(t, matchers.parsedFrom(alertCfg))
+
+	// Templates do not affect the matchers, changed matchers or heartbeat settings do
+	changed := alertCfg
+	changed.TemplateRules = TemplateRules{{Matchers: `team="db"`, FiringTemplate: "other"}}
+	assert.True(t, matchers.parsedFrom(changed))
+	changed.TemplateRules = TemplateRules{{Matchers: `team="web"`}}
+	assert.False(t, matchers.parsedFrom(changed))
+	changed = alertCfg
+	changed.HeartbeatInterval = "10m"
+	assert.False(t, matchers.parsedFrom(changed))
+}
+
+func TestAckTemplate(t *testing.T) {
+	templates := alertTemplates{Firing: "firing", Acked: "acked"}
+	assert.Equal(t, "acked", templates.ackTemplate(true))
+	assert.Equal(t, "firing", templates.ackTemplate(false))
+
+	// A rule with only an acked template, in a config without a firing template
+	ackedOnly := alertConfig{TemplateRules: TemplateRules{{AckedTemplate: "acked"}}}
+	templates = ackedOnly.selectTemplates(parseConfigMatchers(ackedOnly), alertTemplateData{})
+	assert.Equal(t, "acked", templates.ackTemplate(true))
+	assert.Equal(t, DefaultFiringTemplate, templates.ackTemplate(false))
+}
+
+func TestTemplateRulesUnmarshalJSON(t *testing.T) {
+	var fromList alertConfig
+	require.NoError(t, json.Unmarshal([]byte(`{"templaterules": [{"matchers": "severity=critical", "firingtemplate": "x"}]}`), &fromList))
+
+	var fromString alertConfig
+	require.NoError(t, json.Unmarshal([]byte(`{"templaterules": "[{\"matchers\": \"severity=critical\", \"firingtemplate\": \"x\"}]"}`), &fromString))
+
+	expected := TemplateRules{{Matchers: "severity=critical", FiringTemplate: "x"}}
+	assert.Equal(t, expected, fromList.TemplateRules)
+	assert.Equal(t, expected, fromString.TemplateRules)
+}
+
+func TestTemplateRuleValidate(t *testing.T) {
+	assert.NoError(t, templateRule{Matchers: `severity="critical"`}.validate())
+	assert.NoError(t, templateRule{Receiver: "pager"}.validate())
+	assert.Error(t, templateRule{FiringTemplate: "x"}.validate())
+	assert.Error(t, templateRule{Matchers: `severity=~"(`}.validate())
+}
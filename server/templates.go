@@ -3,33 +3,284 @@ package main
 import (
 	"bytes"
 	"fmt"
+	"maps"
+	"math"
 	"strings"
 	"text/template"
 	"time"
+	"unicode"
 
 	alerttemplate "github.com/prometheus/alertmanager/template"
+	commontemplates "github.com/prometheus/common/helpers/templates"
 )
 
+// alertTemplateData is the data custom templates are executed against. The
+// alert is embedded so that templates keep addressing .Labels, .StartsAt, etc.
+// directly, the notification-level fields are available next to it.
+type alertTemplateData struct {
+	alerttemplate.Alert
+
+	// Alerts are all the alerts of the notification, as in Alertmanager templates
+	Alerts            alerttemplate.Alerts
+	GroupStatus       string
+	GroupLabels       alerttemplate.KV
+	CommonLabels      alerttemplate.KV
+	CommonAnnotations alerttemplate.KV
+	Receiver          string
+	ExternalURL       string
+	GroupKey          string
+	TruncatedAlerts   uint64
+	// Grafana holds the values and links of Grafana alerts, empty for Alertmanager alerts
+	Grafana grafanaAlert
+
+	ConfigID string
+	// PostID is the post of the alert, empty until the post is created
+	PostID     string
+	Acked      bool
+	AckedBy    string
+	Silenced   bool
+	SilencedBy string
+
+	// siteURL and team build the permalinks of the permalink function
+	siteURL string
+	team    string
+	// location is the timezone formatTime formats in, UTC when nil
+	location *time.Location
+	// localizer is the language of the durations formatted by duration
+	localizer localizer
+	// library holds the parsed templates of the template library, for the template action
+	library *parsedLibrary
+}
+
+func newAlertTemplateData(alert alerttemplate.Alert, notification alertNotification) alertTemplateData {
+	return alertTemplateData{
+		Alert:             alert,
+		Alerts:            notification.Alerts,
+		GroupStatus:       notification.Status,
+		GroupLabels:       notification.GroupLabels,
+		CommonLabels:      notification.CommonLabels,
+		CommonAnnotations: notification.CommonAnnotations,
+		Receiver:          notification.Receiver,
+		ExternalURL:       notification.ExternalURL,
+		GroupKey:          notification.GroupKey,
+		TruncatedAlerts:   notification.TruncatedAlerts,
+		Grafana:           notification.Grafana[alert.Fingerprint],
+	}
+}
+
+// applyHistory sets the acknowledgement and silence state of the current episode of the alert
+func (data *alertTemplateData) applyHistory(history *alertHistory) {
+	if history == nil {
+		return
+	}
+	for _, event := range history.Events {
+		switch event.Type {
+		case eventFired:
+			data.Acked, data.AckedBy = false, ""
+			data.Silenced, data.SilencedBy = false, ""
+		case eventAcked:
+			data.Acked, data.AckedBy = true, event.Actor
+		case eventUnacked:
+			data.Acked, data.AckedBy = false, ""
+		case eventSilenced:
+			data.Silenced, data.SilencedBy = true, event.Actor
+		case eventSilenceExpired:
+			data.Silenced, data.SilencedBy = false, ""
+		}
+	}
+}
+
+// alertTemplateData builds the template data of an alert with its config, post and state
+func (p *Plugin) alertTemplateData(alertConfig alertConfig, alert alerttemplate.Alert, notification alertNotification, postID string) alertTemplateData {
+	data := newAlertTemplateData(alert, notification)
+	data.ConfigID = alertConfig.ID
+	data.PostID = postID
+	data.team = alertConfig.Team
+	data.location = mustDisplayLocation(alertConfig)
+	data.localizer = configLocalizer(alertConfig)
+	data.library = p.getState().library
+	if config := p.API.GetConfig(); config != nil && config.ServiceSettings.SiteURL != nil {
+		data.siteURL = strings.TrimRight(*config.ServiceSettings.SiteURL, "/")
+	}
+
+	history, err := p.getAlertHistory(alert.Fingerprint)
+	if err != nil {
+		p.API.LogWarn("[WEBHOOK] Failed to get alert history for the template",
+			"fingerprint", alert.Fingerprint,
+			"error", err.Error(),
+		)
+	}
+	data.applyHistory(history)
+	return data
+}
+
+// severityEmoji returns the emoji of the default severities
+func severityEmoji(severity string) string {
+	switch strings.ToLower(severity) {
+	case "critical":
+		return "🔴"
+	case "error":
+		return "🟠"
+	case "warning":
+		return "🟡"
+	case "info":
+		return "🔵"
+	case "debug":
+		return "⚪"
+	default:
+		return "🔔"
+	}
+}
+
+// mention turns a label value listing users or groups, separated by commas or
+// spaces, into Mattermost mentions
+func mention(value string) string {
+	names := strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
+	mentions := make([]string, 0, len(names))
+	for _, name := range names {
+		mentions = append(mentions, "@"+strings.TrimPrefix(name, "@"))
+	}
+	return strings.Join(mentions, " ")
+}
+
+// humanize formats a number with a metric prefix, like the Prometheus function
+func humanize(i any) (string, error) {
+	v, err := commontemplates.ConvertToFloat(i)
+	if err != nil {
+		return "", err
+	}
+	if v == 0 || math.IsNaN(v) || math.IsInf(v, 0) {
+		return fmt.Sprintf("%.4g", v), nil
+	}
+	if math.Abs(v) >= 1 {
+		prefix := ""
+		for _, p := range []string{"k", "M", "G", "T", "P", "E", "Z", "Y"} {
+			if math.Abs(v) < 1000 {
+				break
+			}
+			prefix = p
+			v /= 1000
+		}
+		return fmt.Sprintf("%.4g%s", v, prefix), nil
+	}
+	prefix := ""
+	for _, p := range []string{"m", "u", "n", "p", "f", "a", "z", "y"} {
+		if math.Abs(v) >= 1 {
+			break
+		}
+		prefix = p
+		v *= 1000
+	}
+	return fmt.Sprintf("%.4g%s", v, prefix), nil
+}
+
+// humanize1024 formats a number with a binary prefix, like the Prometheus function
+func humanize1024(i any) (string, error) {
+	v, err := commontemplates.ConvertToFloat(i)
+	if err != nil {
+		return "", err
+	}
+	if math.Abs(v) <= 1 || math.IsNaN(v) || math.IsInf(v, 0) {
+		return fmt.Sprintf("%.4g", v), nil
+	}
+	prefix := ""
+	for _, p := range []string{"ki", "Mi", "Gi", "Ti", "Pi", "Ei", "Zi", "Yi"} {
+		if math.Abs(v) < 1024 {
+			break
+		}
+		prefix = p
+		v /= 1024
+	}
+	return fmt.Sprintf("%.4g%s", v, prefix), nil
+}
+
+func humanizePercentage(i any) (string, error) {
+	v, err := commontemplates.ConvertToFloat(i)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%.4g%%", v*100), nil
+}
+
+// alertTemplateFuncs returns the functions of Alertmanager templates, the humanize
+// helpers of Prometheus templates and the Mattermost helpers
+func alertTemplateFuncs(data alertTemplateData) template.FuncMap {
+	funcMap := template.FuncMap(maps.Clone(alerttemplate.DefaultFuncs))
+
+	loc := data.location
+	if loc == nil {
+		loc = time.UTC
+	}
+	funcMap["formatTime"] = func(t time.Time) string {
+		return formatAlertTime(t, loc)
+	}
+	funcMap["formatTimeIn"] = func(name string, t time.Time) (string, error) {
+		zone, err := time.LoadLocation(name)
+		if err != nil {
+			return "", err
+		}
+		return formatAlertTime(t, zone), nil
+	}
+	funcMap["humanize"] = humanize
+	funcMap["humanize1024"] = humanize1024
+	funcMap["humanizePercentage"] = humanizePercentage
+	funcMap["humanizeTimestamp"] = commontemplates.HumanizeTimestamp
+	funcMap["duration"] = func(start, end time.Time) string {
+		return data.localizer.Duration(end.Sub(start))
+	}
+	funcMap["mention"] = mention
+	funcMap["severityEmoji"] = severityEmoji
+	funcMap["permalink"] = func(postID string) string {
+		if postID == "" {
+			return ""
+		}
+		return fmt.Sprintf("%s/%s/pl/%s", data.siteURL, data.team, postID)
+	}
+	return funcMap
+}
+
+// newAlertTemplate parses a custom template along with the templates of the library of the data,
+// which it can execute with {{ template "name" . }}. Its own definitions take precedence. The
+// library is parsed once, the template is parsed on a clone of it.
+func newAlertTemplate(tmpl string, data alertTemplateData) (*template.Template, error) {
+	t := template.New("alert")
+	if data.library != nil {
+		if data.library.err != nil {
+			return nil, data.library.err
+		}
+		clone, err := data.library.templates.Clone()
+		if err != nil {
+			return nil, err
+		}
+		t = clone
+	}
+	t.Funcs(alertTemplateFuncs(data))
+	if _, err := t.Parse(tmpl); err != nil {
+		return nil, fmt.Errorf("failed to parse template: %w", err)
+	}
+	return t, nil
+}
+
+// parseAlertTemplate parses a custom template with the functions available to alert templates
+func parseAlertTemplate(tmpl string) (*template.Template, error) {
+	return newAlertTemplate(tmpl, alertTemplateData{})
+}
+
 // renderAlertTemplate renders a custom template for an alert
-func renderAlertTemplate(tmpl string, alert alerttemplate.Alert) (string, error) {
+func renderAlertTemplate(tmpl string, data alertTemplateData) (string, error) {
 	if tmpl == "" {
 		return "", nil
 	}
 
-	funcMap := template.FuncMap{
-		"toUpper": strings.ToUpper,
-		"formatTime": func(t time.Time) string {
-			return t.Format(time.RFC1123)
-		},
-	}
-
-	t, err := template.New("alert").Funcs(funcMap).Parse(tmpl)
+	t, err := newAlertTemplate(tmpl, data)
 	if err != nil {
-		return "", fmt.Errorf("failed to parse template: %w", err)
+		return "", err
 	}
 
 	var buf bytes.Buffer
-	if err := t.Execute(&buf, alert); err != nil {
+	if err := t.Execute(&buf, data); err != nil {
 		return "", fmt.Errorf("failed to execute template: %w", err)
 	}
 
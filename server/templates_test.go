@@ -0,0 +1,79 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/prometheus/alertmanager/template"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderAlertTemplateNotificationFields(t *testing.T) {
+	alert := template.Alert{
+		Status: "firing",
+		Labels: template.KV{"alertname": "HighLatency", "namespace": "shop"},
+	}
+	notification := alertNotification{
+		Receiver:          "mattermost",
+		GroupLabels:       template.KV{"namespace": "shop"},
+		CommonAnnotations: template.KV{"summary": "Checkout is slow"},
+	}
+
+	out, err := renderAlertTemplate(
+		`{{ .Labels.alertname }} in {{ .GroupLabels.namespace }} via {{ .Receiver }}: {{ .CommonAnnotations.summary }}`,
+		newAlertTemplateData(alert, notification),
+	)
+	require.NoError(t, err)
+	assert.Equal(t, "HighLatency in shop via mattermost: Checkout is slow", out)
+}
+
+func TestRenderAlertTemplateFunctions(t *testing.T) {
+	data := sampleTemplateData()
+	data.Labels["owner"] = "alice, @bob"
+	data.siteURL = "https://chat.example.com"
+	data.team = "ops"
+
+	for _, tc := range []struct {
+		tmpl     string
+		expected string
+	}{
+		{`{{ title "high latency" }}`, "High Latency"},
+		{`{{ .Annotations.SortedPairs.Values | join ", " }}`, "Sample description, Sample summary"},
+		{`{{ reReplaceAll ":.*" "" .Labels.instance }}`, "host"},
+		{`{{ if match "^Sample" .Labels.alertname }}yes{{ end }}`, "yes"},
+		{`{{ len .Alerts.Firing }} firing via {{ .Receiver }}, see {{ .ExternalURL }}`, "1 firing via mattermost, see http://alertmanager.example.com"},
+		{`{{ humanize 1234567 }} {{ humanize 0.0025 }} {{ humanize1024 2048 }} {{ humanizePercentage 0.256 }}`, "1.235M 2.5m 2ki 25.6%"},
+		{`{{ humanizeDuration 3723 }}`, "1h 2m 3s"},
+		{`{{ duration .StartsAt .EndsAt }}`, "1 hour"},
+		{`{{ mention .Labels.owner }}`, "@alice @bob"},
+		{`{{ severityEmoji .Labels.severity }}`, "🔴"},
+		{`{{ permalink .PostID }}`, "https://chat.example.com/ops/pl/samplepostid"},
+		{`config {{ .ConfigID }}{{ if not .Acked }}, not acknowledged{{ end }}`, "config 0, not acknowledged"},
+	} {
+		out, err := renderAlertTemplate(tc.tmpl, data)
+		require.NoError(t, err, tc.tmpl)
+		assert.Equal(t, tc.expected, out, tc.tmpl)
+	}
+}
+
+func TestAlertTemplateDataApplyHistory(t *testing.T) {
+	var data alertTemplateData
+	data.applyHistory(&alertHistory{Events: []alertEvent{
+		{Type: eventFired},
+		{Type: eventAcked, Actor: "alice"},
+		{Type: eventSilenced, Actor: "bob"},
+		{Type: eventResolved},
+	}})
+	assert.True(t, data.Acked)
+	assert.Equal(t, "alice", data.AckedBy)
+	assert.True(t, data.Silenced)
+	assert.Equal(t, "bob", data.SilencedBy)
+
+	// A new episode of the alert starts unacknowledged
+	data.applyHistory(&alertHistory{Events: []alertEvent{
+		{Type: eventAcked, Actor: "alice"},
+		{Type: eventFired},
+	}})
+	assert.False(t, data.Acked)
+	assert.Empty(t, data.AckedBy)
+}
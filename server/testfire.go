@@ -0,0 +1,226 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+
+	"github.com/Kuzyashin/mattermost-plugin-alertmanager/server/alertmanager"
+)
+
+const (
+	actionTest = "test"
+
+	// testFireAlertname is the alertname of test alerts, unless the command sets one
+	testFireAlertname = "MattermostPluginTest"
+	// testFireLabel makes every test alert a new alert with its own fingerprint
+	testFireLabel = "mattermost_test_id"
+	// testFireTimeout bounds the wait for a notification of a test alert. Alertmanager holds the
+	// first notification of a group for group_wait and the next ones for group_interval.
+	testFireTimeout      = 5 * time.Minute
+	testFirePollInterval = 5 * time.Second
+)
+
+// testFire is a synthetic alert sent to Alertmanager, watched until the plugin receives it back
+type testFire struct {
+	fingerprint  string
+	labels       map[string]string
+	sentAt       time.Time
+	resolveAfter time.Duration
+}
+
+// parseTestFireArgs parses "[name=value,...] [--resolve-after 2m]"
+func parseTestFireArgs(args []string) (map[string]string, time.Duration, error) {
+	labels := make(map[string]string)
+	var resolveAfter time.Duration
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if value, ok := strings.CutPrefix(arg, "--resolve-after"); ok {
+			value = strings.TrimPrefix(value, "=")
+			if value == "" && i+1 < len(args) {
+				i++
+				value = args[i]
+			}
+			d, err := time.ParseDuration(value)
+			if err != nil || d <= 0 {
+				return nil, 0, fmt.Errorf("invalid --resolve-after %q, use a duration like 2m", value)
+			}
+			resolveAfter = d
+			continue
+		}
+
+		for _, pair := range strings.Split(strings.Trim(arg, "{}"), ",") {
+			if pair == "" {
+				continue
+			}
+			name, value, ok := strings.Cut(pair, "=")
+			name = strings.TrimSpace(name)
+			value = strings.Trim(strings.TrimSpace(value), `"'`)
+			if !ok || name == "" || value == "" || name == testFireLabel {
+				return nil, 0, fmt.Errorf("invalid label %q, use name=value pairs like severity=warning,team=db", pair)
+			}
+			labels[name] = value
+		}
+	}
+	return labels, resolveAfter, nil
+}
+
+// handleTest handles "/alertmanager test fire <config ID> [labels] [--resolve-after 2m]"
+func (p *Plugin) handleTest(args *model.CommandArgs, l localizer) (string, error) {
+	split := strings.Fields(args.Command)
+	if len(split) < 4 || split[2] != "fire" {
+		return l.T("command.test.usage"), nil
+	}
+	if !p.API.HasPermissionTo(args.UserId, model.PermissionManageSystem) {
+		return l.T("command.test.forbidden"), nil
+	}
+
+	alertConfig, ok := p.getConfiguration().AlertConfigs[split[3]]
+	if !ok {
+		return l.T("command.test.unknown_config", split[3]), nil
+	}
+	if alertConfig.Source == sourceGrafana || alertConfig.Source == sourceMapping {
+		return l.T("command.test.unsupported_source", alertConfig.ID, alertConfig.Source), nil
+	}
+
+	labels, resolveAfter, err := parseTestFireArgs(split[4:])
+	if err != nil {
+		return l.T("command.test.invalid", err), nil
+	}
+	if _, ok := labels["alertname"]; !ok {
+		labels["alertname"] = testFireAlertname
+	}
+	labels[testFireLabel] = model.NewId()[:8]
+
+	username := args.UserId
+	if user, appErr := p.API.GetUser(args.UserId); appErr == nil {
+		username = user.Username
+	}
+
+	fire := testFire{
+		fingerprint:  labelSet(labels).Fingerprint().String(),
+		labels:       labels,
+		sentAt:       time.Now(),
+		resolveAfter: resolveAfter,
+	}
+	alert := alertmanager.PostableAlert{
+		Labels: labels,
+		Annotations: map[string]string{
+			"summary": fmt.Sprintf("Test alert sent by @%s with /alertmanager test fire", username),
+		},
+		StartsAt: fire.sentAt,
+	}
+	if resolveAfter > 0 {
+		alert.EndsAt = fire.sentAt.Add(resolveAfter)
+	}
+
+	if err := p.amClient.PostAlerts(alertConfig.alertmanagerAPIURL(), []alertmanager.PostableAlert{alert}); err != nil {
+		return "", fmt.Errorf("failed to send the test alert to %s: %w", alertConfig.AlertManagerURL, err)
+	}
+
+	p.API.LogInfo("[TEST] Test alert sent",
+		"config_id", alertConfig.ID,
+		"fingerprint", fire.fingerprint,
+		"resolve_after", resolveAfter.String(),
+		"user", username,
+	)
+
+	go p.watchTestFire(args, l, fire)
+
+	msg := l.T("command.test.sent", fire.fingerprint, alertConfig.AlertManagerURL, formatLabelPairs(labels), l.Duration(testFireTimeout))
+	if resolveAfter > 0 {
+		msg += " " + l.T("command.test.resolve_after", l.Duration(resolveAfter))
+	}
+	return msg, nil
+}
+
+// watchTestFire reports to the user which config received the notifications of a test alert and
+// where the alert was posted, or that they did not arrive in time. The alert timeline is shared
+// by the nodes of the cluster, so it sees notifications delivered to any of them.
+func (p *Plugin) watchTestFire(args *model.CommandArgs, l localizer, fire testFire) {
+	ticker := time.NewTicker(testFirePollInterval)
+	defer ticker.Stop()
+
+	fired := false
+	deadline := fire.sentAt.Add(testFireTimeout)
+	for {
+		select {
+		case <-p.testFireStop:
+			return
+		case now := <-ticker.C:
+			history, err := p.getAlertHistory(fire.fingerprint)
+			if err != nil {
+				p.API.LogWarn("[TEST] Failed to get the timeline of the test alert",
+					"fingerprint", fire.fingerprint,
+					"error", err.Error(),
+				)
+			}
+
+			if !fired {
+				if event, ok := testFireEvent(history, fire.sentAt, eventFired, eventRepeat); ok {
+					fired = true
+					p.postCommandResponse(args, p.formatTestFireReceived(l, fire, history, event))
+					if fire.resolveAfter == 0 {
+						return
+					}
+					deadline = fire.sentAt.Add(fire.resolveAfter + testFireTimeout)
+				} else if now.After(deadline) {
+					p.postCommandResponse(args, l.T("command.test.timeout", fire.fingerprint, l.Duration(testFireTimeout), formatLabelPairs(fire.labels)))
+					return
+				}
+				continue
+			}
+
+			if event, ok := testFireEvent(history, fire.sentAt, eventResolved); ok {
+				p.postCommandResponse(args, l.T("command.test.resolved", fire.fingerprint, history.ConfigID,
+					l.Duration(time.UnixMilli(event.Timestamp).Sub(fire.sentAt))))
+				return
+			} else if now.After(deadline) {
+				p.postCommandResponse(args, l.T("command.test.resolve_timeout", fire.fingerprint, l.Duration(fire.resolveAfter+testFireTimeout)))
+				return
+			}
+		}
+	}
+}
+
+// testFireEvent returns the first event of one of the types recorded since the test alert was sent
+func testFireEvent(history *alertHistory, since time.Time, types ...string) (alertEvent, bool) {
+	if history == nil {
+		return alertEvent{}, false
+	}
+	for _, event := range history.Events {
+		if event.Timestamp < since.UnixMilli() {
+			continue
+		}
+		for _, t := range types {
+			if event.Type == t {
+				return event, true
+			}
+		}
+	}
+	return alertEvent{}, false
+}
+
+// formatTestFireReceived describes the config and channel a test alert landed in, with its post
+func (p *Plugin) formatTestFireReceived(l localizer, fire testFire, history *alertHistory, event alertEvent) string {
+	channelName := history.ConfigID
+	alertConfig, ok := p.getConfiguration().AlertConfigs[history.ConfigID]
+	if ok {
+		if channel, appErr := p.API.GetChannel(p.getChannelID(alertConfig.ID)); appErr == nil {
+			channelName = channel.Name
+		}
+	}
+
+	msg := l.T("command.test.received", fire.fingerprint, history.ConfigID,
+		l.Duration(time.UnixMilli(event.Timestamp).Sub(fire.sentAt)), channelName)
+	postID := event.PostID
+	if postID == "" {
+		postID = history.PostID
+	}
+	if ok && postID != "" {
+		msg += " " + l.T("command.test.post", p.getPermalink(alertConfig, postID))
+	}
+	return msg
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTestFireArgs(t *testing.T) {
+	labels, resolveAfter, err := parseTestFireArgs([]string{"severity=warning,team='db'", "--resolve-after", "2m"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"severity": "warning", "team": "db"}, labels)
+	assert.Equal(t, 2*time.Minute, resolveAfter)
+
+	labels, resolveAfter, err = parseTestFireArgs([]string{"--resolve-after=30s", "{instance=db1}"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"instance": "db1"}, labels)
+	assert.Equal(t, 30*time.Second, resolveAfter)
+
+	labels, resolveAfter, err = parseTestFireArgs(nil)
+	require.NoError(t, err)
+	assert.Empty(t, labels)
+	assert.Zero(t, resolveAfter)
+
+	for _, args := range [][]string{{"--resolve-after"}, {"--resolve-after", "soon"}, {"severity"}, {testFireLabel + "=x"}} {
+		_, _, err := parseTestFireArgs(args)
+		assert.Error(t, err, args)
+	}
+}
+
+func TestTestFireEvent(t *testing.T) {
+	sentAt := time.UnixMilli(10_000)
+	history := &alertHistory{Events: []alertEvent{
+		{Type: eventFired, Timestamp: 9_000},
+		{Type: eventRepeat, PostID: "post", Timestamp: 12_000},
+		{Type: eventResolved, Timestamp: 15_000},
+	}}
+
+	event, ok := testFireEvent(history, sentAt, eventFired, eventRepeat)
+	require.True(t, ok)
+	assert.Equal(t, "post", event.PostID, "events before the test alert was sent are ignored")
+
+	event, ok = testFireEvent(history, sentAt, eventResolved)
+	require.True(t, ok)
+	assert.Equal(t, int64(15_000), event.Timestamp)
+
+	_, ok = testFireEvent(nil, sentAt, eventFired)
+	assert.False(t, ok)
+	_, ok = testFireEvent(history, time.UnixMilli(20_000), eventFired, eventRepeat, eventResolved)
+	assert.False(t, ok)
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/prometheus/alertmanager/template"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+// Thread events, the thread replies posted under an alert post
+const (
+	threadEventAcked    = "acked"
+	threadEventUnacked  = "unacked"
+	threadEventSilenced = "silenced"
+	threadEventResolved = "resolved"
+)
+
+// threadEvents are the thread events, with the message IDs of their default reply templates
+var threadEvents = map[string]string{
+	threadEventAcked:    "thread.acked",
+	threadEventUnacked:  "thread.unacked",
+	threadEventSilenced: "thread.silenced",
+	threadEventResolved: "thread.resolved",
+}
+
+// defaultThreadTemplate returns the default reply template of a thread event in the language of l
+func defaultThreadTemplate(l localizer, event string) string {
+	return l.T(threadEvents[event])
+}
+
+// threadReply customizes the thread reply of an event, an empty template keeps the default text
+type threadReply struct {
+	Template string
+	Disabled bool
+}
+
+// ThreadReplyMap maps thread events (acked, unacked, silenced, resolved) to their reply
+type ThreadReplyMap map[string]threadReply
+
+// UnmarshalJSON implements custom unmarshaling to handle both string and map
+func (t *ThreadReplyMap) UnmarshalJSON(data []byte) error {
+	// Try to unmarshal as a map first
+	var m map[string]threadReply
+	if err := json.Unmarshal(data, &m); err == nil {
+		*t = ThreadReplyMap(m)
+		return nil
+	}
+
+	// If that fails, try to unmarshal as a string (JSON string)
+	var str string
+	if err := json.Unmarshal(data, &str); err != nil {
+		return err
+	}
+	if str == "" {
+		*t = make(ThreadReplyMap)
+		return nil
+	}
+
+	if err := json.Unmarshal([]byte(str), &m); err != nil {
+		return err
+	}
+	*t = ThreadReplyMap(m)
+	return nil
+}
+
+// threadTemplateData is the data thread reply templates are executed against, the alert
+// fields are available as in the alert templates
+type threadTemplateData struct {
+	alertTemplateData
+
+	Event string
+	// Actor is the username of the user who acted, empty for resolutions
+	Actor string
+	At    time.Time
+	// Duration is how long the alert had been firing at the event
+	Duration        time.Duration
+	SilenceID       string
+	SilenceDuration string
+	SilenceEndsAt   time.Time
+}
+
+// threadTemplate returns the template of a thread event, false when its reply is disabled
+func (ac alertConfig) threadTemplate(event string) (string, bool) {
+	reply := ac.ThreadReplies[event]
+	if reply.Disabled {
+		return "", false
+	}
+	if reply.Template != "" {
+		return reply.Template, true
+	}
+	return defaultThreadTemplate(configLocalizer(ac), event), true
+}
+
+// hasThreadTemplates reports whether the config customizes the text of a thread reply
+func (ac alertConfig) hasThreadTemplates() bool {
+	for _, reply := range ac.ThreadReplies {
+		if reply.Template != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// validateThreadReplies checks the events and trial-renders the templates of the thread replies
+// with the templates of the library
+func (ac alertConfig) validateThreadReplies(library map[string]string) []error {
+	events := make([]string, 0, len(ac.ThreadReplies))
+	for event := range ac.ThreadReplies {
+		events = append(events, event)
+	}
+	sort.Strings(events)
+
+	var errs []error
+	for _, event := range events {
+		if _, ok := threadEvents[event]; !ok {
+			errs = append(errs, fmt.Errorf("unknown event %q, must be one of acked, unacked, silenced or resolved", event))
+			continue
+		}
+		if tmpl := ac.ThreadReplies[event].Template; tmpl != "" {
+			data := sampleThreadTemplateData(event)
+			data.library = parseLibrary(library)
+			if _, err := renderThreadTemplate(tmpl, data); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", event, err))
+			}
+		}
+	}
+	return errs
+}
+
+// sampleThreadTemplateData is the event thread reply templates are trial-rendered against
+func sampleThreadTemplateData(event string) threadTemplateData {
+	return newSampleThreadTemplateData(sampleTemplateData(), event)
+}
+
+// newSampleThreadTemplateData makes a sample event of an alert
+func newSampleThreadTemplateData(alertData alertTemplateData, event string) threadTemplateData {
+	data := threadTemplateData{
+		alertTemplateData: alertData,
+		Event:             event,
+		Actor:             "username",
+		At:                time.Now(),
+	}
+	switch event {
+	case threadEventResolved:
+		data.alertTemplateData = asResolved(data.alertTemplateData)
+		data.Actor = ""
+		data.At = data.EndsAt
+	case threadEventAcked:
+		data.Acked, data.AckedBy = true, data.Actor
+	case threadEventSilenced:
+		data.Silenced, data.SilencedBy = true, data.Actor
+		data.SilenceID = "00000000-0000-0000-0000-000000000000"
+		data.SilenceDuration = "1h"
+		data.SilenceEndsAt = data.At.Add(time.Hour)
+	}
+	data.Duration = data.At.Sub(data.StartsAt)
+	return data
+}
+
+func renderThreadTemplate(tmpl string, data threadTemplateData) (string, error) {
+	t, err := newAlertTemplate(tmpl, data.alertTemplateData)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to execute template: %w", err)
+	}
+	return buf.String(), nil
+}
+
+// renderThreadReply renders the thread reply of an event, false when the reply is disabled.
+// A failing custom template falls back to the default text.
+func (p *Plugin) renderThreadReply(alertConfig alertConfig, data threadTemplateData) (string, bool) {
+	tmpl, enabled := alertConfig.threadTemplate(data.Event)
+	if !enabled {
+		return "", false
+	}
+
+	message, err := renderThreadTemplate(tmpl, data)
+	if err != nil {
+		p.metrics.observeFailure(failureTemplate)
+		p.API.LogError("[ACTION] Failed to render thread reply template",
+			"event", data.Event,
+			"fingerprint", data.Fingerprint,
+			"error", err.Error(),
+		)
+		message, err = renderThreadTemplate(defaultThreadTemplate(configLocalizer(alertConfig), data.Event), data)
+		if err != nil {
+			return "", false
+		}
+	}
+	return message, true
+}
+
+// actionThreadTemplateData builds the thread template data of an action on an alert post. The
+// alert comes from its snapshot when there is one, from its timeline otherwise.
+func (p *Plugin) actionThreadTemplateData(alertConfig alertConfig, fingerprint, postID, event, actor string) threadTemplateData {
+	now := time.Now()
+	data := threadTemplateData{
+		Event: event,
+		Actor: actor,
+		At:    now,
+	}
+
+	snapshot, err := p.getAlertSnapshot(fingerprint)
+	if err != nil {
+		p.API.LogWarn("[ACTION] Failed to get alert snapshot", "fingerprint", fingerprint, "error", err.Error())
+	}
+	if snapshot != nil {
+		data.alertTemplateData = p.alertTemplateData(alertConfig, snapshot.Alert, snapshot.Notification, postID)
+	} else {
+		alert := template.Alert{Status: stateFiring, Fingerprint: fingerprint}
+		history, err := p.getAlertHistory(fingerprint)
+		if err != nil {
+			p.API.LogWarn("[ACTION] Failed to get alert history", "fingerprint", fingerprint, "error", err.Error())
+		}
+		if history != nil {
+			alert.Labels = history.Labels
+			for _, event := range history.Events {
+				if event.Type == eventFired {
+					alert.StartsAt = time.UnixMilli(event.Timestamp)
+				}
+			}
+		}
+		data.alertTemplateData = p.alertTemplateData(alertConfig, alert, alertNotification{Alerts: template.Alerts{alert}}, postID)
+	}
+
+	// The event itself is recorded in the timeline after its reply is posted
+	switch event {
+	case threadEventAcked:
+		data.Acked, data.AckedBy = true, actor
+	case threadEventUnacked:
+		data.Acked, data.AckedBy = false, ""
+	case threadEventSilenced:
+		data.Silenced, data.SilencedBy = true, actor
+	}
+
+	if !data.StartsAt.IsZero() {
+		data.Duration = now.Sub(data.StartsAt)
+	}
+	return data
+}
+
+// postThreadReply posts the thread reply of an action under the alert post. It returns the
+// reply, or the alert post when the reply is disabled or fails, for the alert timeline.
+func (p *Plugin) postThreadReply(alertConfig alertConfig, post *model.Post, data threadTemplateData) string {
+	message, enabled := p.renderThreadReply(alertConfig, data)
+	if !enabled {
+		return post.Id
+	}
+
+	threadPost := &model.Post{
+		ChannelId: post.ChannelId,
+		UserId:    p.BotUserID,
+		RootId:    post.Id,
+		Message:   message,
+	}
+	createdThreadPost, appErr := p.API.CreatePost(threadPost)
+	if appErr != nil {
+		p.API.LogError("[ACTION] Failed to create thread post", "error", appErr.Error())
+		return post.Id
+	}
+	return createdThreadPost.Id
+}
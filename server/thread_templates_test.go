@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefaultThreadTemplates(t *testing.T) {
+	data := sampleThreadTemplateData(threadEventSilenced)
+	data.At = time.Date(2024, 11, 21, 10, 0, 0, 0, time.UTC)
+	data.SilenceEndsAt = data.At.Add(4 * time.Hour)
+	data.SilenceDuration = "4h"
+
+	en := newLocalizer(defaultLanguage)
+	out, err := renderThreadTemplate(defaultThreadTemplate(en, threadEventSilenced), data)
+	require.NoError(t, err)
+	assert.Equal(t, "🔕 **Silenced for 4h**\n\nBy: @username\nUntil: Thu, 21 Nov 2024 14:00:00 UTC\nSilence ID: `00000000-0000-0000-0000-000000000000`", out)
+
+	for _, language := range supportedLanguages() {
+		for event := range threadEvents {
+			_, err := renderThreadTemplate(defaultThreadTemplate(newLocalizer(language), event), sampleThreadTemplateData(event))
+			assert.NoError(t, err, language+" "+event)
+		}
+	}
+}
+
+func TestThreadTemplate(t *testing.T) {
+	var alertCfg alertConfig
+	require.NoError(t, json.Unmarshal([]byte(`{"threadreplies": "{\"acked\": {\"template\": \"ack by {{ .Actor }}\"}, \"unacked\": {\"disabled\": true}}"}`), &alertCfg))
+
+	tmpl, enabled := alertCfg.threadTemplate(threadEventAcked)
+	assert.True(t, enabled)
+	assert.Equal(t, "ack by {{ .Actor }}", tmpl)
+
+	_, enabled = alertCfg.threadTemplate(threadEventUnacked)
+	assert.False(t, enabled)
+
+	tmpl, enabled = alertCfg.threadTemplate(threadEventResolved)
+	assert.True(t, enabled)
+	assert.Equal(t, defaultThreadTemplate(newLocalizer(defaultLanguage), threadEventResolved), tmpl)
+
+	assert.True(t, alertCfg.hasThreadTemplates())
+	assert.Empty(t, alertCfg.validateThreadReplies(nil))
+}
+
+func TestValidateThreadReplies(t *testing.T) {
+	alertCfg := alertConfig{ThreadReplies: ThreadReplyMap{
+		"escalated": {Template: "x"},
+		"silenced":  {Template: "{{ .SilenceID | nope }}"},
+		"resolved":  {Template: "{{ .Actor }} after {{ .Duration }}"},
+	}}
+
+	errs := alertCfg.validateThreadReplies(nil)
+	require.Len(t, errs, 2)
+	assert.Contains(t, errs[0].Error(), `unknown event "escalated"`)
+	assert.Contains(t, errs[1].Error(), `silenced: failed to parse template`)
+}
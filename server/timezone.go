@@ -0,0 +1,40 @@
+package main
+
+import (
+	"time"
+)
+
+// displayLocation returns the timezone times are displayed in for the config, UTC by default
+func displayLocation(alertConfig alertConfig) (*time.Location, error) {
+	if alertConfig.Timezone == "" {
+		return time.UTC, nil
+	}
+	return time.LoadLocation(alertConfig.Timezone)
+}
+
+// mustDisplayLocation returns the display timezone of the config, UTC when it is invalid
+func mustDisplayLocation(alertConfig alertConfig) *time.Location {
+	loc, err := displayLocation(alertConfig)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// formatAlertTime formats a time of an alert post in the location
+func formatAlertTime(t time.Time, loc *time.Location) string {
+	return t.In(loc).Format(time.RFC1123)
+}
+
+// userLocation returns the timezone preference of a user, UTC when it is not set
+func (p *Plugin) userLocation(userID string) *time.Location {
+	user, appErr := p.API.GetUser(userID)
+	if appErr != nil {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(user.GetPreferredTimezone())
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/alertmanager/template"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAlertFieldsAbsoluteTimes(t *testing.T) {
+	startsAt := time.Date(2024, 11, 21, 10, 0, 0, 0, time.UTC)
+	alert := template.Alert{
+		Status:      alertStatusResolved,
+		Labels:      template.KV{"alertname": "HighLatency"},
+		Annotations: template.KV{"summary": "slow"},
+		StartsAt:    startsAt,
+		EndsAt:      startsAt.Add(time.Hour),
+	}
+
+	// The times are in the config timezone and never relative, the posts are not rewritten later
+	fields := ConvertAlertToFields(alertConfig{Timezone: "Asia/Tokyo"}, alert, alertNotification{})
+	require.NotEmpty(t, fields)
+	value, ok := fields[0].Value.(string)
+	require.True(t, ok)
+	assert.Contains(t, value, "**Started at:** Thu, 21 Nov 2024 19:00:00 JST\n")
+	assert.Contains(t, value, "**Ended at:** Thu, 21 Nov 2024 20:00:00 JST\n")
+}
+
+func TestDisplayLocation(t *testing.T) {
+	loc, err := displayLocation(alertConfig{})
+	require.NoError(t, err)
+	assert.Equal(t, time.UTC, loc)
+
+	loc, err = displayLocation(alertConfig{Timezone: "Asia/Tokyo"})
+	require.NoError(t, err)
+	assert.Equal(t, "Asia/Tokyo", loc.String())
+
+	_, err = displayLocation(alertConfig{Timezone: "Mars/Olympus"})
+	assert.Error(t, err)
+	assert.Equal(t, time.UTC, mustDisplayLocation(alertConfig{Timezone: "Mars/Olympus"}))
+
+	// The digests follow the display timezone unless they set their own
+	loc, err = digestLocation(alertConfig{Timezone: "Asia/Tokyo"})
+	require.NoError(t, err)
+	assert.Equal(t, "Asia/Tokyo", loc.String())
+}
+
+func TestFormatTimeInConfigTimezone(t *testing.T) {
+	data := sampleTemplateData()
+	data.StartsAt = time.Date(2024, 11, 21, 10, 0, 0, 0, time.UTC)
+	data.location = mustDisplayLocation(alertConfig{Timezone: "Asia/Tokyo"})
+
+	rendered, err := renderAlertTemplate(`{{ formatTime .StartsAt }} | {{ formatTimeIn "UTC" .StartsAt }}`, data)
+	require.NoError(t, err)
+	assert.Equal(t, "Thu, 21 Nov 2024 19:00:00 JST | Thu, 21 Nov 2024 10:00:00 UTC", rendered)
+
+	_, err = renderAlertTemplate(`{{ formatTimeIn "Mars/Olympus" .StartsAt }}`, data)
+	assert.Error(t, err)
+}
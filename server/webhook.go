@@ -1,8 +1,8 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"sort"
 	"strings"
@@ -11,7 +11,6 @@ import (
 	"golang.org/x/text/cases"
 	"golang.org/x/text/language"
 
-	"github.com/hako/durafmt"
 	"github.com/prometheus/alertmanager/notify/webhook"
 	"github.com/prometheus/alertmanager/template"
 
@@ -19,9 +18,43 @@ import (
 )
 
 const (
+	alertStatusFiring   = "firing"
 	alertStatusResolved = "resolved"
 )
 
+// alertNotification carries the notification-level fields of a webhook message
+// that apply to each of its alerts.
+type alertNotification struct {
+	Alerts            template.Alerts
+	GroupLabels       template.KV
+	CommonLabels      template.KV
+	CommonAnnotations template.KV
+	Receiver          string
+	Status            string
+	ExternalURL       string
+	GroupKey          string
+	TruncatedAlerts   uint64
+	// Grafana holds the Grafana fields of the alerts by fingerprint, nil for Alertmanager payloads
+	Grafana map[string]grafanaAlert `json:",omitempty"`
+}
+
+func newAlertNotification(message webhook.Message) alertNotification {
+	notification := alertNotification{
+		GroupKey:        message.GroupKey,
+		TruncatedAlerts: message.TruncatedAlerts,
+	}
+	if message.Data != nil {
+		notification.Alerts = message.Alerts
+		notification.GroupLabels = message.GroupLabels
+		notification.CommonLabels = message.CommonLabels
+		notification.CommonAnnotations = message.CommonAnnotations
+		notification.Receiver = message.Receiver
+		notification.Status = message.Status
+		notification.ExternalURL = message.ExternalURL
+	}
+	return notification
+}
+
 func (p *Plugin) handleWebhook(w http.ResponseWriter, r *http.Request, alertConfig alertConfig) {
 	p.API.LogInfo("[WEBHOOK] Received alertmanager notification",
 		"config_id", alertConfig.ID,
@@ -30,9 +63,17 @@ func (p *Plugin) handleWebhook(w http.ResponseWriter, r *http.Request, alertConf
 		"remote_addr", r.RemoteAddr,
 	)
 
-	var message webhook.Message
-	err := json.NewDecoder(r.Body).Decode(&message)
+	p.ingest.recordReceived(alertConfig.ID)
+
+	var inbound inboundMessage
+	body, err := io.ReadAll(r.Body)
+	if err == nil {
+		inbound, err = adapterFor(alertConfig).decode(body, time.Now())
+	}
+	message := inbound.Message
 	if err != nil {
+		p.metrics.observeWebhookReceived(alertConfig.ID, "invalid")
+		p.metrics.observeFailure(failureDecode)
 		p.API.LogError("[WEBHOOK] Failed to decode webhook message",
 			"config_id", alertConfig.ID,
 			"error", err.Error(),
@@ -41,36 +82,125 @@ func (p *Plugin) handleWebhook(w http.ResponseWriter, r *http.Request, alertConf
 		return
 	}
 
+	if message == (webhook.Message{}) || message.Data == nil {
+		p.metrics.observeWebhookReceived(alertConfig.ID, "invalid")
+		p.metrics.observeFailure(failureDecode)
+		p.API.LogWarn("[WEBHOOK] Received empty webhook message",
+			"config_id", alertConfig.ID,
+		)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	p.metrics.observeWebhookReceived(alertConfig.ID, message.Status)
+	p.saveLastWebhook(alertConfig.ID)
+	p.saveWebhookSample(alertConfig.ID, message)
 	p.API.LogInfo("[WEBHOOK] Decoded webhook message",
 		"config_id", alertConfig.ID,
 		"status", message.Status,
 		"receiver", message.Receiver,
 		"num_alerts", len(message.Alerts),
+		"truncated_alerts", message.TruncatedAlerts,
 	)
 
-	if message == (webhook.Message{}) {
-		p.API.LogWarn("[WEBHOOK] Received empty webhook message",
+	// Make sure the alerts can be delivered before accepting them
+	if channelID := p.getChannelID(alertConfig.ID); channelID == "" {
+		p.API.LogError("[WEBHOOK] No channel mapping found for config",
 			"config_id", alertConfig.ID,
+			"config_channel", alertConfig.Channel,
+			"available_mappings", fmt.Sprintf("%+v", p.getState().channelIDs),
 		)
-		w.WriteHeader(http.StatusBadRequest)
+		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	// Determine target channel
-	channelID := p.AlertConfigIDChannelID[alertConfig.ID]
-	if channelID == "" {
-		p.API.LogError("[WEBHOOK] No channel mapping found for config",
+	// Alertmanager retries and HA peers deliver the same notification several times
+	messageID := webhookMessageID(message)
+	firstSeen, err := p.markWebhookSeen(alertConfig.ID, messageID)
+	if err != nil {
+		p.API.LogWarn("[WEBHOOK] Failed to record notification ID, processing it anyway",
 			"config_id", alertConfig.ID,
-			"config_channel", alertConfig.Channel,
-			"available_mappings", fmt.Sprintf("%+v", p.AlertConfigIDChannelID),
+			"message_id", messageID,
+			"error", err.Error(),
 		)
+		firstSeen = true
+	}
+
+	if !firstSeen {
+		p.ingest.recordDuplicate(alertConfig.ID)
+		p.metrics.observeWebhookDuplicate(alertConfig.ID)
+		p.API.LogInfo("[WEBHOOK] Ignoring duplicate webhook message",
+			"config_id", alertConfig.ID,
+			"message_id", messageID,
+			"group_key", message.GroupKey,
+		)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	queued, err := p.enqueueWebhook(alertConfig, message, inbound.Grafana)
+	if err != nil {
+		p.API.LogError("[WEBHOOK] Failed to persist webhook message",
+			"config_id", alertConfig.ID,
+			"error", err.Error(),
+		)
+		p.forgetWebhookSeen(alertConfig.ID, messageID)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
+	if !queued {
+		p.forgetWebhookSeen(alertConfig.ID, messageID)
+		p.API.LogWarn("[WEBHOOK] Webhook queue is full, asking Alertmanager to retry later",
+			"config_id", alertConfig.ID,
+			"num_alerts", len(message.Alerts),
+		)
+		w.Header().Set("Retry-After", queueRetryAfterSeconds)
+		w.WriteHeader(http.StatusTooManyRequests)
+		return
+	}
+
+	p.API.LogInfo("[WEBHOOK] Queued webhook message",
+		"config_id", alertConfig.ID,
+		"num_alerts", len(message.Alerts),
+	)
+	w.WriteHeader(http.StatusOK)
+}
+
+// processWebhookMessage handles every alert of a queued message. It returns the
+// alerts that failed with a retryable error, or an error when the message cannot
+// be delivered at all.
+func (p *Plugin) processWebhookMessage(alertConfig alertConfig, message webhook.Message, grafana map[string]grafanaAlert) ([]template.Alert, error) {
+	// Determine target channel
+	channelID := p.getChannelID(alertConfig.ID)
+	if channelID == "" {
+		return nil, fmt.Errorf("no channel mapping found for config %s", alertConfig.ID)
+	}
+
+	notification := newAlertNotification(message)
+	notification.Grafana = grafana
+	if alertConfig.ExternalURL != "" {
+		notification.ExternalURL = alertConfig.ExternalURL
+	}
+	alerts := message.Alerts
+	if message.TruncatedAlerts > 0 {
+		alerts = append(alerts, p.handleTruncatedAlerts(alertConfig, message, channelID)...)
+	}
+
+	var failed []template.Alert
+
+	matchers := p.getConfigMatchers(alertConfig)
+
 	// Process each alert separately
-	for i, alert := range message.Alerts {
+	for i, alert := range alerts {
 		fingerprint := alert.Fingerprint
+		if matchers.isHeartbeat(alert) {
+			// Heartbeats only feed the dead man's switch, they are never posted
+			if alert.Status != alertStatusResolved {
+				p.recordHeartbeat(alertConfig, channelID, time.Now())
+			}
+			continue
+		}
 		p.API.LogDebug("[WEBHOOK] Processing alert",
 			"config_id", alertConfig.ID,
 			"alert_index", i,
@@ -79,33 +209,165 @@ func (p *Plugin) handleWebhook(w http.ResponseWriter, r *http.Request, alertConf
 			"alert_labels", fmt.Sprintf("%+v", alert.Labels),
 		)
 
+		unlock := p.alertLocks.lock(fingerprint)
+		var err error
 		if alert.Status == alertStatusResolved {
 			// Handle resolved alert - update existing post
-			p.handleResolvedAlert(alertConfig, alert, message.ExternalURL, message.Receiver, channelID)
+			err = p.handleResolvedAlert(alertConfig, alert, notification, channelID)
 		} else {
 			// Handle firing alert - create new post
-			p.handleFiringAlert(alertConfig, alert, message.ExternalURL, message.Receiver, channelID)
+			err = p.handleFiringAlert(alertConfig, alert, notification, channelID)
+		}
+		unlock()
+
+		if err != nil {
+			p.API.LogWarn("[WEBHOOK] Failed to process alert",
+				"config_id", alertConfig.ID,
+				"fingerprint", fingerprint,
+				"error", err.Error(),
+			)
+			failed = append(failed, alert)
+			continue
 		}
+		p.metrics.observeAlertProcessed(alert.Status)
 	}
 
-	p.API.LogInfo("[WEBHOOK] Successfully processed all alerts",
+	p.API.LogInfo("[WEBHOOK] Processed webhook message",
 		"config_id", alertConfig.ID,
 		"channel_id", channelID,
-		"num_alerts", len(message.Alerts),
+		"num_alerts", len(alerts),
+		"num_failed", len(failed),
 	)
-	w.WriteHeader(http.StatusOK)
+
+	return failed, nil
+}
+
+// handleTruncatedAlerts warns the channel that Alertmanager truncated the
+// notification (max_alerts) and fetches the missing alerts of the group from the
+// Alertmanager API so they can be processed like the others.
+func (p *Plugin) handleTruncatedAlerts(alertConfig alertConfig, message webhook.Message, channelID string) []template.Alert {
+	p.API.LogWarn("[WEBHOOK] Notification was truncated by Alertmanager, fetching missing alerts",
+		"config_id", alertConfig.ID,
+		"group_key", message.GroupKey,
+		"truncated_alerts", message.TruncatedAlerts,
+	)
+
+	known := make(map[string]bool, len(message.Alerts))
+	for _, alert := range message.Alerts {
+		known[alert.Fingerprint] = true
+	}
+
+	var missing []template.Alert
+	groupAlerts, err := p.amClient.ListGroupAlerts(alertConfig.alertmanagerAPIURL(), message.Receiver, message.GroupLabels)
+	if err == nil {
+		for _, groupAlert := range groupAlerts {
+			fingerprint := groupAlert.Fingerprint().String()
+			if known[fingerprint] {
+				continue
+			}
+			known[fingerprint] = true
+
+			alert := template.Alert{
+				Status:       string(groupAlert.Status()),
+				Labels:       make(template.KV, len(groupAlert.Labels)),
+				Annotations:  make(template.KV, len(groupAlert.Annotations)),
+				StartsAt:     groupAlert.StartsAt,
+				GeneratorURL: groupAlert.GeneratorURL,
+				Fingerprint:  fingerprint,
+			}
+			for k, v := range groupAlert.Labels {
+				alert.Labels[string(k)] = string(v)
+			}
+			for k, v := range groupAlert.Annotations {
+				alert.Annotations[string(k)] = string(v)
+			}
+			if groupAlert.Resolved() {
+				alert.EndsAt = groupAlert.EndsAt
+			}
+			missing = append(missing, alert)
+		}
+	}
+
+	l := configLocalizer(alertConfig)
+	text := l.T("webhook.truncated",
+		message.TruncatedAlerts,
+		message.Receiver,
+		formatLabelPairs(message.GroupLabels),
+	)
+	if err != nil {
+		p.API.LogError("[WEBHOOK] Failed to fetch truncated alerts from Alertmanager",
+			"config_id", alertConfig.ID,
+			"group_key", message.GroupKey,
+			"error", err.Error(),
+		)
+		text += l.T("webhook.truncated_failed", err)
+	} else {
+		text += l.T("webhook.truncated_fetched", len(missing))
+	}
+
+	warning := &model.Post{
+		ChannelId: channelID,
+		UserId:    p.BotUserID,
+	}
+	model.ParseSlackAttachment(warning, []*model.SlackAttachment{{
+		Text:  text,
+		Color: colorWarning,
+	}})
+	if _, appErr := p.API.CreatePost(warning); appErr != nil {
+		p.metrics.observeFailure(failureCreatePost)
+		p.API.LogError("[WEBHOOK] Failed to create truncated notification warning",
+			"channel_id", channelID,
+			"error", appErr.Error(),
+		)
+	}
+
+	return missing
+}
+
+// alertEventType returns the timeline event matching the status of a webhook alert
+func alertEventType(alert template.Alert) string {
+	if alert.Status == alertStatusResolved {
+		return eventResolved
+	}
+	return eventFired
+}
+
+// formatLabelPairs renders labels as sorted name="value" pairs
+func formatLabelPairs(labels template.KV) string {
+	if len(labels) == 0 {
+		return "{}"
+	}
+
+	pairs := labels.SortedPairs()
+	formatted := make([]string, 0, len(pairs))
+	for _, pair := range pairs {
+		formatted = append(formatted, fmt.Sprintf("`%s=%q`", pair.Name, pair.Value))
+	}
+	return strings.Join(formatted, ", ")
+}
+
+// severityMentions returns the mentions configured for the severity of an alert
+func severityMentions(alertConfig alertConfig, severity string) string {
+	if severity == "" || alertConfig.SeverityMentions == nil {
+		return ""
+	}
+	return alertConfig.SeverityMentions[severity]
 }
 
-func (p *Plugin) handleFiringAlert(alertConfig alertConfig, alert template.Alert, externalURL, receiver, channelID string) {
+// handleFiringAlert creates the post of a firing alert. The returned error is
+// retryable, rendering problems fall back to the default formatting instead.
+func (p *Plugin) handleFiringAlert(alertConfig alertConfig, alert template.Alert, notification alertNotification, channelID string) error {
 	fingerprint := alert.Fingerprint
 
 	// Check if we already have a post for this alert
 	existingPostID, err := p.getAlertPost(fingerprint)
 	if err != nil {
+		p.metrics.observeFailure(failureKV)
 		p.API.LogError("[WEBHOOK] Failed to check existing alert post",
 			"fingerprint", fingerprint,
 			"error", err.Error(),
 		)
+		return fmt.Errorf("failed to check existing alert post: %w", err)
 	}
 
 	if existingPostID != "" {
@@ -113,7 +375,32 @@ func (p *Plugin) handleFiringAlert(alertConfig alertConfig, alert template.Alert
 			"fingerprint", fingerprint,
 			"post_id", existingPostID,
 		)
-		return
+		p.recordAlertEventFromAlert(alertConfig, alert, eventRepeat, existingPostID)
+		return nil
+	}
+
+	// Alerts absorbed into a storm summary repeat on its thread, even after the storm ended
+	stormPostID, err := p.getStormAlertPost(fingerprint)
+	if err != nil {
+		p.metrics.observeFailure(failureKV)
+		return fmt.Errorf("failed to check the storm summary of the alert: %w", err)
+	}
+	if stormPostID != "" && alert.Status != alertStatusResolved {
+		p.API.LogDebug("[WEBHOOK] Alert was absorbed into a storm summary, skipping",
+			"fingerprint", fingerprint,
+			"post_id", stormPostID,
+		)
+		p.recordAlertEventFromAlert(alertConfig, alert, eventRepeat, stormPostID)
+		return nil
+	}
+
+	if p.absorbIntoStorm(alertConfig, alert, channelID) {
+		p.API.LogDebug("[WEBHOOK] Alert absorbed into storm summary",
+			"fingerprint", fingerprint,
+			"channel_id", channelID,
+		)
+		p.recordAlertEventFromAlert(alertConfig, alert, alertEventType(alert), "")
+		return nil
 	}
 
 	post := &model.Post{
@@ -123,11 +410,7 @@ func (p *Plugin) handleFiringAlert(alertConfig alertConfig, alert template.Alert
 
 	// Add severity mentions if configured
 	severity := alert.Labels["severity"]
-	if severity != "" && alertConfig.SeverityMentions != nil {
-		if mentions, ok := alertConfig.SeverityMentions[severity]; ok && mentions != "" {
-			post.Message = mentions
-		}
-	}
+	post.Message = severityMentions(alertConfig, severity)
 
 	// Determine alert color based on severity and state
 	alertColor := getAlertColor(alertConfig, severity, stateFiring)
@@ -136,15 +419,18 @@ func (p *Plugin) handleFiringAlert(alertConfig alertConfig, alert template.Alert
 	var attachment *model.SlackAttachment
 
 	// Use custom template if configured
-	if alertConfig.FiringTemplate != "" {
-		customMsg, err := renderAlertTemplate(alertConfig.FiringTemplate, alert)
+	templates := alertConfig.selectTemplates(p.getConfigMatchers(alertConfig), newAlertTemplateData(alert, notification))
+	if templates.Firing != "" {
+		customMsg, err := renderAlertTemplate(templates.Firing, p.alertTemplateData(alertConfig, alert, notification, ""))
 		if err != nil {
+			p.metrics.observeFailure(failureTemplate)
 			p.API.LogError("[WEBHOOK] Failed to render custom template",
 				"error", err.Error(),
 				"fingerprint", fingerprint,
+				"rule", templates.Rule,
 			)
 			// Fall back to default formatting
-			fields := ConvertAlertToFields(alertConfig, alert, externalURL, receiver)
+			fields := ConvertAlertToFields(alertConfig, alert, notification)
 			attachment = &model.SlackAttachment{
 				Fields: fields,
 				Color:  alertColor,
@@ -163,13 +449,17 @@ func (p *Plugin) handleFiringAlert(alertConfig alertConfig, alert template.Alert
 		}
 	} else {
 		// Use default attachment formatting
-		fields := ConvertAlertToFields(alertConfig, alert, externalURL, receiver)
+		fields := ConvertAlertToFields(alertConfig, alert, notification)
 		attachment = &model.SlackAttachment{
 			Fields: fields,
 			Color:  alertColor,
 		}
 	}
 
+	if ga, ok := notification.Grafana[alert.Fingerprint]; ok {
+		attachment.ImageURL = ga.ImageURL
+	}
+
 	// Add action buttons if enabled
 	if alertConfig.EnableActions {
 		config := p.API.GetConfig()
@@ -179,6 +469,7 @@ func (p *Plugin) handleFiringAlert(alertConfig alertConfig, alert template.Alert
 			)
 		} else {
 			siteURL := *config.ServiceSettings.SiteURL
+			l := configLocalizer(alertConfig)
 
 			// Prepare alert labels for silence creation
 			alertLabels := make(map[string]interface{})
@@ -186,90 +477,63 @@ func (p *Plugin) handleFiringAlert(alertConfig alertConfig, alert template.Alert
 				alertLabels[k] = v
 			}
 
-			actions := []*model.PostAction{
-				{
-					Name: "🔕 1h",
-					Type: model.PostActionTypeButton,
-					Integration: &model.PostActionIntegration{
-						URL: fmt.Sprintf("%s/plugins/%s/api/action", siteURL, Manifest.Id),
-						Context: map[string]interface{}{
-							"action":      "silence",
-							"fingerprint": fingerprint,
-							"config_id":   alertConfig.ID,
-							"duration":    "1h",
-							"labels":      alertLabels,
-						},
-					},
-				},
-				{
-					Name: "🔕 4h",
-					Type: model.PostActionTypeButton,
-					Integration: &model.PostActionIntegration{
-						URL: fmt.Sprintf("%s/plugins/%s/api/action", siteURL, Manifest.Id),
-						Context: map[string]interface{}{
-							"action":      "silence",
-							"fingerprint": fingerprint,
-							"config_id":   alertConfig.ID,
-							"duration":    "4h",
-							"labels":      alertLabels,
-						},
-					},
-				},
-				{
-					Name: "🔕 12h",
-					Type: model.PostActionTypeButton,
-					Integration: &model.PostActionIntegration{
-						URL: fmt.Sprintf("%s/plugins/%s/api/action", siteURL, Manifest.Id),
-						Context: map[string]interface{}{
-							"action":      "silence",
-							"fingerprint": fingerprint,
-							"config_id":   alertConfig.ID,
-							"duration":    "12h",
-							"labels":      alertLabels,
-						},
-					},
-				},
-				{
-					Name: "🔕 24h",
-					Type: model.PostActionTypeButton,
-					Integration: &model.PostActionIntegration{
-						URL: fmt.Sprintf("%s/plugins/%s/api/action", siteURL, Manifest.Id),
-						Context: map[string]interface{}{
-							"action":      "silence",
-							"fingerprint": fingerprint,
-							"config_id":   alertConfig.ID,
-							"duration":    "24h",
-							"labels":      alertLabels,
-						},
-					},
-				},
-				{
-					Name: "👁️ ACK",
-					Type: model.PostActionTypeButton,
-					Integration: &model.PostActionIntegration{
-						URL: fmt.Sprintf("%s/plugins/%s/api/action", siteURL, Manifest.Id),
-						Context: map[string]interface{}{
-							"action":      "ack",
-							"fingerprint": fingerprint,
-							"config_id":   alertConfig.ID,
-							"severity":    severity,
+			// Silences of an Alertmanager would not stop the alerts of a mapped source
+			var actions []*model.PostAction
+			if alertConfig.hasAlertmanager() {
+				for _, duration := range []string{"1h", "4h", "12h", "24h"} {
+					actions = append(actions, &model.PostAction{
+						Name: l.T("button.silence", duration),
+						Type: model.PostActionTypeButton,
+						Integration: &model.PostActionIntegration{
+							URL: fmt.Sprintf("%s/plugins/%s/api/action", siteURL, Manifest.Id),
+							Context: map[string]interface{}{
+								"action":      "silence",
+								"fingerprint": fingerprint,
+								"config_id":   alertConfig.ID,
+								"duration":    duration,
+								"labels":      alertLabels,
+							},
 						},
+					})
+				}
+			}
+			actions = append(actions, &model.PostAction{
+				Name: l.T("button.ack"),
+				Type: model.PostActionTypeButton,
+				Integration: &model.PostActionIntegration{
+					URL: fmt.Sprintf("%s/plugins/%s/api/action", siteURL, Manifest.Id),
+					Context: map[string]interface{}{
+						"action":      "ack",
+						"fingerprint": fingerprint,
+						"config_id":   alertConfig.ID,
+						"severity":    severity,
 					},
 				},
-			}
+			})
 			attachment.Actions = actions
 		}
 	}
+	p.addAlertLinks(attachment, alertConfig, alert, notification)
+
+	// The runbook of a firing alert is the first reply of its thread
+	runbookKey, rb, hasRunbook := "", runbook{}, false
+	if alert.Status != alertStatusResolved {
+		runbookKey, rb, hasRunbook = p.matchRunbook(alert)
+	}
+	if hasRunbook {
+		p.addRunbookButton(attachment, alertConfig, runbookKey)
+	}
 
 	model.ParseSlackAttachment(post, []*model.SlackAttachment{attachment})
 	createdPost, appErr := p.API.CreatePost(post)
 	if appErr != nil {
+		p.metrics.observeFailure(failureCreatePost)
 		p.API.LogError("[WEBHOOK] Failed to create post for firing alert",
 			"channel_id", channelID,
 			"fingerprint", fingerprint,
 			"error", appErr.Error(),
 		)
-		return
+		return fmt.Errorf("failed to create post: %w", appErr)
 	}
 
 	if createdPost == nil {
@@ -277,36 +541,85 @@ func (p *Plugin) handleFiringAlert(alertConfig alertConfig, alert template.Alert
 			"channel_id", channelID,
 			"fingerprint", fingerprint,
 		)
-		return
+		return nil
 	}
+	p.metrics.observePost(postCreated)
 
 	// Save the mapping
 	if err := p.saveAlertPost(fingerprint, createdPost.Id); err != nil {
+		p.metrics.observeFailure(failureKV)
 		p.API.LogError("[WEBHOOK] Failed to save alert post mapping",
 			"fingerprint", fingerprint,
 			"post_id", createdPost.Id,
 			"error", err.Error(),
 		)
 	}
+	if alertConfig.needsAlertSnapshot() {
+		p.saveAlertSnapshot(alertConfig, alert, notification)
+	}
+
+	if hasRunbook {
+		p.postRunbookReply(alertConfig, channelID, createdPost.Id, runbookKey, rb)
+	}
 
 	p.API.LogInfo("[WEBHOOK] Created post for firing alert",
 		"fingerprint", fingerprint,
 		"post_id", createdPost.Id,
 		"channel_id", channelID,
+		"runbook", runbookKey,
 	)
+	p.recordAlertEventFromAlert(alertConfig, alert, alertEventType(alert), createdPost.Id)
+	if mentions := severityMentions(alertConfig, severity); mentions != "" && alert.Status != alertStatusResolved {
+		// The severity mentions page the people on call for the alert
+		p.recordAlertEvent(alertConfig, fingerprint, alert.Labels, alertEvent{
+			Type:    eventEscalated,
+			PostID:  createdPost.Id,
+			Details: configLocalizer(alertConfig).T("event.details.escalated", mentions),
+		})
+	}
+
+	return nil
 }
 
-func (p *Plugin) handleResolvedAlert(alertConfig alertConfig, alert template.Alert, externalURL, receiver, channelID string) {
+// handleResolvedAlert updates the post of a resolved alert and replies in its
+// thread. The returned error is retryable.
+func (p *Plugin) handleResolvedAlert(alertConfig alertConfig, alert template.Alert, notification alertNotification, channelID string) error {
 	fingerprint := alert.Fingerprint
 
 	// Find the original post
 	originalPostID, err := p.getAlertPost(fingerprint)
 	if err != nil {
+		p.metrics.observeFailure(failureKV)
 		p.API.LogError("[WEBHOOK] Failed to get original alert post",
 			"fingerprint", fingerprint,
 			"error", err.Error(),
 		)
-		return
+		return fmt.Errorf("failed to get original alert post: %w", err)
+	}
+
+	stormPostID := ""
+	if originalPostID == "" {
+		if stormPostID, err = p.getStormAlertPost(fingerprint); err != nil {
+			p.metrics.observeFailure(failureKV)
+			return fmt.Errorf("failed to check the storm summary of the alert: %w", err)
+		}
+	}
+
+	if originalPostID == "" && p.absorbResolvedIntoStorm(alert, channelID) {
+		p.API.LogDebug("[WEBHOOK] Resolved alert absorbed into storm summary",
+			"fingerprint", fingerprint,
+			"channel_id", channelID,
+		)
+		p.recordAlertEventFromAlert(alertConfig, alert, eventResolved, "")
+		if stormPostID != "" {
+			_ = p.API.KVDelete(getStormAlertKey(fingerprint))
+		}
+		return nil
+	}
+
+	if stormPostID != "" {
+		// The storm is over, the resolution goes to the thread of the summary the alert fired in
+		return p.resolveStormAlert(alertConfig, alert, channelID, stormPostID)
 	}
 
 	if originalPostID == "" {
@@ -314,8 +627,7 @@ func (p *Plugin) handleResolvedAlert(alertConfig alertConfig, alert template.Ale
 			"fingerprint", fingerprint,
 		)
 		// Create a new post for resolved alert if original not found
-		p.handleFiringAlert(alertConfig, alert, externalURL, receiver, channelID)
-		return
+		return p.handleFiringAlert(alertConfig, alert, notification, channelID)
 	}
 
 	// Get the original post
@@ -326,7 +638,7 @@ func (p *Plugin) handleResolvedAlert(alertConfig alertConfig, alert template.Ale
 			"fingerprint", fingerprint,
 			"error", appErr.Error(),
 		)
-		return
+		return fmt.Errorf("failed to retrieve original post: %w", appErr)
 	}
 
 	// Update the original post with resolved status
@@ -340,15 +652,18 @@ func (p *Plugin) handleResolvedAlert(alertConfig alertConfig, alert template.Ale
 	var attachment *model.SlackAttachment
 
 	// Use custom template if configured
-	if alertConfig.ResolvedTemplate != "" {
-		customMsg, err := renderAlertTemplate(alertConfig.ResolvedTemplate, alert)
+	templates := alertConfig.selectTemplates(p.getConfigMatchers(alertConfig), newAlertTemplateData(alert, notification))
+	if templates.Resolved != "" {
+		customMsg, err := renderAlertTemplate(templates.Resolved, p.alertTemplateData(alertConfig, alert, notification, originalPostID))
 		if err != nil {
+			p.metrics.observeFailure(failureTemplate)
 			p.API.LogError("[WEBHOOK] Failed to render custom resolved template",
 				"error", err.Error(),
 				"fingerprint", fingerprint,
+				"rule", templates.Rule,
 			)
 			// Fall back to default formatting
-			fields := ConvertAlertToFieldsResolved(alertConfig, alert, externalURL, receiver)
+			fields := ConvertAlertToFieldsResolved(alertConfig, alert, notification)
 			attachment = &model.SlackAttachment{
 				Fields: fields,
 				Color:  alertColor,
@@ -362,65 +677,87 @@ func (p *Plugin) handleResolvedAlert(alertConfig alertConfig, alert template.Ale
 		}
 	} else {
 		// Use default attachment formatting
-		fields := ConvertAlertToFieldsResolved(alertConfig, alert, externalURL, receiver)
+		fields := ConvertAlertToFieldsResolved(alertConfig, alert, notification)
 		attachment = &model.SlackAttachment{
 			Fields: fields,
 			Color:  alertColor,
 		}
 	}
 
+	if ga, ok := notification.Grafana[alert.Fingerprint]; ok {
+		attachment.ImageURL = ga.ImageURL
+	}
+	p.addAlertLinks(attachment, alertConfig, alert, notification)
+
 	model.ParseSlackAttachment(originalPost, []*model.SlackAttachment{attachment})
 
 	if _, appErr := p.API.UpdatePost(originalPost); appErr != nil {
+		p.metrics.observeFailure(failureUpdatePost)
 		p.API.LogError("[WEBHOOK] Failed to update post for resolved alert",
 			"post_id", originalPostID,
 			"fingerprint", fingerprint,
 			"error", appErr.Error(),
 		)
-		return
+		return fmt.Errorf("failed to update post: %w", appErr)
 	}
+	p.metrics.observePost(postUpdated)
 
 	// Create a thread reply with timing information
-	duration := alert.EndsAt.Sub(alert.StartsAt)
-	threadMessage := fmt.Sprintf(
-		"✅ **Alert Resolved**\n\n"+
-			"**Fired at:** %s\n"+
-			"**Resolved at:** %s\n"+
-			"**Duration:** %s",
-		alert.StartsAt.Format(time.RFC1123),
-		alert.EndsAt.Format(time.RFC1123),
-		durafmt.Parse(duration).LimitFirstN(2).String(),
-	)
+	eventPostID := originalPostID
+	threadData := threadTemplateData{
+		alertTemplateData: p.alertTemplateData(alertConfig, alert, notification, originalPostID),
+		Event:             threadEventResolved,
+		At:                alert.EndsAt,
+		Duration:          alert.EndsAt.Sub(alert.StartsAt),
+	}
+	if threadMessage, enabled := p.renderThreadReply(alertConfig, threadData); enabled {
+		threadPost := &model.Post{
+			ChannelId: channelID,
+			UserId:    p.BotUserID,
+			RootId:    originalPostID,
+			Message:   threadMessage,
+		}
 
-	threadPost := &model.Post{
-		ChannelId: channelID,
-		UserId:    p.BotUserID,
-		RootId:    originalPostID,
-		Message:   threadMessage,
+		createdThreadPost, appErr := p.API.CreatePost(threadPost)
+		if appErr != nil {
+			p.metrics.observeFailure(failureCreatePost)
+			p.API.LogError("[WEBHOOK] Failed to create thread post for resolved alert",
+				"post_id", originalPostID,
+				"fingerprint", fingerprint,
+				"error", appErr.Error(),
+			)
+			return fmt.Errorf("failed to create thread post: %w", appErr)
+		}
+		eventPostID = createdThreadPost.Id
 	}
 
-	if _, appErr := p.API.CreatePost(threadPost); appErr != nil {
-		p.API.LogError("[WEBHOOK] Failed to create thread post for resolved alert",
-			"post_id", originalPostID,
-			"fingerprint", fingerprint,
-			"error", appErr.Error(),
-		)
-		return
-	}
+	p.recordAlertEventFromAlert(alertConfig, alert, eventResolved, eventPostID)
 
-	// Delete the mapping as alert is resolved
+	// Delete the mapping and the acknowledgment as alert is resolved
 	if err := p.deleteAlertPost(fingerprint); err != nil {
+		p.metrics.observeFailure(failureKV)
 		p.API.LogWarn("[WEBHOOK] Failed to delete alert post mapping",
 			"fingerprint", fingerprint,
 			"error", err.Error(),
 		)
 	}
+	if err := p.unackAlert(fingerprint); err != nil {
+		p.API.LogWarn("[WEBHOOK] Failed to delete alert acknowledgment",
+			"fingerprint", fingerprint,
+			"error", err.Error(),
+		)
+	}
+	if alertConfig.needsAlertSnapshot() {
+		p.deleteAlertSnapshot(fingerprint)
+	}
 
 	p.API.LogInfo("[WEBHOOK] Updated post for resolved alert",
 		"fingerprint", fingerprint,
 		"post_id", originalPostID,
-		"duration", duration.String(),
+		"duration", threadData.Duration.String(),
 	)
+
+	return nil
 }
 
 func addFields(fields []*model.SlackAttachmentField, title, msg string, short bool) []*model.SlackAttachmentField {
@@ -444,12 +781,13 @@ func setColor(impact string) string {
 	return colorExpired
 }
 
-func ConvertAlertToFields(config alertConfig, alert template.Alert, externalURL, receiver string) []*model.SlackAttachmentField {
+func ConvertAlertToFields(config alertConfig, alert template.Alert, notification alertNotification) []*model.SlackAttachmentField {
 	var fields []*model.SlackAttachmentField
+	l := configLocalizer(config)
 
 	statusMsg := strings.ToUpper(alert.Status)
 	if alert.Status == "firing" {
-		statusMsg = fmt.Sprintf(":fire: %s :fire:", strings.ToUpper(alert.Status))
+		statusMsg = l.T("alert.firing_title")
 	}
 
 	/* first field: Annotations, Start/End, Source */
@@ -463,18 +801,17 @@ func ConvertAlertToFields(config alertConfig, alert template.Alert, externalURL,
 		msg = fmt.Sprintf("%s**%s:** %s\n", msg, cases.Title(language.Und, cases.NoLower).String(k), alert.Annotations[k])
 	}
 	msg = fmt.Sprintf("%s \n", msg)
-	msg = fmt.Sprintf("%s**Started at:** %s (%s ago)\n", msg,
-		(alert.StartsAt).Format(time.RFC1123),
-		durafmt.Parse(time.Since(alert.StartsAt)).LimitFirstN(2).String(),
-	)
+	// Times are absolute in the timezone of the config, relative ones would need the post rewritten
+	loc := mustDisplayLocation(config)
+	msg = fmt.Sprintf("%s**%s:** %s\n", msg, l.T("alert.started_at"), formatAlertTime(alert.StartsAt, loc))
 	if alert.Status == alertStatusResolved {
-		msg = fmt.Sprintf("%s**Ended at:** %s (%s ago)\n", msg,
-			(alert.EndsAt).Format(time.RFC1123),
-			durafmt.Parse(time.Since(alert.EndsAt)).LimitFirstN(2).String(),
-		)
+		msg = fmt.Sprintf("%s**%s:** %s\n", msg, l.T("alert.ended_at"), formatAlertTime(alert.EndsAt, loc))
 	}
 	msg = fmt.Sprintf("%s \n", msg)
-	msg = fmt.Sprintf("%sGenerated by a [Prometheus Alert](%s) and sent to the [Alertmanager](%s) '%s' receiver.", msg, alert.GeneratorURL, externalURL, receiver)
+	msg += formatGeneratedBy(config, l, alert, notification)
+	if len(notification.GroupLabels) > 0 {
+		msg = fmt.Sprintf("%s\n**%s:** %s", msg, l.T("alert.grouped_by"), formatLabelPairs(notification.GroupLabels))
+	}
 	fields = addFields(fields, statusMsg, msg, true)
 
 	/* second field: Labels only */
@@ -493,10 +830,11 @@ func ConvertAlertToFields(config alertConfig, alert template.Alert, externalURL,
 	return fields
 }
 
-func ConvertAlertToFieldsResolved(config alertConfig, alert template.Alert, externalURL, receiver string) []*model.SlackAttachmentField {
+func ConvertAlertToFieldsResolved(config alertConfig, alert template.Alert, notification alertNotification) []*model.SlackAttachmentField {
 	var fields []*model.SlackAttachmentField
+	l := configLocalizer(config)
 
-	statusMsg := "✅ RESOLVED ✅"
+	statusMsg := l.T("alert.resolved_title")
 
 	/* first field: Annotations, Start/End, Source */
 	var msg string
@@ -509,12 +847,15 @@ func ConvertAlertToFieldsResolved(config alertConfig, alert template.Alert, exte
 		msg = fmt.Sprintf("%s**%s:** %s\n", msg, cases.Title(language.Und, cases.NoLower).String(k), alert.Annotations[k])
 	}
 	msg = fmt.Sprintf("%s \n", msg)
-	msg = fmt.Sprintf("%s**Started at:** %s\n", msg, alert.StartsAt.Format(time.RFC1123))
-	msg = fmt.Sprintf("%s**Ended at:** %s\n", msg, alert.EndsAt.Format(time.RFC1123))
-	duration := alert.EndsAt.Sub(alert.StartsAt)
-	msg = fmt.Sprintf("%s**Duration:** %s\n", msg, durafmt.Parse(duration).LimitFirstN(2).String())
+	loc := mustDisplayLocation(config)
+	msg = fmt.Sprintf("%s**%s:** %s\n", msg, l.T("alert.started_at"), formatAlertTime(alert.StartsAt, loc))
+	msg = fmt.Sprintf("%s**%s:** %s\n", msg, l.T("alert.ended_at"), formatAlertTime(alert.EndsAt, loc))
+	msg = fmt.Sprintf("%s**%s:** %s\n", msg, l.T("alert.duration"), l.Duration(alert.EndsAt.Sub(alert.StartsAt)))
 	msg = fmt.Sprintf("%s \n", msg)
-	msg = fmt.Sprintf("%sGenerated by a [Prometheus Alert](%s) and sent to the [Alertmanager](%s) '%s' receiver.", msg, alert.GeneratorURL, externalURL, receiver)
+	msg += formatGeneratedBy(config, l, alert, notification)
+	if len(notification.GroupLabels) > 0 {
+		msg = fmt.Sprintf("%s\n**%s:** %s", msg, l.T("alert.grouped_by"), formatLabelPairs(notification.GroupLabels))
+	}
 	fields = addFields(fields, statusMsg, msg, true)
 
 	/* second field: Labels only */
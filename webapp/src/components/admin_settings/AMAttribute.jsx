@@ -2,10 +2,14 @@ import React, { useState, useEffect} from 'react';
 import PropTypes from 'prop-types';
 import crypto from 'crypto';
 import ColorMapEditor from './ColorMapEditor';
+import TemplatePreview from './TemplatePreview';
 
 const AMAttribute = (props) => {
     const initialSettings = props.attributes === undefined || Object.keys(props.attributes).length === 0 ? {
         alertmanagerurl: "",
+        source: "",
+        grafanatoken: "",
+        fieldmapping: "",
         channel: "",
         team: "",
         token: "",
@@ -15,8 +19,27 @@ const AMAttribute = (props) => {
         severitycolors: {},
         firingtemplate: "",
         resolvedtemplate: "",
+        templaterules: "",
+        links: "",
+        externalurl: "",
+        uilinks: "",
+        threadreplies: "",
+        stormthreshold: 0,
+        historyretentiondays: 0,
+        digestschedule: "",
+        digesttimezone: "",
+        timezone: "",
+        language: "",
+        heartbeatmatchers: "",
+        heartbeatinterval: "",
+        heartbeatgrace: "",
+        healthcheck: false,
+        healthchannel: "",
     } : {
         alertmanagerurl: props.attributes.alertmanagerurl? props.attributes.alertmanagerurl: "",
+        source: props.attributes.source? props.attributes.source: "",
+        grafanatoken: props.attributes.grafanatoken? props.attributes.grafanatoken: "",
+        fieldmapping: props.attributes.fieldmapping? (typeof props.attributes.fieldmapping === 'string' ? props.attributes.fieldmapping : JSON.stringify(props.attributes.fieldmapping, null, 2)): "",
         channel: props.attributes.channel? props.attributes.channel : "",
         team: props.attributes.team ? props.attributes.team: "",
         token: props.attributes.token? props.attributes.token: "",
@@ -26,6 +49,22 @@ const AMAttribute = (props) => {
         severitycolors: props.attributes.severitycolors || {},
         firingtemplate: props.attributes.firingtemplate? props.attributes.firingtemplate: "",
         resolvedtemplate: props.attributes.resolvedtemplate? props.attributes.resolvedtemplate: "",
+        threadreplies: props.attributes.threadreplies? (typeof props.attributes.threadreplies === 'string' ? props.attributes.threadreplies : JSON.stringify(props.attributes.threadreplies, null, 2)): "",
+        templaterules: props.attributes.templaterules? (typeof props.attributes.templaterules === 'string' ? props.attributes.templaterules : JSON.stringify(props.attributes.templaterules, null, 2)): "",
+        links: props.attributes.links? (typeof props.attributes.links === 'string' ? props.attributes.links : JSON.stringify(props.attributes.links, null, 2)): "",
+        externalurl: props.attributes.externalurl? props.attributes.externalurl: "",
+        uilinks: props.attributes.uilinks? props.attributes.uilinks: "",
+        stormthreshold: props.attributes.stormthreshold? props.attributes.stormthreshold: 0,
+        historyretentiondays: props.attributes.historyretentiondays? props.attributes.historyretentiondays: 0,
+        digestschedule: props.attributes.digestschedule? props.attributes.digestschedule: "",
+        digesttimezone: props.attributes.digesttimezone? props.attributes.digesttimezone: "",
+        timezone: props.attributes.timezone? props.attributes.timezone: "",
+        language: props.attributes.language? props.attributes.language: "",
+        heartbeatmatchers: props.attributes.heartbeatmatchers? props.attributes.heartbeatmatchers: "",
+        heartbeatinterval: props.attributes.heartbeatinterval? props.attributes.heartbeatinterval: "",
+        heartbeatgrace: props.attributes.heartbeatgrace? props.attributes.heartbeatgrace: "",
+        healthcheck: props.attributes.healthcheck? props.attributes.healthcheck: false,
+        healthchannel: props.attributes.healthchannel? props.attributes.healthchannel: "",
     };
 
     const initErrors = {
@@ -82,6 +121,45 @@ const AMAttribute = (props) => {
         props.onChange({id: props.id, attributes: newSettings});
     }
 
+    const handleSourceInput = (e) => {
+        let newSettings = {...settings};
+        newSettings = {...newSettings, source: e.target.value};
+
+        setSettings(newSettings);
+        props.onChange({id: props.id, attributes: newSettings});
+    }
+
+    const handleGrafanaTokenInput = (e) => {
+        let newSettings = {...settings};
+        newSettings = {...newSettings, grafanatoken: e.target.value};
+
+        setSettings(newSettings);
+        props.onChange({id: props.id, attributes: newSettings});
+    }
+
+    const handleFieldMappingInput = (e) => {
+        let newSettings = {...settings};
+        const fieldMappingValue = e.target.value;
+
+        newSettings = {...newSettings, fieldmapping: fieldMappingValue};
+
+        setSettings(newSettings);
+
+        // Convert string to an object when saving, invalid JSON is kept for the server to report
+        let attributesToSave = {...newSettings};
+        if (fieldMappingValue.trim() !== '') {
+            try {
+                attributesToSave.fieldmapping = JSON.parse(fieldMappingValue);
+            } catch (err) {
+                // Keep as string if invalid JSON
+            }
+        } else {
+            attributesToSave.fieldmapping = {};
+        }
+
+        props.onChange({id: props.id, attributes: attributesToSave});
+    }
+
     const handleEnableActionsChange = (e) => {
         let newSettings = {...settings};
         newSettings = {...newSettings, enableactions: e.target.checked};
@@ -138,6 +216,181 @@ const AMAttribute = (props) => {
         props.onChange({id: props.id, attributes: newSettings});
     }
 
+    const handleTemplateRulesInput = (e) => {
+        let newSettings = {...settings};
+        const templateRulesValue = e.target.value;
+
+        newSettings = {...newSettings, templaterules: templateRulesValue};
+
+        setSettings(newSettings);
+
+        // Convert string to a list when saving, invalid JSON is kept for the server to report
+        let attributesToSave = {...newSettings};
+        if (templateRulesValue.trim() !== '') {
+            try {
+                attributesToSave.templaterules = JSON.parse(templateRulesValue);
+            } catch (err) {
+                // Keep as string if invalid JSON
+            }
+        } else {
+            attributesToSave.templaterules = [];
+        }
+
+        props.onChange({id: props.id, attributes: attributesToSave});
+    }
+
+    const handleLinksInput = (e) => {
+        let newSettings = {...settings};
+        const linksValue = e.target.value;
+
+        newSettings = {...newSettings, links: linksValue};
+
+        setSettings(newSettings);
+
+        // Convert string to a list when saving, invalid JSON is kept for the server to report
+        let attributesToSave = {...newSettings};
+        if (linksValue.trim() !== '') {
+            try {
+                attributesToSave.links = JSON.parse(linksValue);
+            } catch (err) {
+                // Keep as string if invalid JSON
+            }
+        } else {
+            attributesToSave.links = [];
+        }
+
+        props.onChange({id: props.id, attributes: attributesToSave});
+    }
+
+    const handleExternalURLInput = (e) => {
+        let newSettings = {...settings};
+        newSettings = {...newSettings, externalurl: e.target.value};
+
+        setSettings(newSettings);
+        props.onChange({id: props.id, attributes: newSettings});
+    }
+
+    const handleUILinksInput = (e) => {
+        let newSettings = {...settings};
+        newSettings = {...newSettings, uilinks: e.target.value};
+
+        setSettings(newSettings);
+        props.onChange({id: props.id, attributes: newSettings});
+    }
+
+    const handleThreadRepliesInput = (e) => {
+        let newSettings = {...settings};
+        const threadRepliesValue = e.target.value;
+
+        newSettings = {...newSettings, threadreplies: threadRepliesValue};
+
+        setSettings(newSettings);
+
+        // Convert string to an object when saving, invalid JSON is kept for the server to report
+        let attributesToSave = {...newSettings};
+        if (threadRepliesValue.trim() !== '') {
+            try {
+                attributesToSave.threadreplies = JSON.parse(threadRepliesValue);
+            } catch (err) {
+                // Keep as string if invalid JSON
+            }
+        } else {
+            attributesToSave.threadreplies = {};
+        }
+
+        props.onChange({id: props.id, attributes: attributesToSave});
+    }
+
+    const handleStormThresholdInput = (e) => {
+        let newSettings = {...settings};
+        const threshold = parseInt(e.target.value, 10);
+        newSettings = {...newSettings, stormthreshold: isNaN(threshold) || threshold < 0 ? 0 : threshold};
+
+        setSettings(newSettings);
+        props.onChange({id: props.id, attributes: newSettings});
+    }
+
+    const handleHistoryRetentionInput = (e) => {
+        let newSettings = {...settings};
+        const days = parseInt(e.target.value, 10);
+        newSettings = {...newSettings, historyretentiondays: isNaN(days) || days < 0 ? 0 : days};
+
+        setSettings(newSettings);
+        props.onChange({id: props.id, attributes: newSettings});
+    }
+
+    const handleDigestScheduleInput = (e) => {
+        let newSettings = {...settings};
+        newSettings = {...newSettings, digestschedule: e.target.value};
+
+        setSettings(newSettings);
+        props.onChange({id: props.id, attributes: newSettings});
+    }
+
+    const handleDigestTimezoneInput = (e) => {
+        let newSettings = {...settings};
+        newSettings = {...newSettings, digesttimezone: e.target.value};
+
+        setSettings(newSettings);
+        props.onChange({id: props.id, attributes: newSettings});
+    }
+
+    const handleTimezoneInput = (e) => {
+        let newSettings = {...settings};
+        newSettings = {...newSettings, timezone: e.target.value};
+
+        setSettings(newSettings);
+        props.onChange({id: props.id, attributes: newSettings});
+    }
+
+    const handleLanguageInput = (e) => {
+        let newSettings = {...settings};
+        newSettings = {...newSettings, language: e.target.value};
+
+        setSettings(newSettings);
+        props.onChange({id: props.id, attributes: newSettings});
+    }
+
+    const handleHeartbeatMatchersInput = (e) => {
+        let newSettings = {...settings};
+        newSettings = {...newSettings, heartbeatmatchers: e.target.value};
+
+        setSettings(newSettings);
+        props.onChange({id: props.id, attributes: newSettings});
+    }
+
+    const handleHeartbeatIntervalInput = (e) => {
+        let newSettings = {...settings};
+        newSettings = {...newSettings, heartbeatinterval: e.target.value};
+
+        setSettings(newSettings);
+        props.onChange({id: props.id, attributes: newSettings});
+    }
+
+    const handleHeartbeatGraceInput = (e) => {
+        let newSettings = {...settings};
+        newSettings = {...newSettings, heartbeatgrace: e.target.value};
+
+        setSettings(newSettings);
+        props.onChange({id: props.id, attributes: newSettings});
+    }
+
+    const handleHealthCheckChange = (e) => {
+        let newSettings = {...settings};
+        newSettings = {...newSettings, healthcheck: e.target.checked};
+
+        setSettings(newSettings);
+        props.onChange({id: props.id, attributes: newSettings});
+    }
+
+    const handleHealthChannelInput = (e) => {
+        let newSettings = {...settings};
+        newSettings = {...newSettings, healthchannel: e.target.value};
+
+        setSettings(newSettings);
+        props.onChange({id: props.id, attributes: newSettings});
+    }
+
     const handleStateColorsChange = (colors) => {
         let newSettings = {...settings};
         newSettings = {...newSettings, statecolors: colors};
@@ -215,7 +468,7 @@ const AMAttribute = (props) => {
         );
     }
 
-    const generateTextareaSetting = ( title, settingName, onChangeFunction, helpTextJSX) => {
+    const generateTextareaSetting = ( title, settingName, onChangeFunction, helpTextJSX, footerJSX) => {
         return (
             <div className="form-group" >
             <label className="control-label col-sm-4">
@@ -232,6 +485,7 @@ const AMAttribute = (props) => {
                 <div className="help-text">
                     {helpTextJSX}
                 </div>
+                {footerJSX}
             </div>
         </div>
         );
@@ -311,6 +565,30 @@ const AMAttribute = (props) => {
                         )
                     }
 
+                    { generateSimpleStringInputSetting(
+                        "Source:",
+                        "source",
+                        handleSourceInput,
+                        (<span>{"Format of the webhook payloads: "}<code>{"alertmanager"}</code>{", "}<code>{"grafana"}</code>{" or "}<code>{"mapping"}</code>{" for any JSON with the field mapping below. AlertManager or Grafana is detected from each payload when empty. With "}<code>{"grafana"}</code>{", the AlertManager URL is the Grafana URL and silences go through the Grafana Alertmanager."}</span>)
+                        )
+                    }
+
+                    { generateSimpleStringInputSetting(
+                        "Grafana Token:",
+                        "grafanatoken",
+                        handleGrafanaTokenInput,
+                        (<span>{"Grafana service account token with the alerting permissions, used to silence alerts and list silences of the "}<code>{"grafana"}</code>{" source."}</span>)
+                        )
+                    }
+
+                    { generateTextareaSetting(
+                        "Field Mapping:",
+                        "fieldmapping",
+                        handleFieldMappingInput,
+                        (<span>{"JSON object mapping the payloads of the "}<code>{"mapping"}</code>{" source to alerts. "}<code>{"@"}</code>{" paths select fields of the alert, "}<code>{"$"}</code>{" paths fields of the payload, other values are literals, e.g. "}<code>{'{"alerts": "$.checks", "labels": {"alertname": "@.name", "severity": "warning"}, "annotations": {"summary": "@.output"}, "status": "@.state", "resolvedvalues": ["ok"], "startsat": "@.since"}'}</code></span>)
+                        )
+                    }
+
                     { generateCheckboxSetting(
                         "Enable Action Buttons:",
                         "enableactions",
@@ -327,6 +605,94 @@ const AMAttribute = (props) => {
                         )
                     }
 
+                    { generateSimpleStringInputSetting(
+                        "Alert Storm Threshold:",
+                        "stormthreshold",
+                        handleStormThresholdInput,
+                        (<span>{"Maximum number of alerts per minute posted individually to the channel. Above it, a single alert storm summary post is updated instead until the rate drops. Set to 0 to disable."}</span>)
+                        )
+                    }
+
+                    { generateSimpleStringInputSetting(
+                        "History Retention (days):",
+                        "historyretentiondays",
+                        handleHistoryRetentionInput,
+                        (<span>{"Number of days the incident timeline of each alert is kept for "}<code>{"/alertmanager history"}</code>{". Defaults to 30 days when set to 0."}</span>)
+                        )
+                    }
+
+                    { generateSimpleStringInputSetting(
+                        "Digest Schedule:",
+                        "digestschedule",
+                        handleDigestScheduleInput,
+                        (<span>{"Cron expression (minute hour day-of-month month day-of-week) of the alert digest posts, e.g. "}<code>{"0 9 * * 1-5"}</code>{" for weekdays at 9:00. Leave empty to disable digests."}</span>)
+                        )
+                    }
+
+                    { generateSimpleStringInputSetting(
+                        "Digest Timezone:",
+                        "digesttimezone",
+                        handleDigestTimezoneInput,
+                        (<span>{"IANA timezone of the digest schedule, e.g. "}<code>{"Europe/Berlin"}</code>{". Defaults to the display timezone."}</span>)
+                        )
+                    }
+
+                    { generateSimpleStringInputSetting(
+                        "Display Timezone:",
+                        "timezone",
+                        handleTimezoneInput,
+                        (<span>{"IANA timezone of the times in alert posts and thread replies, e.g. "}<code>{"America/New_York"}</code>{". Defaults to UTC."}</span>)
+                        )
+                    }
+
+                    { generateSimpleStringInputSetting(
+                        "Language:",
+                        "language",
+                        handleLanguageInput,
+                        (<span>{"Language of the alert posts, thread replies and digests of this config: "}<code>{"en"}</code>{" or "}<code>{"de"}</code>{". Defaults to English."}</span>)
+                        )
+                    }
+
+                    { generateSimpleStringInputSetting(
+                        "Heartbeat Matchers:",
+                        "heartbeatmatchers",
+                        handleHeartbeatMatchersInput,
+                        (<span>{"Label matchers of an always-firing heartbeat alert, e.g. "}<code>{'alertname="Watchdog"'}</code>{". Heartbeat alerts are never posted; when none arrives in time, a critical message reports the alerting pipeline as broken. Leave empty to turn the dead man's switch off."}</span>)
+                        )
+                    }
+
+                    { generateSimpleStringInputSetting(
+                        "Heartbeat Interval:",
+                        "heartbeatinterval",
+                        handleHeartbeatIntervalInput,
+                        (<span>{"Expected repeat interval of the heartbeat alert, the "}<code>{"repeat_interval"}</code>{" of its route, e.g. "}<code>{"5m"}</code>{"."}</span>)
+                        )
+                    }
+
+                    { generateSimpleStringInputSetting(
+                        "Heartbeat Grace Period:",
+                        "heartbeatgrace",
+                        handleHeartbeatGraceInput,
+                        (<span>{"Delay past the interval before the pipeline is reported broken, e.g. "}<code>{"2m"}</code>{". Defaults to the interval."}</span>)
+                        )
+                    }
+
+                    { generateCheckboxSetting(
+                        "Monitor AlertManager Health:",
+                        "healthcheck",
+                        handleHealthCheckChange,
+                        (<span>{"Check "}<code>{"/-/healthy"}</code>{", "}<code>{"/-/ready"}</code>{" and the status API of the AlertManager every minute, and post when it becomes unreachable, loses cluster peers or changes version, and when it recovers"}</span>)
+                        )
+                    }
+
+                    { generateSimpleStringInputSetting(
+                        "Health Channel:",
+                        "healthchannel",
+                        handleHealthChannelInput,
+                        (<span>{"Channel of the team for the AlertManager health messages, e.g. an admin channel. Defaults to the alert channel."}</span>)
+                        )
+                    }
+
                     <ColorMapEditor
                         label="Alert State Colors"
                         description="Customize colors for different alert states. Click the color swatch to change."
@@ -397,7 +763,8 @@ const AMAttribute = (props) => {
                         "Firing Alert Template:",
                         "firingtemplate",
                         handleFiringTemplateInput,
-                        (<span>{"Custom Go template for firing alerts. Leave empty to use default formatting. Available fields: .Labels, .Annotations, .StartsAt, .GeneratorURL"}</span>)
+                        (<span>{"Custom Go template for firing alerts. Leave empty to use default formatting. Available fields: .Labels, .Annotations, .StartsAt, .GeneratorURL, .GroupLabels, .CommonLabels, .CommonAnnotations, .Receiver, .ExternalURL"}</span>),
+                        (<TemplatePreview template={settings.firingtemplate} configId={props.id}/>)
                         )
                     }
 
@@ -405,7 +772,48 @@ const AMAttribute = (props) => {
                         "Resolved Alert Template:",
                         "resolvedtemplate",
                         handleResolvedTemplateInput,
-                        (<span>{"Custom Go template for resolved alerts. Leave empty to use default formatting. Available fields: .Labels, .Annotations, .StartsAt, .EndsAt"}</span>)
+                        (<span>{"Custom Go template for resolved alerts. Leave empty to use default formatting. Available fields: .Labels, .Annotations, .StartsAt, .EndsAt, .GroupLabels, .CommonLabels, .CommonAnnotations, .Receiver, .ExternalURL"}</span>),
+                        (<TemplatePreview template={settings.resolvedtemplate} configId={props.id} resolved={true}/>)
+                        )
+                    }
+
+                    { generateTextareaSetting(
+                        "Thread Replies:",
+                        "threadreplies",
+                        handleThreadRepliesInput,
+                        (<span>{"JSON object customizing the thread replies of the acked, unacked, silenced and resolved events with a template, or turning them off, e.g. "}<code>{'{"acked": {"template": "👁️ @{{ .Actor }} is on it"}, "unacked": {"disabled": true}}'}</code>{". Use "}<code>{"/alertmanager template preview"}</code>{" to preview them."}</span>)
+                        )
+                    }
+
+                    { generateTextareaSetting(
+                        "Template Rules:",
+                        "templaterules",
+                        handleTemplateRulesInput,
+                        (<span>{"JSON list of rules selecting templates by label matchers or receiver, the first match wins and empty templates fall back to the templates above, e.g. "}<code>{'[{"name": "kubernetes", "matchers": "namespace=~kube-.*", "firingtemplate": "...", "resolvedtemplate": "...", "ackedtemplate": "..."}]'}</code></span>)
+                        )
+                    }
+
+                    { generateTextareaSetting(
+                        "Links:",
+                        "links",
+                        handleLinksInput,
+                        (<span>{"JSON list of links of the alert posts with a URL template, optional label matchers and status, shown in a Links field or as buttons. Links rendering empty are left out, e.g. "}<code>{'[{"name": "Runbook", "url": "{{ .Annotations.runbook_url }}"}, {"name": "Dashboard", "url": "https://grafana/d/x?var-ns={{ .Labels.namespace }}", "matchers": "namespace=~\".+\"", "status": "firing", "display": "button"}]'}</code></span>)
+                        )
+                    }
+
+                    { generateSimpleStringInputSetting(
+                        "Alertmanager UI URL:",
+                        "externalurl",
+                        handleExternalURLInput,
+                        (<span>{"URL of the built-in UI links, e.g. a Karma instance. Defaults to the external URL Alertmanager sends."}</span>)
+                        )
+                    }
+
+                    { generateSimpleStringInputSetting(
+                        "UI Links:",
+                        "uilinks",
+                        handleUILinksInput,
+                        (<span>{"Adds built-in links of the alert in the UI: "}<code>{"alertmanager"}</code>{" for Open in Alertmanager and Silence in UI, "}<code>{"karma"}</code>{" for Open in Karma. Leave empty to leave them out."}</span>)
                         )
                     }
                 </div>
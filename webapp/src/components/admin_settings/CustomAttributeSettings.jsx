@@ -28,6 +28,9 @@ const CustomAttributesSettings = (props) => {
 
         const emptySetting = { '0' : {
                 alertmanagerurl: '',
+                source: '',
+                grafanatoken: '',
+                fieldmapping: {},
                 channel: '',
                 team: '',
                 token: '',
@@ -36,7 +39,22 @@ const CustomAttributesSettings = (props) => {
                 statecolors: {},
                 severitycolors: {},
                 firingtemplate: '',
-                resolvedtemplate: ''
+                resolvedtemplate: '',
+                templaterules: [],
+                links: [],
+                externalurl: '',
+                threadreplies: {},
+                stormthreshold: 0,
+                historyretentiondays: 0,
+                digestschedule: '',
+                digesttimezone: '',
+                timezone: '',
+                language: '',
+                heartbeatmatchers: '',
+                heartbeatinterval: '',
+                heartbeatgrace: '',
+                healthcheck: false,
+                healthchannel: ''
             }
         };
 
@@ -103,10 +121,28 @@ const CustomAttributesSettings = (props) => {
                         channel: value.channel,
                         token: value.token,
                         alertmanagerurl: value.alertmanagerurl,
+                        source: value.source,
+                        grafanatoken: value.grafanatoken,
+                        fieldmapping: value.fieldmapping,
                         enableactions: value.enableactions,
                         severitymentions: value.severitymentions,
                         firingtemplate: value.firingtemplate,
-                        resolvedtemplate: value.resolvedtemplate
+                        resolvedtemplate: value.resolvedtemplate,
+                        templaterules: value.templaterules,
+                        links: value.links,
+                        externalurl: value.externalurl,
+                        threadreplies: value.threadreplies,
+                        stormthreshold: value.stormthreshold,
+                        historyretentiondays: value.historyretentiondays,
+                        digestschedule: value.digestschedule,
+                        digesttimezone: value.digesttimezone,
+                        timezone: value.timezone,
+                        language: value.language,
+                        heartbeatmatchers: value.heartbeatmatchers,
+                        heartbeatinterval: value.heartbeatinterval,
+                        heartbeatgrace: value.heartbeatgrace,
+                        healthcheck: value.healthcheck,
+                        healthchannel: value.healthchannel
                     }}
                 />
             );
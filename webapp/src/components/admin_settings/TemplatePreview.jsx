@@ -0,0 +1,119 @@
+import React, {useState} from 'react';
+import PropTypes from 'prop-types';
+import {FormattedMessage} from 'react-intl';
+
+import {id as pluginId} from '../../manifest';
+
+const getCSRFToken = () => {
+    const match = document.cookie.match(/(?:^|;\s*)MMCSRF=([^;]+)/);
+    return match ? match[1] : '';
+};
+
+const defaultPositionMessages = {
+    line: 'line {line}',
+    line_column: 'line {line}, column {column}',
+    template_line: 'template {template}, line {line}',
+    template_line_column: 'template {template}, line {line}, column {column}',
+};
+
+const TemplatePreview = (props) => {
+    const [preview, setPreview] = useState(null);
+    const [loading, setLoading] = useState(false);
+
+    const handlePreview = async (e) => {
+        e.preventDefault();
+        setLoading(true);
+
+        try {
+            const response = await fetch(`${window.basename || ''}/plugins/${pluginId}/api/template/preview`, {
+                method: 'POST',
+                credentials: 'same-origin',
+                headers: {
+                    'Content-Type': 'application/json',
+                    'X-Requested-With': 'XMLHttpRequest',
+                    'X-CSRF-Token': getCSRFToken(),
+                },
+                body: JSON.stringify({template: props.template, config_id: props.configId, resolved: props.resolved}),
+            });
+            if (response.ok) {
+                setPreview(await response.json());
+            } else {
+                setPreview({error: await response.text()});
+            }
+        } catch (err) {
+            setPreview({error: err.message});
+        }
+
+        setLoading(false);
+    };
+
+    const position = () => {
+        if (!preview.line) {
+            return null;
+        }
+
+        // Errors of thread reply and library templates name their template
+        let id = preview.column ? 'line_column' : 'line';
+        if (preview.template && preview.template !== 'alert') {
+            id = `template_${id}`;
+        }
+        return (
+            <>
+                {' ('}
+                <FormattedMessage
+                    id={`alertmanager.template_preview.${id}`}
+                    defaultMessage={defaultPositionMessages[id]}
+                    values={{template: preview.template, line: preview.line, column: preview.column}}
+                />
+                {')'}
+            </>
+        );
+    };
+
+    return (
+        <div className='help-text'>
+            <button
+                type='button'
+                className='btn btn-default'
+                onClick={handlePreview}
+                disabled={loading || !props.template}
+            >
+                { loading ?
+                    <FormattedMessage
+                        id='alertmanager.template_preview.rendering'
+                        defaultMessage='Rendering...'
+                    /> :
+                    <FormattedMessage
+                        id='alertmanager.template_preview.button'
+                        defaultMessage='Preview'
+                    />
+                }
+            </button>
+            { preview && preview.error &&
+                <div className='has-error'>
+                    <span className='control-label'>{preview.error}{position()}</span>
+                </div>
+            }
+            { preview && !preview.error &&
+                <div>
+                    <div>
+                        <FormattedMessage
+                            id='alertmanager.template_preview.rendered'
+                            defaultMessage='Rendered against the {sample}:'
+                            values={{sample: preview.sample}}
+                        />
+                    </div>
+                    <pre>{preview.rendered}</pre>
+                </div>
+            }
+        </div>
+    );
+};
+
+TemplatePreview.propTypes = {
+    template: PropTypes.string,
+    configId: PropTypes.string,
+    resolved: PropTypes.bool,
+};
+
+export default TemplatePreview;
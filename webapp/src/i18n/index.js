@@ -0,0 +1,10 @@
+import en from './en.json';
+import de from './de.json';
+
+// The bundles of the webapp, the server localizes the bot messages with its own bundles
+const translations = {en, de};
+
+// getTranslations returns the bundle of a Mattermost locale, English when it is not shipped
+export function getTranslations(locale) {
+    return translations[locale] || en;
+}
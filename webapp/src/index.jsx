@@ -1,6 +1,7 @@
 import {id as pluginId} from './manifest';
 
 import CustomAttributesSettings from './components/admin_settings/CustomAttributeSettings.jsx';
+import {getTranslations} from './i18n';
 
 export default class Plugin {
     initialize(registry, store) {
@@ -13,6 +14,7 @@ export default class Plugin {
         }
 
         registry.registerAdminConsoleCustomSetting('alertConfigs', CustomAttributesSettingsWrapper);
+        registry.registerTranslations(getTranslations);
     }
 }
 
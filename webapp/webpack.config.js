@@ -76,6 +76,7 @@ module.exports = {
         'react-redux': 'ReactRedux',
         'prop-types': 'PropTypes',
         'react-bootstrap': 'ReactBootstrap',
+        'react-intl': 'ReactIntl',
     },
     output: {
         path: path.join(__dirname, '/dist'),